@@ -1,16 +1,20 @@
 package config
 
 import (
+	"fmt"
 	"io/ioutil"
-	"log"
+	. "project/keyvalue/errs"
+	"strconv"
+	"strings"
+	"time"
 
 	yaml "gopkg.in/yaml.v2"
 )
 
 // Default vrednosti
 const (
-	default_WalBufferCapacity = 10
-	default_WalWaterMark = 20
+	default_WalSegmentSize = 1 << 20
+	default_WalSyncMode = "none"
 	default_MemtableSize = 20
 	default_MemtableStructure = "b_tree"
 	default_SStableInterval = 10
@@ -24,13 +28,23 @@ const (
 	default_CompactionType = "size_tiered"
 	default_LruCap = 10
 	default_LeveledCompactionMultiplier = 10
+	default_MaxImmutableMemtables = 2
+	default_MaxConcurrentCompactions = 1
+	default_Level1SlowdownTables = 20
+	default_Level1StopTables = 36
+	default_SoftPendingCompactionBytes = 64 << 20
+	default_HardPendingCompactionBytes = 256 << 20
+	default_TombstoneCompactionRatio = 0.5
+	default_FifoMaxBytes = 1 << 30
+	default_TimeWindowSeconds = 3600
 )
 
 
 type Config struct {
 	//stringovi posle atributa su tu da bi Unmarshal znao gde sta da namapira
-	WalBufferCapacity      uint    `yaml:"wal_buffer_capacity"`
-	WalWaterMark           uint    `yaml:"wal_water_mark"`
+	WalSegmentSize         uint64  `yaml:"wal_segment_size"` //Velicina segmenta WAL-a u bajtovima, segment se prealocira na nju
+	WalSyncMode            string  `yaml:"wal_sync_mode"` //none, interval:<ms> ili always (vidi ParseWalSyncMode)
+	WalStrictRecovery      bool    `yaml:"wal_strict_recovery"` //Baza se ne otvara ukoliko je poslednji zapis WAL-a nepotpun (inace se odseca)
 	MemtableSize           uint    `yaml:"memtable_size"`
 	MemtableStructure      string  `yaml:"memtable_structure"`
 	SStableInterval        uint    `yaml:"sstable_interval"`
@@ -44,13 +58,23 @@ type Config struct {
 	CompactionType         string  `yaml:"compaction_type"`
 	LeveledCompactionMultiplier uint `yaml:"leveled_compaction_multiplier"`
 	LruCap                 int     `yaml:"lru_cap"`
+	MaxImmutableMemtables  uint    `yaml:"max_immutable_memtables"` //Najvise popunjenih memtabela koje cekaju flush, upisi cekaju kada ih ima toliko
+	MaxConcurrentCompactions uint  `yaml:"max_concurrent_compactions"` //Najvise kompakcija koje se u pozadini izvrsavaju istovremeno
+	//Pragovi za usporavanje (slowdown/soft) i zaustavljanje (stop/hard) upisa kada kompakcija kasni
+	Level1SlowdownTables   uint    `yaml:"level1_slowdown_tables"`
+	Level1StopTables       uint    `yaml:"level1_stop_tables"`
+	SoftPendingCompactionBytes uint64 `yaml:"soft_pending_compaction_bytes"`
+	HardPendingCompactionBytes uint64 `yaml:"hard_pending_compaction_bytes"`
+	TombstoneCompactionRatio float64 `yaml:"tombstone_compaction_ratio"` //Sstabela sa bar ovolikim udelom tombstone-ova se kompaktuje i kada nivo nije pun
+	FifoMaxBytes           uint64  `yaml:"fifo_max_bytes"` //Fifo kompakcija brise najstarije sstabele kada ih ukupno ima vise od ovoliko bajtova
+	TimeWindowSeconds      uint    `yaml:"time_window_seconds"` //Velicina vremenskog prozora time_window kompakcije
 }
 
 // Ukoliko unutar config.yml fali neki atribut
 func initializeConfig() *Config {
 	c := new(Config)
-	c.WalBufferCapacity = default_WalBufferCapacity
-	c.WalWaterMark = default_WalWaterMark
+	c.WalSegmentSize = default_WalSegmentSize
+	c.WalSyncMode = default_WalSyncMode
 	c.MemtableSize = default_MemtableSize
 	c.MemtableStructure = default_MemtableStructure
 	c.SStableInterval = default_SStableInterval
@@ -64,29 +88,67 @@ func initializeConfig() *Config {
 	c.CompactionType = default_CompactionType
 	c.LeveledCompactionMultiplier = default_LeveledCompactionMultiplier
 	c.LruCap = default_LruCap
+	c.MaxImmutableMemtables = default_MaxImmutableMemtables
+	c.MaxConcurrentCompactions = default_MaxConcurrentCompactions
+	c.Level1SlowdownTables = default_Level1SlowdownTables
+	c.Level1StopTables = default_Level1StopTables
+	c.SoftPendingCompactionBytes = default_SoftPendingCompactionBytes
+	c.HardPendingCompactionBytes = default_HardPendingCompactionBytes
+	c.TombstoneCompactionRatio = default_TombstoneCompactionRatio
+	c.FifoMaxBytes = default_FifoMaxBytes
+	c.TimeWindowSeconds = default_TimeWindowSeconds
 	return c
 }
 
-// Dobavlja konfiguraciju iz fajla
-func GetConfig() *Config {
+// Vraca konfiguraciju sa default vrednostima (bez citanja fajla)
+func DefaultConfig() *Config {
 	c := initializeConfig()
+	c.validate()
+	return c
+}
 
-	configData, err := ioutil.ReadFile("config/config.yml")
+// Ucitava konfiguraciju iz fajla na zadatoj putanji
+// Atributi koji fale ili su neispravni dobijaju default vrednosti
+func LoadConfig(path string) (*Config, error) {
+	c := initializeConfig()
+
+	configData, err := ioutil.ReadFile(path)
 	if err != nil {
-		log.Fatal(err)
+		return nil, NewIOError(err)
 	}
 	//upisuje sve iz fileu u osobine configu
-	yaml.Unmarshal(configData, c)
+	err = yaml.Unmarshal(configData, c)
+	if err != nil {
+		return nil, fmt.Errorf("neispravan config fajl %s: %w", path, err)
+	}
+
+	c.validate()
+	return c, nil
+}
 
+// Zapisuje konfiguraciju u fajl na zadatoj putanji (u istom formatu kao config.yml)
+func (c *Config) Save(path string) error {
+	configData, err := yaml.Marshal(c)
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(path, configData, 0600)
+	if err != nil {
+		return NewIOError(err)
+	}
+	return nil
+}
+
+// Postavlja default vrednosti tamo gde su zadate neispravne
+func (c *Config) validate() {
 	// Provera defaultnih vrednosti
-	if c.WalBufferCapacity < 2 {
-		c.WalBufferCapacity = default_WalBufferCapacity
+	if c.WalSegmentSize == 0 {
+		c.WalSegmentSize = default_WalSegmentSize
 	}
 
-	if c.WalWaterMark < 10 {
-		c.WalWaterMark = default_WalWaterMark
-	} else if c.WalWaterMark > 99999 {
-		c.WalWaterMark = 99999
+	_, _, err := ParseWalSyncMode(c.WalSyncMode)
+	if err != nil {
+		c.WalSyncMode = default_WalSyncMode
 	}
 
 	if c.MemtableSize == 0 {
@@ -131,7 +193,8 @@ func GetConfig() *Config {
 		c.TokenBucketRate = default_TokenBucketRate
 	}
 
-	if c.CompactionType != "size_tiered" && c.CompactionType != "leveled" {
+	if c.CompactionType != "size_tiered" && c.CompactionType != "leveled" &&
+		c.CompactionType != "fifo" && c.CompactionType != "time_window" {
 		c.CompactionType = default_CompactionType
 	}
 
@@ -143,5 +206,59 @@ func GetConfig() *Config {
 		c.LruCap = default_LruCap
 	}
 
-	return c
+	if c.MaxImmutableMemtables == 0 {
+		c.MaxImmutableMemtables = default_MaxImmutableMemtables
+	}
+
+	if c.MaxConcurrentCompactions == 0 {
+		c.MaxConcurrentCompactions = default_MaxConcurrentCompactions
+	}
+
+	if c.Level1SlowdownTables == 0 {
+		c.Level1SlowdownTables = default_Level1SlowdownTables
+	}
+
+	//Upisi se zaustavljaju tek nakon usporavanja
+	if c.Level1StopTables < c.Level1SlowdownTables {
+		c.Level1StopTables = c.Level1SlowdownTables
+	}
+
+	if c.SoftPendingCompactionBytes == 0 {
+		c.SoftPendingCompactionBytes = default_SoftPendingCompactionBytes
+	}
+
+	if c.HardPendingCompactionBytes < c.SoftPendingCompactionBytes {
+		c.HardPendingCompactionBytes = c.SoftPendingCompactionBytes
+	}
+
+	if c.TombstoneCompactionRatio <= 0 || c.TombstoneCompactionRatio > 1 {
+		c.TombstoneCompactionRatio = default_TombstoneCompactionRatio
+	}
+
+	if c.FifoMaxBytes == 0 {
+		c.FifoMaxBytes = default_FifoMaxBytes
+	}
+
+	if c.TimeWindowSeconds == 0 {
+		c.TimeWindowSeconds = default_TimeWindowSeconds
+	}
+}
+
+// Rastavlja wal_sync_mode na nacin i period sync-ovanja WAL-a
+// none        -> segment se nikad ne sync-uje (upis se zavrsava kada je predat operativnom sistemu)
+// interval:ms -> segment se sync-uje u pozadini svakih ms milisekundi
+// always      -> upis se zavrsava tek kada je segment sync-ovan
+func ParseWalSyncMode(mode string) (string, time.Duration, error) {
+	switch mode {
+	case "none", "always":
+		return mode, 0, nil
+	}
+	if !strings.HasPrefix(mode, "interval:") {
+		return "", 0, fmt.Errorf("neispravan wal_sync_mode: %s", mode)
+	}
+	interval, err := strconv.ParseUint(strings.TrimPrefix(mode, "interval:"), 10, 32)
+	if err != nil || interval == 0 {
+		return "", 0, fmt.Errorf("neispravan period u wal_sync_mode: %s", mode)
+	}
+	return "interval", time.Duration(interval) * time.Millisecond, nil
 }
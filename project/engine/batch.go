@@ -0,0 +1,172 @@
+package engine
+
+import (
+	"fmt"
+	. "project/keyvalue/errs"
+	. "project/keyvalue/structures/dataType"
+	. "project/keyvalue/structures/entry"
+	"time"
+)
+
+// Skup upisa i brisanja koji se primenjuju atomicno
+// U WAL se zapisuje kao jedan zapis sa zajednickim CRC-om,
+// a u memtabele se ubacuje odjednom i citaocima postaje vidljiv ceo odjednom
+// Batch se ne sme menjati iz vise gorutina istovremeno
+// Operacije mogu pripadati razlicitim familijama kolona, a i tada se primenjuju sve ili nijedna
+type WriteBatch struct {
+	keys     []string
+	data     []*Data
+	families []*ColumnFamily //nil oznacava podrazumevanu familiju
+}
+
+func NewWriteBatch() *WriteBatch {
+	batch := new(WriteBatch)
+	batch.Clear()
+	return batch
+}
+
+// Dodaje upis u batch
+func (batch *WriteBatch) Put(key string, value []byte) {
+	batch.PutCF(nil, key, value)
+}
+
+// Dodaje upis u zadatu familiju
+func (batch *WriteBatch) PutCF(cf *ColumnFamily, key string, value []byte) {
+	batch.add(cf, key, NewData(value, false, 0))
+}
+
+// Dodaje upis koji istice nakon zadatog vremena u batch
+// Vreme isteka se racuna od dodavanja u batch
+func (batch *WriteBatch) PutWithTTL(key string, value []byte, ttl time.Duration) {
+	batch.PutWithTTLCF(nil, key, value, ttl)
+}
+
+// Dodaje upis koji istice nakon zadatog vremena u zadatu familiju
+func (batch *WriteBatch) PutWithTTLCF(cf *ColumnFamily, key string, value []byte, ttl time.Duration) {
+	data := NewData(value, false, 0)
+	data.Expiry = expiryAfter(ttl)
+	batch.add(cf, key, data)
+}
+
+// Dodaje brisanje u batch
+func (batch *WriteBatch) Delete(key string) {
+	batch.DeleteCF(nil, key)
+}
+
+// Dodaje brisanje iz zadate familije
+func (batch *WriteBatch) DeleteCF(cf *ColumnFamily, key string) {
+	batch.add(cf, key, NewData(make([]byte, 0), true, 0))
+}
+
+// Dodaje brisanje opsega [startKey, endKey) u batch
+// Ukoliko pocetak nije manji od kraja Write vraca ErrInvalidRange
+func (batch *WriteBatch) DeleteRange(startKey string, endKey string) {
+	batch.DeleteRangeCF(nil, startKey, endKey)
+}
+
+// Dodaje brisanje opsega iz zadate familije
+func (batch *WriteBatch) DeleteRangeCF(cf *ColumnFamily, startKey string, endKey string) {
+	data := NewData([]byte(endKey), false, 0)
+	data.RangeDelete = true
+	batch.add(cf, startKey, data)
+}
+
+// Dodaje operand merge operatora u batch
+// Ukoliko familija nema merge operator Write vraca ErrNoMergeOperator
+func (batch *WriteBatch) Merge(key string, operand []byte) {
+	batch.MergeCF(nil, key, operand)
+}
+
+// Dodaje operand merge operatora zadate familije
+func (batch *WriteBatch) MergeCF(cf *ColumnFamily, key string, operand []byte) {
+	data := NewData(operand, false, 0)
+	data.Operand = true
+	batch.add(cf, key, data)
+}
+
+func (batch *WriteBatch) add(cf *ColumnFamily, key string, data *Data) {
+	batch.keys = append(batch.keys, key)
+	batch.data = append(batch.data, data)
+	batch.families = append(batch.families, cf)
+}
+
+// Broj operacija u batch-u
+func (batch *WriteBatch) Len() int {
+	return len(batch.keys)
+}
+
+// Prazni batch da bi mogao ponovo da se koristi
+func (batch *WriteBatch) Clear() {
+	batch.keys = make([]string, 0)
+	batch.data = make([]*Data, 0)
+	batch.families = make([]*ColumnFamily, 0)
+}
+
+// Atomicno primenjuje sve operacije iz batch-a
+// Ili su sve operacije sacuvane u WAL-u ili nijedna
+func (db *DB) Write(batch *WriteBatch) error {
+	err := db.allow()
+	if err != nil {
+		return err
+	}
+	return db.writeDurably(func() error {
+		return db.write(batch)
+	})
+}
+
+// Pozivalac drzi writeLock (upis se izvrsava kroz writeDurably)
+func (db *DB) write(batch *WriteBatch) error {
+	if batch.Len() == 0 {
+		return nil
+	}
+	families := make([]*ColumnFamily, batch.Len())
+	for i, cf := range batch.families {
+		if cf == nil {
+			cf = db.defaultFamily
+		}
+		if cf.db != db {
+			return fmt.Errorf("%w: %s pripada drugoj bazi", ErrInvalidFamily, cf.name)
+		}
+		if batch.data[i].Operand && cf.operator == nil {
+			return ErrNoMergeOperator
+		}
+		if batch.data[i].RangeDelete && batch.keys[i] >= string(batch.data[i].Value) {
+			return ErrInvalidRange
+		}
+		families[i] = cf
+	}
+
+	//Sve operacije dobijaju isto vreme, a redne brojeve redom kojim su dodate
+	timestamp := uint64(time.Now().Unix())
+	keys := make([]string, batch.Len())
+	data := make([]*Data, batch.Len())
+	entries := make([]*Entry, batch.Len())
+	for i := 0; i < batch.Len(); i++ {
+		keys[i] = batch.keys[i]
+		data[i] = NewData(batch.data[i].Value, batch.data[i].Tombstone, timestamp)
+		data[i].Seq = db.nextSeq()
+		data[i].Expiry = batch.data[i].Expiry
+		data[i].Operand = batch.data[i].Operand
+		data[i].RangeDelete = batch.data[i].RangeDelete
+		entries[i] = families[i].walEntry(keys[i], data[i])
+	}
+
+	//UPISUJEMO U WAL kao jedan zapis
+	_, err := db.wal.Append(NewBatchEntry(entries, timestamp))
+	if err != nil {
+		return err
+	}
+
+	//UPISEMO U OM -> MEMTABLE
+	//Flush se proverava tek kada su sve operacije ubacene da bi ceo batch zavrsio u istim sstabelama
+	db.insert(families, keys, data)
+
+	//Stare vrednosti u cache-u vise ne vaze
+	for i := range keys {
+		err = families[i].invalidate(keys[i], data[i])
+		if err != nil {
+			return err
+		}
+	}
+	return db.flushIfFull()
+}
@@ -0,0 +1,342 @@
+package engine
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	. "project/keyvalue/config"
+	. "project/keyvalue/errs"
+	. "project/keyvalue/structures/dataType"
+	. "project/keyvalue/structures/entry"
+	. "project/keyvalue/structures/iterator"
+	. "project/keyvalue/structures/least_reacently_used"
+	. "project/keyvalue/structures/lsm"
+	. "project/keyvalue/structures/memtable"
+	. "project/keyvalue/structures/merge_operator"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Familija kolona (column family) je poseban prostor kljuceva unutar baze
+// Svaka familija ima svoju memtabelu, LSM stablo, cache i konfiguraciju,
+// a sve dele WAL i redne brojeve upisa, pa je WriteBatch sa upisima u vise familija i dalje atomican
+// Kljucevi upisani direktno kroz DB pripadaju podrazumevanoj familiji
+// Struktura direktorijuma familije:
+// dir/column_families/naziv/config.yml -> konfiguracija familije
+// dir/column_families/naziv/sstable    -> lsm.bin i nivoi sa sstabelama
+// dir/column_families/naziv/cache      -> cache.bin
+type ColumnFamily struct {
+	db            *DB
+	name          string
+	config        *Config
+	operator      MergeOperator
+	memtable      MemTable     //Aktivna memtabela, menja je samo onaj ko drzi writeLock
+	immutables    []MemTable   //Popunjene memtabele koje cekaju flush, od najstarije
+	memtablesLock sync.RWMutex //Stiti zamenu aktivne memtabele i listu nepromenljivih
+	lsm           *Lsm
+	lru           *LRUCache
+}
+
+// Opcije familije kolona
+// Iz konfiguracije se koriste podesavanja memtabele, sstabela, kompakcije i cache-a,
+// a WAL, token bucket, broj memtabela koje cekaju flush, broj istovremenih kompakcija
+// i pragovi za usporavanje upisa su zajednicki i podesavaju se konfiguracijom baze
+type ColumnFamilyOptions struct {
+	Config        *Config       //Ukoliko nije zadata koristi se sacuvana konfiguracija familije, a za novu familiju konfiguracija baze
+	MergeOperator MergeOperator //Spaja operande upisane sa Merge u ovoj familiji
+}
+
+// Naziv podrazumevane familije, njeni podaci su u korenu direktorijuma baze
+const DEFAULT_FAMILY = "default"
+
+const FAMILIES_DIRECTORY = "column_families"
+
+var familyNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Otvara strukture familije iz zadatog direktorijuma
+func (db *DB) openFamily(name string, dir string, config *Config, operator MergeOperator) (*ColumnFamily, error) {
+	var err error
+	cf := new(ColumnFamily)
+	cf.db = db
+	cf.name = name
+	cf.config = config
+	cf.operator = operator
+
+	cf.lsm, err = InitializeLsm(filepath.Join(dir, "sstable"), config, db.snapshots, operator)
+	if err != nil {
+		return nil, err
+	}
+	cf.lru, err = ReadLru(filepath.Join(dir, "cache", "cache.bin"), config)
+	if err != nil {
+		return nil, err
+	}
+	cf.memtable = NewMemTable(config, cf.lsm, db.snapshots)
+	return cf, nil
+}
+
+// Otvara sve familije sacuvane na disku i kreira one iz opcija koje jos ne postoje
+func (db *DB) openFamilies() error {
+	dirEntries, err := os.ReadDir(filepath.Join(db.directory, FAMILIES_DIRECTORY))
+	if err != nil && !os.IsNotExist(err) {
+		return NewIOError(err)
+	}
+
+	for _, dirEntry := range dirEntries {
+		if !dirEntry.IsDir() {
+			continue
+		}
+		name := dirEntry.Name()
+		dir := db.familyDirectory(name)
+		opts := db.options.ColumnFamilies[name]
+		if opts == nil {
+			opts = new(ColumnFamilyOptions)
+		}
+
+		//Zadata konfiguracija zamenjuje sacuvanu
+		config := opts.Config
+		if config != nil {
+			err = config.Save(filepath.Join(dir, "config.yml"))
+		} else {
+			config, err = LoadConfig(filepath.Join(dir, "config.yml"))
+		}
+		if err != nil {
+			return err
+		}
+
+		cf, err := db.openFamily(name, dir, config, opts.MergeOperator)
+		if err != nil {
+			return err
+		}
+		db.families = append(db.families, cf)
+	}
+
+	//Nove familije se kreiraju uvek istim redosledom
+	names := make([]string, 0)
+	for name := range db.options.ColumnFamilies {
+		if db.findFamily(name) == nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		_, err = db.createFamily(name, db.options.ColumnFamilies[name])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (db *DB) familyDirectory(name string) string {
+	return filepath.Join(db.directory, FAMILIES_DIRECTORY, name)
+}
+
+// Vraca sve otvorene familije
+// Familije se samo dodaju, pa se vraceni niz moze koristiti i kada se u medjuvremenu kreira nova
+func (db *DB) familyList() []*ColumnFamily {
+	db.familiesLock.RLock()
+	defer db.familiesLock.RUnlock()
+	return db.families
+}
+
+// Vraca otvorenu familiju sa datim nazivom ili nil
+func (db *DB) findFamily(name string) *ColumnFamily {
+	for _, cf := range db.familyList() {
+		if cf.name == name {
+			return cf
+		}
+	}
+	return nil
+}
+
+// Pravi direktorijum i strukture nove familije
+// Konfiguracija se cuva u direktorijumu familije da bi se familija otvorila isto i pri sledecem pokretanju
+func (db *DB) createFamily(name string, opts *ColumnFamilyOptions) (*ColumnFamily, error) {
+	if name == DEFAULT_FAMILY || !familyNamePattern.MatchString(name) {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidFamily, name)
+	}
+	if opts == nil {
+		opts = new(ColumnFamilyOptions)
+	}
+	config := opts.Config
+	if config == nil {
+		config = db.config
+	}
+
+	dir := db.familyDirectory(name)
+	err := os.MkdirAll(dir, os.ModePerm)
+	if err != nil {
+		return nil, NewIOError(err)
+	}
+	err = config.Save(filepath.Join(dir, "config.yml"))
+	if err != nil {
+		return nil, err
+	}
+
+	cf, err := db.openFamily(name, dir, config, opts.MergeOperator)
+	if err != nil {
+		return nil, err
+	}
+	db.familiesLock.Lock()
+	db.families = append(db.families, cf)
+	db.familiesLock.Unlock()
+	return cf, nil
+}
+
+// Kreira novu familiju kolona
+// Naziv moze sadrzati samo slova, cifre, '_' i '-'
+func (db *DB) CreateColumnFamily(name string, opts *ColumnFamilyOptions) (*ColumnFamily, error) {
+	err := db.lockWrites()
+	if err != nil {
+		return nil, err
+	}
+	defer db.writeLock.Unlock()
+	if name == DEFAULT_FAMILY || db.findFamily(name) != nil {
+		return nil, fmt.Errorf("%w: %s", ErrFamilyExists, name)
+	}
+	return db.createFamily(name, opts)
+}
+
+// Vraca familiju kolona sa datim nazivom
+// Ukoliko familija ne postoji vraca ErrNoFamily
+func (db *DB) ColumnFamily(name string) (*ColumnFamily, error) {
+	if db.closed.Load() {
+		return nil, ErrClosed
+	}
+	if name == DEFAULT_FAMILY {
+		return db.defaultFamily, nil
+	}
+	cf := db.findFamily(name)
+	if cf == nil {
+		return nil, fmt.Errorf("%w: %s", ErrNoFamily, name)
+	}
+	return cf, nil
+}
+
+// Vraca nazive svih familija, prva je podrazumevana
+func (db *DB) ColumnFamilies() []string {
+	families := db.familyList()
+	names := make([]string, 0, len(families))
+	for _, cf := range families {
+		names = append(names, cf.name)
+	}
+	return names
+}
+
+// Naziv familije
+func (cf *ColumnFamily) Name() string {
+	return cf.name
+}
+
+// Pravi WAL zapis za upis u ovu familiju
+// Zapisi podrazumevane familije se ne obmotavaju da bi WAL ostao citljiv i starijim verzijama
+func (cf *ColumnFamily) walEntry(key string, data *Data) *Entry {
+	entry := NewEntry(key, data)
+	if cf == cf.db.defaultFamily {
+		return entry
+	}
+	return NewFamilyEntry(cf.name, entry)
+}
+
+// ------------ API FAMILIJE ------------
+// Metode rade isto kao istoimene metode DB-a, ali nad kljucevima ove familije
+
+func (cf *ColumnFamily) Put(key string, value []byte) error {
+	err := cf.db.allow()
+	if err != nil {
+		return err
+	}
+	return cf.db.writeDurably(func() error {
+		return cf.put(key, value, 0)
+	})
+}
+
+func (cf *ColumnFamily) PutWithTTL(key string, value []byte, ttl time.Duration) error {
+	err := cf.db.allow()
+	if err != nil {
+		return err
+	}
+	return cf.db.writeDurably(func() error {
+		return cf.put(key, value, expiryAfter(ttl))
+	})
+}
+
+func (cf *ColumnFamily) Delete(key string) error {
+	err := cf.db.allow()
+	if err != nil {
+		return err
+	}
+	return cf.db.writeDurably(func() error {
+		return cf.delete(key)
+	})
+}
+
+func (cf *ColumnFamily) DeleteRange(startKey string, endKey string) error {
+	err := cf.db.allow()
+	if err != nil {
+		return err
+	}
+	return cf.db.writeDurably(func() error {
+		return cf.deleteRange(startKey, endKey)
+	})
+}
+
+func (cf *ColumnFamily) Merge(key string, operand []byte) error {
+	err := cf.db.allow()
+	if err != nil {
+		return err
+	}
+	return cf.db.writeDurably(func() error {
+		return cf.merge(key, operand)
+	})
+}
+
+func (cf *ColumnFamily) Get(key string) (*Data, error) {
+	err := cf.db.allow()
+	if err != nil {
+		return nil, err
+	}
+	return cf.get(key, LATEST_SEQ)
+}
+
+func (cf *ColumnFamily) RangeScan(minKey string, maxKey string, pageLen uint32, pageNum uint32) ([]string, []*Data, error) {
+	err := cf.db.allow()
+	if err != nil {
+		return nil, nil, err
+	}
+	return cf.rangeScan(minKey, maxKey, pageLen, pageNum, LATEST_SEQ)
+}
+
+func (cf *ColumnFamily) ListScan(prefix string, pageLen uint32, pageNum uint32) ([]string, []*Data, error) {
+	err := cf.db.allow()
+	if err != nil {
+		return nil, nil, err
+	}
+	return cf.listScan(prefix, pageLen, pageNum, LATEST_SEQ)
+}
+
+func (cf *ColumnFamily) NewIterator() (Iterator, error) {
+	err := cf.db.allow()
+	if err != nil {
+		return nil, err
+	}
+	return cf.newIterator(LATEST_SEQ)
+}
+
+// Pokrece kompakciju nad svim nivoima familije
+func (cf *ColumnFamily) Compact() error {
+	if cf.db.closed.Load() {
+		return ErrClosed
+	}
+	return cf.compact()
+}
+
+// Kompaktuje sstabele familije koje preklapaju opseg [minKey, maxKey] do poslednjeg nivoa
+func (cf *ColumnFamily) CompactRange(minKey string, maxKey string) error {
+	if cf.db.closed.Load() {
+		return ErrClosed
+	}
+	return cf.compactRange(minKey, maxKey)
+}
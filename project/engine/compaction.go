@@ -0,0 +1,157 @@
+package engine
+
+import (
+	. "project/keyvalue/errs"
+)
+
+// Kompakcija u pozadini
+// Nakon svakog flush-a i svake zavrsene kompakcije planer racuna ocene nivoa svih familija
+// (vidi compactionPicker.go u lsm paketu) i pokrece kompakciju nivoa sa najvecom ocenom
+// Istovremeno se izvrsava najvise MaxConcurrentCompactions kompakcija, svaka u svojoj gorutini,
+// a kompakcije iste familije samo nad nivoima koji se ne preklapaju
+// Nakon greske se vise ne pokrecu nove kompakcije, a greska se vraca pri zatvaranju baze
+
+// Pokrece gorutinu planera
+// Prva provera nivoa se radi odmah, jer nivoi mogu biti popunjeni od ranije
+func (db *DB) startCompacting() {
+	db.compactionPending = true
+	db.compactionDone = make(chan struct{})
+	go db.compactionLoop()
+}
+
+// Zaustavlja planer i ceka da se zavrse kompakcije koje su u toku
+// Vraca gresku pri kompakciji ukoliko je do nje doslo
+func (db *DB) stopCompacting() error {
+	db.schedulerLock.Lock()
+	db.compactionStop = true
+	db.schedulerCond.Broadcast()
+	db.schedulerLock.Unlock()
+
+	<-db.compactionDone
+	return db.compactionErr
+}
+
+// Obavestava planer da se broj sstabela u nekom nivou promenio
+func (db *DB) scheduleCompaction() {
+	db.updateWriteStall()
+	db.wakeCompaction()
+}
+
+// Budi planer da ponovo izracuna ocene nivoa, npr. kada se oslobodi snapshot
+// zbog kog su fifo brisanje ili prepis tombstone-ova bili odlozeni
+func (db *DB) wakeCompaction() {
+	db.schedulerLock.Lock()
+	db.compactionPending = true
+	db.schedulerCond.Broadcast()
+	db.schedulerLock.Unlock()
+}
+
+func (db *DB) compactionLoop() {
+	defer close(db.compactionDone)
+	db.schedulerLock.Lock()
+	defer db.schedulerLock.Unlock()
+	for true {
+		for !db.compactionStop && db.compactionErr == nil &&
+			(!db.compactionPending || db.compactionsRunning >= db.config.MaxConcurrentCompactions) {
+			db.schedulerCond.Wait()
+		}
+		if db.compactionStop || db.compactionErr != nil {
+			break
+		}
+
+		//Pokrecemo kompakcije dok ima slobodnih mesta i nivoa kojima je potrebna
+		db.compactionPending = false
+		for db.compactionsRunning < db.config.MaxConcurrentCompactions {
+			cf, level := db.pickCompaction()
+			if cf == nil {
+				break
+			}
+			db.compactionsRunning++
+			go db.runCompaction(cf, level)
+		}
+	}
+
+	for db.compactionsRunning > 0 {
+		db.schedulerCond.Wait()
+	}
+}
+
+// Bira familiju i nivo sa najvecom ocenom i zauzima nivo
+// Ukoliko nijednoj familiji nije potrebna kompakcija vraca nil
+func (db *DB) pickCompaction() (*ColumnFamily, uint32) {
+	var best *ColumnFamily
+	bestLevel := uint32(0)
+	bestScore := float64(0)
+	for _, cf := range db.familyList() {
+		level, score := cf.lsm.PickCompaction()
+		if level != 0 && score > bestScore {
+			best = cf
+			bestLevel = level
+			bestScore = score
+		}
+	}
+	//Rucna kompakcija je mogla u medjuvremenu zauzeti nivo, planer se ponovo poziva kada ga ona oslobodi
+	if best == nil || !best.lsm.TryReserveLevel(bestLevel) {
+		return nil, 0
+	}
+	return best, bestLevel
+}
+
+// Kompaktuje zauzeti nivo familije i javlja planeru da je zavrsila
+func (db *DB) runCompaction(cf *ColumnFamily, level uint32) {
+	discarded := cf.lsm.DiscardedTables()
+	err := cf.lsm.CompactLevel(level)
+	cf.lsm.ReleaseLevel(level)
+	if err == nil {
+		err = cf.clearDiscarded(discarded)
+	}
+
+	db.schedulerLock.Lock()
+	db.compactionsRunning--
+	db.compactionPending = true
+	if err != nil && db.compactionErr == nil {
+		db.compactionErr = err
+	}
+	db.schedulerCond.Broadcast()
+	db.schedulerLock.Unlock()
+	db.updateWriteStall()
+}
+
+// Greska pri kompakciji u pozadini, nakon nje se nove kompakcije ne pokrecu
+func (db *DB) compactionError() error {
+	db.schedulerLock.Lock()
+	defer db.schedulerLock.Unlock()
+	return db.compactionErr
+}
+
+// Kompaktuje sve nivoe familije redom
+// Ceka kompakcije u pozadini koje koriste iste nivoe, a nakon zavrsetka obavestava planer
+func (cf *ColumnFamily) compact() error {
+	discarded := cf.lsm.DiscardedTables()
+	err := cf.lsm.RunCompact()
+	if err == nil {
+		err = cf.clearDiscarded(discarded)
+	}
+	cf.db.scheduleCompaction()
+	return err
+}
+
+// Kompaktuje sstabele iz opsega do poslednjeg nivoa
+// Kao i compact ceka kompakcije u pozadini koje koriste iste nivoe, a nakon zavrsetka obavestava planer
+func (cf *ColumnFamily) compactRange(minKey string, maxKey string) error {
+	if minKey > maxKey {
+		return ErrInvalidRange
+	}
+	err := cf.lsm.CompactRange(minKey, maxKey)
+	cf.db.scheduleCompaction()
+	return err
+}
+
+// Fifo kompakcija brise podatke, pa se iz cache-a izbacuju i njihove vrednosti
+// (ne zna se koji su kljucevi obrisani, pa se cache prazni ukoliko je obrisana bar jedna sstabela od datog broja)
+func (cf *ColumnFamily) clearDiscarded(discarded uint64) error {
+	if cf.lsm.DiscardedTables() == discarded {
+		return nil
+	}
+	return cf.lru.Clear()
+}
@@ -0,0 +1,389 @@
+package engine_test
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	. "project/keyvalue/config"
+	. "project/keyvalue/engine"
+	. "project/keyvalue/errs"
+	. "project/keyvalue/structures/merge_operator"
+)
+
+//Stres testovi za istovremeni rad sa bazom, pokrecu se sa go test -race
+//Upisi, citanja, pretrage i iteratori se izvrsavaju paralelno sa flush-om i kompakcijom u pozadini,
+//a nakon toga se baza ponovo otvara i proverava se da su sacuvani svi zavrseni upisi
+
+const (
+	STRESS_WRITERS = 3
+	STRESS_READERS = 4
+	STRESS_KEYS    = 40 //Kljucevi koje menja jedan pisac
+	STRESS_WRITES  = 150
+)
+
+func stressConfig(compaction string, structure string, format string) *Config {
+	config := DefaultConfig()
+	config.MemtableSize = 8
+	config.MemtableStructure = structure
+	config.CompactionType = compaction
+	config.SSTableFileConfig = format
+	config.LeveledCompactionMultiplier = 2
+	config.WalSegmentSize = 4096
+	return config
+}
+
+func openStress(t *testing.T, dir string, config *Config) *DB {
+	db, err := Open(dir, &Options{Config: config, DisableRateLimit: true, MergeOperator: Int64AddOperator{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func writerKey(writer int, key int) string {
+	return fmt.Sprintf("w%d/k%03d", writer, key)
+}
+
+// Proverava da baza sadrzi tacno ocekivane kljuceve pisaca (prazna vrednost znaci da je kljuc obrisan)
+func checkWriterKeys(t *testing.T, db *DB, expected map[string]string) {
+	for key, value := range expected {
+		data, err := db.Get(key)
+		if value == "" {
+			if !errors.Is(err, ErrNotFound) {
+				t.Errorf("%s: ocekivano brisanje, dobijeno %v %v", key, data, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", key, err)
+		} else if string(data.Value) != value {
+			t.Errorf("%s: ocekivano %s, dobijeno %s", key, value, data.Value)
+		}
+	}
+
+	live := make([]string, 0)
+	for key, value := range expected {
+		if value != "" {
+			live = append(live, key)
+		}
+	}
+	sort.Strings(live)
+	keys, _, err := db.ListScan("w", uint32(len(expected)+1), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(keys) != fmt.Sprint(live) {
+		t.Errorf("pretraga vraca %d kljuceva, ocekivano %d", len(keys), len(live))
+	}
+}
+
+// Cita sve stranice pretrage sa tokenom i proverava da su kljucevi rastuci i da se ne ponavljaju
+func scanAllPages(db *DB) error {
+	token := ""
+	prev := ""
+	for true {
+		keys, _, next, err := db.ListScanCursor("w", 7, token)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if key <= prev {
+				return fmt.Errorf("pretraga sa tokenom: %s posle %s", key, prev)
+			}
+			prev = key
+		}
+		if next == "" {
+			return nil
+		}
+		token = next
+	}
+	return nil
+}
+
+// Cita snapshot kroz GET i iterator i proverava da je batch upis vidljiv ceo ili nimalo
+func checkSnapshot(db *DB) error {
+	snapshot, err := db.NewSnapshot()
+	if err != nil {
+		return err
+	}
+	defer snapshot.Release()
+
+	a, errA := snapshot.Get("pair/a")
+	b, errB := snapshot.Get("pair/b")
+	if (errA == nil) != (errB == nil) || (errA == nil && string(a.Value) != string(b.Value)) {
+		return fmt.Errorf("batch je vidljiv delimicno: %v %v", a, b)
+	}
+
+	iterator, err := snapshot.NewIterator()
+	if err != nil {
+		return err
+	}
+	defer iterator.Close()
+	prev := ""
+	pairs := make(map[string]string)
+	for iterator.SeekToFirst(); iterator.Valid(); iterator.Next() {
+		if iterator.Key() <= prev {
+			return fmt.Errorf("iterator: %s posle %s", iterator.Key(), prev)
+		}
+		prev = iterator.Key()
+		if iterator.Key() == "pair/a" || iterator.Key() == "pair/b" {
+			pairs[iterator.Key()] = string(iterator.Value().Value)
+		}
+	}
+	if iterator.Err() != nil {
+		return iterator.Err()
+	}
+	if pairs["pair/a"] != pairs["pair/b"] {
+		return fmt.Errorf("iterator vidi batch delimicno: %v", pairs)
+	}
+	if errA == nil && pairs["pair/a"] != string(a.Value) {
+		return fmt.Errorf("iterator i GET snapshot-a se razlikuju: %s %s", pairs["pair/a"], a.Value)
+	}
+	return nil
+}
+
+func runStress(t *testing.T, config *Config) {
+	dir := t.TempDir()
+	db := openStress(t, dir, config)
+
+	var merges atomic.Int64
+	expected := make([]map[string]string, STRESS_WRITERS)
+	stop := make(chan struct{})
+	var writers sync.WaitGroup
+	var readers sync.WaitGroup
+
+	//Pisci, svaki menja svoje kljuceve pa se poslednja vrednost svakog kljuca zna
+	for w := 0; w < STRESS_WRITERS; w++ {
+		expected[w] = make(map[string]string)
+		writers.Add(1)
+		go func(w int) {
+			defer writers.Done()
+			random := rand.New(rand.NewSource(int64(w)))
+			for i := 0; i < STRESS_WRITES; i++ {
+				key := writerKey(w, random.Intn(STRESS_KEYS))
+				var err error
+				if i%10 == 9 {
+					err = db.Delete(key)
+					expected[w][key] = ""
+				} else {
+					value := fmt.Sprintf("v%d", i)
+					err = db.Put(key, []byte(value))
+					expected[w][key] = value
+				}
+				if err != nil {
+					t.Error(err)
+					return
+				}
+
+				err = db.Merge("counter", Int64ToBytes(1))
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				merges.Add(1)
+
+				batch := NewWriteBatch()
+				value := []byte(fmt.Sprintf("%d-%d", w, i))
+				batch.Put("pair/a", value)
+				batch.Put("pair/b", value)
+				err = db.Write(batch)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(w)
+	}
+
+	//Kompakcije koje se pokrecu rucno, pored onih nakon flush-a
+	writers.Add(1)
+	go func() {
+		defer writers.Done()
+		for i := 0; i < 10; i++ {
+			var err error
+			if i%2 == 0 {
+				err = db.Compact()
+			} else {
+				err = db.CompactRange("w1", "w2")
+			}
+			if err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+
+	//Citaoci rade dok pisci ne zavrse
+	for r := 0; r < STRESS_READERS; r++ {
+		readers.Add(1)
+		go func(r int) {
+			defer readers.Done()
+			random := rand.New(rand.NewSource(int64(100 + r)))
+			for true {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				_, err := db.Get(writerKey(random.Intn(STRESS_WRITERS), random.Intn(STRESS_KEYS)))
+				if err != nil && !errors.Is(err, ErrNotFound) {
+					t.Error(err)
+					return
+				}
+				err = checkSnapshot(db)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				_, _, err = db.ListScan("w", 10, 1)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				_, _, err = db.RangeScan("w0", "w9", 10, 2)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				err = scanAllPages(db)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				counter, err := db.Get("counter")
+				if err == nil {
+					count, _ := BytesToInt64(counter.Value)
+					if count > merges.Load()+STRESS_WRITERS {
+						t.Errorf("brojac %d je veci od broja spajanja %d", count, merges.Load())
+						return
+					}
+				} else if !errors.Is(err, ErrNotFound) {
+					t.Error(err)
+					return
+				}
+			}
+		}(r)
+	}
+
+	writers.Wait()
+	close(stop)
+	readers.Wait()
+	if t.Failed() {
+		db.Close()
+		return
+	}
+
+	all := make(map[string]string)
+	for _, writerKeys := range expected {
+		for key, value := range writerKeys {
+			all[key] = value
+		}
+	}
+	checkWriterKeys(t, db, all)
+	err := db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//Ponovno otvaranje vraca sve zavrsene upise (iz sstabela i WAL-a)
+	db = openStress(t, dir, config)
+	defer db.Close()
+	checkWriterKeys(t, db, all)
+	counter, err := db.Get("counter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	count, _ := BytesToInt64(counter.Value)
+	if count != merges.Load() {
+		t.Errorf("brojac nakon ponovnog otvaranja je %d, ocekivano %d", count, merges.Load())
+	}
+	err = checkSnapshot(db)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestConcurrentReadWrite(t *testing.T) {
+	cases := []struct {
+		compaction string
+		structure  string
+		format     string
+	}{
+		{"size_tiered", "skiplist", "single"},
+		{"size_tiered", "b_tree", "multi"},
+		{"leveled", "skiplist", "multi"},
+		{"leveled", "b_tree", "single"},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.compaction+"/"+c.structure+"/"+c.format, func(t *testing.T) {
+			runStress(t, stressConfig(c.compaction, c.structure, c.format))
+		})
+	}
+}
+
+// Compare-and-swap iz vise gorutina: svaki uspesan CAS povecava vrednost tacno jednom
+func TestConcurrentCompareAndSwap(t *testing.T) {
+	config := stressConfig("size_tiered", "skiplist", "single")
+	dir := t.TempDir()
+	db := openStress(t, dir, config)
+
+	var succeeded atomic.Int64
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				var version uint64
+				var count int64
+				data, err := db.Get("cas")
+				if err == nil {
+					version = data.Seq
+					count, _ = BytesToInt64(data.Value)
+				} else if !errors.Is(err, ErrNotFound) {
+					t.Error(err)
+					return
+				}
+				err = db.CompareAndSwap("cas", version, Int64ToBytes(count+1))
+				if err == nil {
+					succeeded.Add(1)
+				} else if !errors.Is(err, ErrConflict) {
+					t.Error(err)
+					return
+				}
+				//Ostali upisi pune memtabelu da bi se CAS izvrsavao i nad flush-ovanim verzijama
+				err = db.Put(fmt.Sprintf("filler%03d", i), []byte("x"))
+				if err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, reopen := range []bool{false, true} {
+		if reopen {
+			err := db.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			db = openStress(t, dir, config)
+		}
+		data, err := db.Get("cas")
+		if err != nil {
+			t.Fatal(err)
+		}
+		count, _ := BytesToInt64(data.Value)
+		if count != succeeded.Load() {
+			t.Errorf("vrednost je %d, uspesnih CAS-ova %d (ponovo otvorena: %v)", count, succeeded.Load(), reopen)
+		}
+	}
+	db.Close()
+}
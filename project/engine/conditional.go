@@ -0,0 +1,71 @@
+package engine
+
+import (
+	"errors"
+	. "project/keyvalue/errs"
+)
+
+// Uslovni upisi
+// Verzija kljuca je redni broj upisa njegove najnovije vrednosti (Data.Seq iz GET-a),
+// a kljuc koji ne postoji, obrisan je ili mu je isteklo vreme ima verziju 0
+// Ukoliko uslov nije ispunjen upis se ne vrsi i vraca se greska koja je ErrConflict
+
+// Vraca trenutnu verziju kljuca proveravajuci memtabelu, cache i sve sstabele
+// Poziva se pod writeLock-om, pa vidi i upise koji jos cekaju da budu sacuvani u WAL-u
+func (cf *ColumnFamily) currentVersion(key string) (uint64, error) {
+	data, err := cf.get(key, cf.db.seq)
+	if errors.Is(err, ErrNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return data.Seq, nil
+}
+
+// Upisuje novu vrednost samo ukoliko kljuc i dalje ima ocekivanu verziju
+// (tj. niko ga nije izmenio od kada je procitan)
+func (db *DB) CompareAndSwap(key string, expectedVersion uint64, newValue []byte) error {
+	return db.defaultFamily.CompareAndSwap(key, expectedVersion, newValue)
+}
+
+func (cf *ColumnFamily) CompareAndSwap(key string, expectedVersion uint64, newValue []byte) error {
+	err := cf.db.allow()
+	if err != nil {
+		return err
+	}
+	//Provera i upis se izvrsavaju pod istim lock-om da niko ne bi upisao izmedju njih
+	return cf.db.writeDurably(func() error {
+		version, err := cf.currentVersion(key)
+		if err != nil {
+			return err
+		}
+		if version != expectedVersion {
+			return NewConflictError(key, expectedVersion, version)
+		}
+		return cf.put(key, newValue, 0)
+	})
+}
+
+// Upisuje vrednost samo ukoliko kljuc ne postoji
+func (db *DB) PutIfAbsent(key string, value []byte) error {
+	return db.defaultFamily.PutIfAbsent(key, value)
+}
+
+func (cf *ColumnFamily) PutIfAbsent(key string, value []byte) error {
+	err := cf.db.allow()
+	if err != nil {
+		return err
+	}
+	//Provera i upis se izvrsavaju pod istim lock-om da niko ne bi upisao izmedju njih
+	return cf.db.writeDurably(func() error {
+		version, err := cf.currentVersion(key)
+		if err != nil {
+			return err
+		}
+		if version != 0 {
+			return NewConflictError(key, 0, version)
+		}
+		return cf.put(key, value, 0)
+	})
+}
@@ -0,0 +1,253 @@
+package engine
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	. "project/keyvalue/errs"
+	. "project/keyvalue/structures/dataType"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Pretraga stranicu po stranicu uz pomoc tokena
+// Token cuva poslednji vraceni kljuc i redni broj upisa do kog pretraga vidi podatke,
+// pa se naredna stranica nastavlja odmah iza tog kljuca bez ponovnog prolaska kroz prethodne
+// i vidi isto stanje baze kao i prva stranica (kasniji upisi ne pomeraju stranice)
+// Dok pretraga traje njen redni broj se drzi kao snapshot, pa flush i kompakcija cuvaju verzije koje ona vidi
+// Snapshot se oslobadja kada se vrati poslednja stranica, pozivom ReleaseCursor
+// ili kada token nije iskoriscen CURSOR_TIMEOUT, nakon toga token vraca ErrTokenExpired
+// Token je vezan za familiju i granice pretrage u kojoj je nastao, nastavak druge pretrage
+// (ili iste pretrage nad drugim snapshot-om) vraca ErrInvalidToken
+// Tokeni ne vaze nakon ponovnog otvaranja baze
+
+/*
+   +---------+----------+-----...-----+
+   | ID (8B) | Seq (8B) | LastKey     |
+   +---------+----------+-----...-----+
+   Token se vraca kao base64 (URL) string
+*/
+
+const (
+	TOKEN_ID_SIZE  = 8
+	TOKEN_SEQ_SIZE = 8
+	CURSOR_TIMEOUT = 5 * time.Minute
+)
+
+type scanToken struct {
+	id      uint64 //Pretraga kojoj token pripada
+	seq     uint64 //Redni broj upisa do kog pretraga vidi podatke
+	lastKey string //Poslednji kljuc vracen u prethodnoj stranici
+}
+
+// Snapshot koji drzi pretraga sa tokenom
+type cursorPin struct {
+	seq     uint64
+	scope   string //Familija i granice pretrage kojoj token pripada
+	expires time.Time
+}
+
+// Opis pretrage za koju vazi token, duzine delova sprecavaju da se razlicite granice poklope
+func cursorScope(family string, kind string, bounds ...string) string {
+	scope := kind + " " + strconv.Itoa(len(family)) + ":" + family
+	for _, bound := range bounds {
+		scope += " " + strconv.Itoa(len(bound)) + ":" + bound
+	}
+	return scope
+}
+
+func encodeToken(token *scanToken) string {
+	bytes := make([]byte, TOKEN_ID_SIZE+TOKEN_SEQ_SIZE, TOKEN_ID_SIZE+TOKEN_SEQ_SIZE+len(token.lastKey))
+	binary.BigEndian.PutUint64(bytes, token.id)
+	binary.BigEndian.PutUint64(bytes[TOKEN_ID_SIZE:], token.seq)
+	bytes = append(bytes, token.lastKey...)
+	return base64.RawURLEncoding.EncodeToString(bytes)
+}
+
+// Proverava i raspakuje token
+// Pretraga tokena mora jos drzati svoj snapshot (inace ErrTokenExpired), a koriscenje tokena produzava njegov rok
+// Prazan scope prihvata token bilo koje pretrage
+func (db *DB) decodeToken(encoded string, scope string) (*scanToken, error) {
+	bytes, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || len(bytes) < TOKEN_ID_SIZE+TOKEN_SEQ_SIZE {
+		return nil, ErrInvalidToken
+	}
+	token := new(scanToken)
+	token.id = binary.BigEndian.Uint64(bytes[:TOKEN_ID_SIZE])
+	token.seq = binary.BigEndian.Uint64(bytes[TOKEN_ID_SIZE : TOKEN_ID_SIZE+TOKEN_SEQ_SIZE])
+	token.lastKey = string(bytes[TOKEN_ID_SIZE+TOKEN_SEQ_SIZE:])
+
+	db.cursorsLock.Lock()
+	defer db.cursorsLock.Unlock()
+	pin, ok := db.cursors[token.id]
+	if !ok {
+		return nil, ErrTokenExpired
+	}
+	if pin.seq != token.seq || (scope != "" && pin.scope != scope) {
+		return nil, ErrInvalidToken
+	}
+	pin.expires = time.Now().Add(CURSOR_TIMEOUT)
+	return token, nil
+}
+
+// Zapocinje pretragu sa tokenom i drzi snapshot na rednom broju do kog ona vidi podatke
+// LATEST_SEQ se zamenjuje poslednjim vidljivim upisom kao kod NewSnapshot
+// (dati redni broj vec drzi snapshot nad kojim se pretrazuje)
+func (db *DB) pinCursor(seq uint64, scope string) (uint64, uint64, error) {
+	if seq == LATEST_SEQ {
+		err := db.usable()
+		if err != nil {
+			return 0, 0, err
+		}
+		seq = db.acquireVisible()
+	} else {
+		db.snapshots.Acquire(seq)
+	}
+
+	db.cursorsLock.Lock()
+	defer db.cursorsLock.Unlock()
+	db.nextCursor++
+	db.cursors[db.nextCursor] = &cursorPin{seq: seq, scope: scope, expires: time.Now().Add(CURSOR_TIMEOUT)}
+	return db.nextCursor, seq, nil
+}
+
+// Oslobadja snapshot pretrage
+func (db *DB) unpinCursor(id uint64) {
+	db.cursorsLock.Lock()
+	defer db.cursorsLock.Unlock()
+	pin, ok := db.cursors[id]
+	if !ok {
+		return
+	}
+	delete(db.cursors, id)
+	db.releaseSnapshot(pin.seq)
+}
+
+// Oslobadja snapshot-ove pretraga ciji tokeni nisu iskorisceni u roku
+func (db *DB) expireCursors() {
+	now := time.Now()
+	db.cursorsLock.Lock()
+	defer db.cursorsLock.Unlock()
+	for id, pin := range db.cursors {
+		if now.After(pin.expires) {
+			delete(db.cursors, id)
+			db.releaseSnapshot(pin.seq)
+		}
+	}
+}
+
+// Zavrsava pretragu pre poslednje stranice i oslobadja verzije koje je ona cuvala
+// Token nakon toga vraca ErrTokenExpired
+func (db *DB) ReleaseCursor(token string) error {
+	decoded, err := db.decodeToken(token, "")
+	if err != nil {
+		return err
+	}
+	db.unpinCursor(decoded.id)
+	return nil
+}
+
+// Vraca najvise pageLen kljuceva iz opsega [minKey, maxKey] i token za narednu stranicu
+// Prva stranica se trazi sa praznim tokenom, a prazan vraceni token znaci da je pretraga gotova
+func (db *DB) RangeScanCursor(minKey string, maxKey string, pageLen uint32, token string) ([]string, []*Data, string, error) {
+	return db.defaultFamily.RangeScanCursor(minKey, maxKey, pageLen, token)
+}
+
+// Vraca najvise pageLen kljuceva koji pocinju datim prefiksom i token za narednu stranicu
+// Prva stranica se trazi sa praznim tokenom, a prazan vraceni token znaci da je pretraga gotova
+func (db *DB) ListScanCursor(prefix string, pageLen uint32, token string) ([]string, []*Data, string, error) {
+	return db.defaultFamily.ListScanCursor(prefix, pageLen, token)
+}
+
+// RangeScanCursor nad kljucevima familije
+// Token je vezan za familiju u kojoj je pretraga zapoceta
+func (cf *ColumnFamily) RangeScanCursor(minKey string, maxKey string, pageLen uint32, token string) ([]string, []*Data, string, error) {
+	err := cf.db.allow()
+	if err != nil {
+		return nil, nil, "", err
+	}
+	scope := cursorScope(cf.name, "range", minKey, maxKey)
+	return cf.scanCursor(minKey, func(key string) bool { return key <= maxKey }, pageLen, token, LATEST_SEQ, scope)
+}
+
+// ListScanCursor nad kljucevima familije
+func (cf *ColumnFamily) ListScanCursor(prefix string, pageLen uint32, token string) ([]string, []*Data, string, error) {
+	err := cf.db.allow()
+	if err != nil {
+		return nil, nil, "", err
+	}
+	scope := cursorScope(cf.name, "list", prefix)
+	return cf.scanCursor(prefix, func(key string) bool { return strings.HasPrefix(key, prefix) }, pageLen, token, LATEST_SEQ, scope)
+}
+
+// RangeScanCursor nad podacima iz trenutka kreiranja snapshot-a
+func (snapshot *Snapshot) RangeScanCursor(minKey string, maxKey string, pageLen uint32, token string) ([]string, []*Data, string, error) {
+	err := snapshot.allow()
+	if err != nil {
+		return nil, nil, "", err
+	}
+	family := snapshot.db.defaultFamily
+	scope := cursorScope(family.name, "range", minKey, maxKey)
+	return family.scanCursor(minKey, func(key string) bool { return key <= maxKey }, pageLen, token, snapshot.seq, scope)
+}
+
+// ListScanCursor nad podacima iz trenutka kreiranja snapshot-a
+func (snapshot *Snapshot) ListScanCursor(prefix string, pageLen uint32, token string) ([]string, []*Data, string, error) {
+	err := snapshot.allow()
+	if err != nil {
+		return nil, nil, "", err
+	}
+	family := snapshot.db.defaultFamily
+	scope := cursorScope(family.name, "list", prefix)
+	return family.scanCursor(prefix, func(key string) bool { return strings.HasPrefix(key, prefix) }, pageLen, token, snapshot.seq, scope)
+}
+
+// Nastavlja pretragu od tokena ili je zapocinje od start ukoliko je token prazan
+// Nova pretraga vidi upise do seq (LATEST_SEQ znaci do poslednjeg upisa u trenutku poziva)
+// Token mora pripadati pretrazi opisanoj sa scope, a pretraga snapshot-a i njegovom rednom broju
+func (cf *ColumnFamily) scanCursor(start string, inRange func(key string) bool, pageLen uint32, encoded string, seq uint64, scope string) ([]string, []*Data, string, error) {
+	cf.db.expireCursors()
+	var id uint64
+	if encoded != "" {
+		token, err := cf.db.decodeToken(encoded, scope)
+		if err != nil {
+			return nil, nil, "", err
+		}
+		if seq != LATEST_SEQ && token.seq != seq {
+			return nil, nil, "", ErrInvalidToken
+		}
+		id, seq = token.id, token.seq
+		//Najmanji string koji je veci od poslednjeg kljuca, pa se on sam preskace
+		if token.lastKey+"\x00" > start {
+			start = token.lastKey + "\x00"
+		}
+	} else {
+		var err error
+		id, seq, err = cf.db.pinCursor(seq, scope)
+		if err != nil {
+			return nil, nil, "", err
+		}
+	}
+	if pageLen == 0 {
+		cf.db.unpinCursor(id)
+		return make([]string, 0), make([]*Data, 0), "", nil
+	}
+
+	keys, values, more, err := cf.scanFrom(start, inRange, 0, pageLen, seq)
+	if err != nil {
+		//Pretraga sa tokenom se moze ponoviti, a za prvu stranicu pozivalac nema token
+		if encoded == "" {
+			cf.db.unpinCursor(id)
+		}
+		return nil, nil, "", err
+	}
+	if !more {
+		cf.db.unpinCursor(id)
+		return keys, values, "", nil
+	}
+	next := new(scanToken)
+	next.id = id
+	next.seq = seq
+	next.lastKey = keys[len(keys)-1]
+	return keys, values, encodeToken(next), nil
+}
@@ -0,0 +1,742 @@
+package engine
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	. "project/keyvalue/config"
+	. "project/keyvalue/errs"
+	. "project/keyvalue/structures/dataType"
+	. "project/keyvalue/structures/memtable"
+	. "project/keyvalue/structures/merge_operator"
+	. "project/keyvalue/structures/snapshot"
+	. "project/keyvalue/structures/token_bucket"
+	. "project/keyvalue/structures/wal"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Baza podataka kao jedna celina
+// Poseduje WAL, familije kolona (svaka sa svojom memtabelom, LSM stablom i cache-om) i token bucket
+// i kroz svoje metode predstavlja javni API za ugradnju u druge programe
+// Metode se mogu pozivati iz vise gorutina istovremeno:
+// citanja (GET, pretrage, iteratori) se izvrsavaju paralelno, a upisi jedan po jedan kroz writeLock
+// Flush i kompakcija se izvrsavaju u pozadini i ne blokiraju citaoce
+type DB struct {
+	directory     string
+	options       *Options
+	config        *Config
+	wal           *WriteAheadLog
+	families      []*ColumnFamily //Sve otvorene familije, prva je podrazumevana
+	familiesLock  sync.RWMutex
+	defaultFamily *ColumnFamily //Familija kojoj pripadaju kljucevi upisani direktno kroz DB
+	bucket        *TokenBucket
+	snapshots     *SnapshotList //Snapshot-ovi koji su trenutno u upotrebi
+	closed        atomic.Bool
+	writeLock     sync.Mutex    //Serijalizuje upise, pod njim se koriste WAL i seq
+	seq           uint64        //Redni broj poslednjeg upisa
+	assignedSeq   atomic.Uint64 //Isto sto i seq, za citaoce koji ne drze writeLock
+	publishLock   sync.Mutex    //Serijalizuje objavljivanje upisa i belezenje snapshot-ova
+	visibleSeq    atomic.Uint64 //Redni broj poslednjeg sacuvanog upisa koji citaoci vide (ceo batch postaje vidljiv odjednom)
+
+	//Greska WAL-a nakon koje baza odbija sve zahteve (vidi writeDurably)
+	failLock sync.Mutex
+	failed   atomic.Bool
+	failErr  error
+
+	//Pretrage sa tokenom (cursor.go)
+	cursorsLock sync.Mutex
+	cursors     map[uint64]*cursorPin //Redni brojevi koje drze tokeni pretraga koje nisu zavrsene
+	nextCursor  uint64
+
+	//Flush u pozadini (flush.go)
+	flushLock  sync.Mutex
+	flushCond  *sync.Cond  //Signalizira promenu reda za flush
+	flushQueue []*flushJob //Grupe nepromenljivih memtabela koje cekaju flush, od najstarije
+	flushErr   error       //Greska pri flush-u, nakon nje upisi koji cekaju flush je vracaju
+	flushStop  bool
+	flushDone  chan struct{}
+
+	//Kompakcija u pozadini (compaction.go)
+	schedulerLock      sync.Mutex
+	schedulerCond      *sync.Cond //Signalizira promenu nivoa ili zavrsetak kompakcije
+	compactionPending  bool       //Nivoi su se promenili od poslednjeg izbora kompakcije
+	compactionsRunning uint
+	compactionErr      error
+	compactionStop     bool
+	compactionDone     chan struct{}
+
+	//Usporavanje i zaustavljanje upisa (stall.go)
+	stallLock              sync.Mutex
+	stallUpdateLock        sync.Mutex
+	stallCond              *sync.Cond //Signalizira promenu stanja upisa
+	stall                  WriteStall
+	writeDelay             time.Duration //Cekanje svakog upisa dok su upisi usporeni
+	stallStart             time.Time     //Pocetak trenutnog usporavanja ili zaustavljanja
+	stallDuration          time.Duration //Ukupno vreme koje su zavrseni upisi cekali
+	waitingWrites          int           //Broj upisa koji trenutno cekaju
+	waitingSince           time.Duration //Zbir pocetaka cekanja (od stallEpoch) upisa koji trenutno cekaju
+	stallErr               error         //Greska poslednje procene bajtova koji cekaju kompakciju
+	delayedWrites          uint64
+	stoppedWrites          uint64
+	level1Tables           uint32
+	pendingCompactionBytes uint64
+}
+
+// Opcije pri otvaranju baze
+type Options struct {
+	Config           *Config                         //Konfiguracija baze, ukoliko je zadata ConfigPath se ignorise
+	ConfigPath       string                          //Putanja do config.yml, ukoliko je prazna koriste se default vrednosti
+	DisableRateLimit bool                            //Ukoliko je true token bucket ne ogranicava zahteve
+	MergeOperator    MergeOperator                   //Spaja operande upisane sa Merge, bez njega Merge vraca ErrNoMergeOperator
+	ColumnFamilies   map[string]*ColumnFamilyOptions //Opcije familija kolona, familije koje ne postoje se kreiraju
+}
+
+// Vraca konfiguraciju zadatu kroz opcije
+func (opts *Options) loadConfig() (*Config, error) {
+	if opts.Config != nil {
+		return opts.Config, nil
+	}
+	if opts.ConfigPath != "" {
+		return LoadConfig(opts.ConfigPath)
+	}
+	return DefaultConfig(), nil
+}
+
+// Otvara bazu u zadatom direktorijumu
+// Ukoliko direktorijum ne postoji kreira se prazna baza
+// Sve putanje se racunaju u odnosu na dir, tako da vise baza
+// moze biti otvoreno u istom procesu
+// Struktura direktorijuma:
+// dir/wal             -> segmenti WAL-a (zajednicki za sve familije)
+// dir/sstable         -> lsm.bin i nivoi sa sstabelama podrazumevane familije
+// dir/cache           -> cache.bin podrazumevane familije
+// dir/column_families -> ostale familije kolona
+func Open(dir string, opts *Options) (*DB, error) {
+	if opts == nil {
+		opts = new(Options)
+	}
+
+	err := os.MkdirAll(dir, os.ModePerm)
+	if err != nil {
+		return nil, NewIOError(err)
+	}
+
+	db := new(DB)
+	db.directory = dir
+	db.options = opts
+	db.flushCond = sync.NewCond(&db.flushLock)
+	db.schedulerCond = sync.NewCond(&db.schedulerLock)
+	db.stallCond = sync.NewCond(&db.stallLock)
+	db.config, err = opts.loadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	//inicijalizujemo strukturu fajlova
+	db.snapshots = NewSnapshotList()
+	db.cursors = make(map[uint64]*cursorPin)
+	db.defaultFamily, err = db.openFamily(DEFAULT_FAMILY, dir, db.config, opts.MergeOperator)
+	if err != nil {
+		return nil, err
+	}
+	db.families = []*ColumnFamily{db.defaultFamily}
+	err = db.openFamilies()
+	if err != nil {
+		return nil, err
+	}
+
+	//Na pocetku ucitavamo iz WAL-a u memtabele
+	db.wal, err = NewWriteAheadLog(filepath.Join(dir, "wal"), db.config)
+	if err != nil {
+		return nil, err
+	}
+	db.updateWriteStall()
+	db.startCompacting()
+	db.startFlushing()
+	err = db.recover()
+	if err != nil {
+		db.stopFlushing()
+		db.stopCompacting()
+		db.wal.Close()
+		return nil, err
+	}
+
+	//Ogranicenje brzine pristupa
+	db.bucket = NewTokenBucket(db.config)
+
+	return db, nil
+}
+
+// Vraca zapise iz WAL-a u memtabele familija kojima pripadaju
+// Zapisi koji su vec flush-ovani u sstabele svoje familije se preskacu
+// Segmenti pre prvog segmenta sa zapisom koji nije flush-ovan su pokriveni sstabelama pa se odmah brisu,
+// a ostali se cuvaju dok se memtabele u koje su ucitani ne flush-uju
+func (db *DB) recover() error {
+	records, err := db.wal.InitiateMemTable()
+	if err != nil {
+		return err
+	}
+
+	//Redni broj upisa nastavlja od najveceg sacuvanog
+	//(iz flush-ovanih sstabela ili iz zapisa u WAL-u koji jos nisu flush-ovani)
+	for _, cf := range db.families {
+		if cf.lsm.LastSeq > db.seq {
+			db.seq = cf.lsm.LastSeq
+		}
+	}
+	covered := db.wal.ActiveSegment() //Prvi segment sa zapisom koji nije flush-ovan
+	uncovered := false
+	for _, record := range records {
+		cf := db.defaultFamily
+		if record.Family != "" {
+			cf = db.findFamily(record.Family)
+			if cf == nil {
+				return NewCorruptionError("WAL sadrzi zapis nepostojece familije %s", record.Family)
+			}
+		}
+		if record.Data.Seq > db.seq {
+			db.seq = record.Data.Seq
+		}
+		if record.Data.Seq <= cf.lsm.LastSeq {
+			continue
+		}
+		if !uncovered {
+			covered = record.Segment
+			uncovered = true
+		}
+		cf.memtable.Put(record.Key, record.Data)
+	}
+	err = db.wal.ReleaseSegments(covered)
+	if err != nil {
+		return err
+	}
+	db.assignedSeq.Store(db.seq)
+	db.publish(db.seq)
+	return db.flushIfFull()
+}
+
+// Zauzima putanju za upis, nakon uspesnog poziva pozivalac je duzan da otpusti writeLock
+// Vraca ErrClosed ukoliko je baza zatvorena dok se cekalo na lock, odnosno gresku WAL-a ukoliko je do nje doslo
+func (db *DB) lockWrites() error {
+	db.writeLock.Lock()
+	err := db.usable()
+	if err != nil {
+		db.writeLock.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Zauzima putanju za upis kao lockWrites, a ukoliko kompakcija kasni upis se prvo usporava (vidi stall.go)
+// Usporavanje se ceka pre zauzimanja writeLock-a, pa upis koji ceka ne zadrzava snapshot-ove, tokene pretraga
+// niti upise koji su vec prosli cekanje
+func (db *DB) startWrite() error {
+	err := db.stallWrite()
+	if err != nil {
+		return err
+	}
+	return db.lockWrites()
+}
+
+// Izvrsava upis pod writeLock-om, pa nakon otpustanja lock-a ceka da zapisi koje je dodao u WAL
+// budu sacuvani prema wal_sync_mode, tako da upisi koji cekaju istovremeno dele isti upis i sync segmenta
+// Upis postaje vidljiv citaocima tek kada su njegovi zapisi sacuvani, zajedno sa svim ranijim upisima
+// Ukoliko WAL ne uspe da sacuva zapise baza vise ne prihvata ni citanja ni upise (vraca gresku WAL-a),
+// pa se upis koji je vratio gresku ne moze procitati, a flush ga ne upisuje u sstabele (vidi runFlush)
+func (db *DB) writeDurably(write func() error) error {
+	err := db.startWrite()
+	if err != nil {
+		return err
+	}
+	before := db.wal.Appended()
+	err = write()
+	after := db.wal.Appended()
+	seq := db.seq
+	db.writeLock.Unlock()
+	if err != nil {
+		return err
+	}
+	if after == before {
+		return nil
+	}
+	err = db.wal.Wait(after)
+	if err != nil {
+		db.fail(err)
+		return err
+	}
+	//Zapisi ranijih upisa su dodati u WAL pre ovih, pa su i oni sacuvani
+	db.publish(seq)
+	return nil
+}
+
+// Prevodi bazu u stanje greske, pamti se prva greska
+func (db *DB) fail(err error) {
+	db.failLock.Lock()
+	defer db.failLock.Unlock()
+	if db.failErr == nil {
+		db.failErr = err
+		db.failed.Store(true)
+	}
+}
+
+// Vraca ErrClosed ukoliko je baza zatvorena, odnosno gresku WAL-a ukoliko je do nje doslo
+func (db *DB) usable() error {
+	if db.closed.Load() {
+		return ErrClosed
+	}
+	return db.failure()
+}
+
+// Greska WAL-a nakon koje baza odbija zahteve, nil ukoliko do nje nije doslo
+func (db *DB) failure() error {
+	if !db.failed.Load() {
+		return nil
+	}
+	db.failLock.Lock()
+	defer db.failLock.Unlock()
+	return db.failErr
+}
+
+// Cini sve upise do datog rednog broja vidljivim citaocima
+// Poziva se tek kada su svi zapisi tih upisa u memtabelama i sacuvani u WAL-u
+// Upisi koji cekaju WAL mogu zavrsiti van redosleda, pa se vidljivi redni broj samo povecava
+func (db *DB) publish(seq uint64) {
+	db.publishLock.Lock()
+	defer db.publishLock.Unlock()
+	if seq > db.visibleSeq.Load() {
+		db.snapshots.SetVisible(seq)
+		db.visibleSeq.Store(seq)
+	}
+}
+
+// Ubacuje nove verzije u memtabele familija pod publishLock-om
+// Memtabela pri ubacivanju skracuje lanac verzija kljuca, pa mora videti poslednji objavljeni upis
+// da ne bi izbacila verziju koju citaoci vide dok nova ceka WAL
+func (db *DB) insert(families []*ColumnFamily, keys []string, data []*Data) {
+	db.publishLock.Lock()
+	defer db.publishLock.Unlock()
+	for i := range keys {
+		families[i].memtable.Put(keys[i], data[i])
+	}
+}
+
+// Belezi snapshot na poslednjem vidljivom upisu i vraca njegov redni broj
+// Pod publishLock-om, pa se upis ne moze objaviti (ni flush-ovati i kompaktovati) pre nego sto je snapshot zabelezen
+func (db *DB) acquireVisible() uint64 {
+	db.publishLock.Lock()
+	defer db.publishLock.Unlock()
+	seq := db.visibleSeq.Load()
+	db.snapshots.Acquire(seq)
+	return seq
+}
+
+// Da li postoje upisi koji su u memtabelama, a jos nisu objavljeni
+func (db *DB) unpublished() bool {
+	return db.assignedSeq.Load() != db.visibleSeq.Load()
+}
+
+// Redni broj do kog citanje vidi upise, LATEST_SEQ se zamenjuje poslednjim vidljivim upisom
+func (db *DB) readSeq(seq uint64) uint64 {
+	if seq == LATEST_SEQ {
+		return db.visibleSeq.Load()
+	}
+	return seq
+}
+
+// Zatvara bazu, nakon poziva sve operacije vracaju ErrClosed
+// Ceka da se zavrse upis koji je u toku, flush nepromenljivih memtabela i kompakcije u pozadini
+// i upisuje u WAL zapise koji cekaju grupni upis
+// Aktivne memtabele se ne flushuju jer su vec sacuvane u WAL-u
+func (db *DB) Close() error {
+	if !db.closed.CompareAndSwap(false, true) {
+		return nil
+	}
+	db.wakeStalledWrites()
+	db.writeLock.Lock()
+	defer db.writeLock.Unlock()
+	err := db.stopFlushing()
+	compactionErr := db.stopCompacting()
+	if err != nil {
+		return err
+	}
+	if compactionErr != nil {
+		return compactionErr
+	}
+	//Upisi koji jos cekaju WAL se cuvaju pre zatvaranja segmenta
+	err = db.wal.Close()
+	if err != nil {
+		return err
+	}
+	for _, cf := range db.familyList() {
+		err := cf.lru.Write()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Proverava da li zahtev sme da se izvrsi
+func (db *DB) allow() error {
+	if db.closed.Load() {
+		return ErrClosed
+	}
+	err := db.failure()
+	if err != nil {
+		return err
+	}
+	if db.options.DisableRateLimit {
+		return nil
+	}
+	if !db.bucket.Take() {
+		return ErrRateLimited
+	}
+	return nil
+}
+
+// ------------ WRITEPATH ------------
+// Upisuje podatak u bazu
+func (db *DB) Put(key string, value []byte) error {
+	return db.defaultFamily.Put(key, value)
+}
+
+// Upisuje podatak koji istice nakon zadatog vremena
+// Nakon isteka GET i pretrage ga ne vide, a kompakcija ga fizicki brise
+// Ukoliko ttl nije pozitivan podatak je istekao odmah pri upisu
+func (db *DB) PutWithTTL(key string, value []byte, ttl time.Duration) error {
+	return db.defaultFamily.PutWithTTL(key, value, ttl)
+}
+
+// Vraca vreme isteka za dati ttl
+func expiryAfter(ttl time.Duration) uint64 {
+	if ttl <= 0 {
+		return 1 //Najranije moguce vreme isteka (0 znaci da ne istice)
+	}
+	return uint64(time.Now().Add(ttl).UnixNano())
+}
+
+func (cf *ColumnFamily) put(key string, value []byte, expiry uint64) error {
+	//PRAVIMO DATA ZA UPIS
+	data := new(Data)
+	data.Value = value
+	data.Timestamp = uint64(time.Now().Unix()) //upisuje se trenutno vreme
+	data.Seq = cf.db.nextSeq()
+	data.Expiry = expiry
+	data.Tombstone = false
+	return cf.apply(key, data)
+}
+
+// Logicko brisanje
+func (db *DB) Delete(key string) error {
+	return db.defaultFamily.Delete(key)
+}
+
+func (cf *ColumnFamily) delete(key string) error {
+	//UPISUJEMO U WAL kao obrisan
+	data := new(Data)
+	data.Timestamp = uint64(time.Now().Unix())
+	data.Seq = cf.db.nextSeq()
+	data.Tombstone = true
+	data.Value = make([]byte, 0) //Posto je obrisan necemo cuvati vrednost
+
+	//Brisanje se u memtabelu upisuje kao nova verzija kljuca
+	//(postojeci podatak se ne menja jer ga je neko vec mogao procitati)
+	return cf.apply(key, data)
+}
+
+// Brise sve kljuceve k za koje je startKey <= k < endKey
+// Upisuje se jedan zapis brisanja opsega (bez obzira na broj kljuceva), a obrisani kljucevi se fizicki izbacuju tek pri kompakciji
+// Kljucevi upisani posle brisanja ostaju vidljivi
+func (db *DB) DeleteRange(startKey string, endKey string) error {
+	return db.defaultFamily.DeleteRange(startKey, endKey)
+}
+
+func (cf *ColumnFamily) deleteRange(startKey string, endKey string) error {
+	if startKey >= endKey {
+		return ErrInvalidRange
+	}
+
+	//Kraj opsega se cuva kao vrednost zapisa ciji je kljuc pocetak opsega
+	data := new(Data)
+	data.Value = []byte(endKey)
+	data.Timestamp = uint64(time.Now().Unix())
+	data.Seq = cf.db.nextSeq()
+	data.RangeDelete = true
+	return cf.apply(startKey, data)
+}
+
+// Upisuje operand koji ce se merge operatorom spojiti sa trenutnom vrednoscu kljuca
+// Vrednost se ne cita pri upisu vec se operandi spajaju tek pri citanju i kompakciji
+func (db *DB) Merge(key string, operand []byte) error {
+	return db.defaultFamily.Merge(key, operand)
+}
+
+func (cf *ColumnFamily) merge(key string, operand []byte) error {
+	if cf.operator == nil {
+		return ErrNoMergeOperator
+	}
+
+	data := new(Data)
+	data.Value = operand
+	data.Timestamp = uint64(time.Now().Unix())
+	data.Seq = cf.db.nextSeq()
+	data.Operand = true
+	return cf.apply(key, data)
+}
+
+// Upisuje novu verziju kljuca u WAL i memtabelu familije
+// Pozivalac drzi writeLock
+func (cf *ColumnFamily) apply(key string, data *Data) error {
+	//UPISUJEMO U WAL (pozivalac ceka da zapis bude sacuvan, vidi writeDurably)
+	_, err := cf.db.wal.Append(cf.walEntry(key, data))
+	if err != nil {
+		return err
+	}
+
+	//UPISEMO U OM -> MEMTABLE
+	cf.db.insert([]*ColumnFamily{cf}, []string{key}, []*Data{data})
+
+	//Stara vrednost u cache-u vise ne vazi
+	err = cf.invalidate(key, data)
+	if err != nil {
+		return err
+	}
+	return cf.db.flushIfFull()
+}
+
+// Brise iz cache-a kljuc koji je upis promenio, odnosno sve kljuceve iz opsega brisanja
+func (cf *ColumnFamily) invalidate(key string, data *Data) error {
+	if data.RangeDelete {
+		return cf.lru.DeleteRange(key, string(data.Value))
+	}
+	return cf.lru.Delete(key)
+}
+
+// Dodeljuje redni broj novom upisu
+// Upis ostaje nevidljiv citaocima do poziva publish
+func (db *DB) nextSeq() uint64 {
+	db.seq++
+	db.assignedSeq.Store(db.seq)
+	return db.seq
+}
+
+// ------------ READPATH ------------
+// Cita podatak i ukoliko je uspesno citanje smesta ga u cache
+// Ukoliko kljuc ne postoji ili je obrisan vraca ErrNotFound
+func (db *DB) Get(key string) (*Data, error) {
+	return db.defaultFamily.Get(key)
+}
+
+// Cita verziju kljuca koja je vidljiva za dati redni broj upisa
+// U cache se smestaju samo najnovije verzije
+func (cf *ColumnFamily) get(key string, seq uint64) (*Data, error) {
+	//Generacija se uzima pre citanja da se u cache ne bi vratila vrednost koju je upis u medjuvremenu zamenio
+	//Dok neobjavljen upis ceka WAL citanje vidi stariju verziju koju je on vec izbacio iz cache-a, pa se ona ne vraca u cache
+	generation := cf.lru.Generation()
+	read := cacheRead{latest: seq == LATEST_SEQ && !cf.db.unpublished(), generation: generation}
+	seq = cf.db.readSeq(seq)
+
+	//1. Proveravamo memtabele, od aktivne ka najstarijoj nepromenljivoj
+	//Verzije starije od brisanja opsega iz memtabela su obrisane (brisanja opsega iz sstabela proverava lsm)
+	memtables := cf.memtables()
+	covering := memtableCoveringSeq(memtables, key, seq)
+	for i, memtable := range memtables {
+		found, data := memtable.Find(key, seq)
+		if found && data.Seq < covering {
+			return nil, ErrNotFound
+		}
+		if found && data.Operand {
+			return cf.resolve(key, data, seq, covering, memtables[i+1:], read)
+		}
+		if found {
+			return cf.cacheResult(key, data, read)
+		}
+	}
+
+	//2. Proveravamo Cache
+	//Cache cuva najnoviju verziju pa je ona vidljiva ukoliko nije upisana posle snapshot-a
+	found, data, err := cf.lru.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	if found && data.Seq <= seq && data.Seq > covering {
+		if data.Expired() {
+			return nil, ErrNotFound
+		}
+		return data, nil
+	}
+
+	//3. Proveravamo sstabele
+	found, data, err = cf.lsm.Find(key, seq)
+	if err != nil {
+		return nil, err
+	}
+	if found && data.Seq < covering {
+		return nil, ErrNotFound
+	}
+	if found && data.Operand {
+		return cf.resolve(key, data, seq, covering, nil, read)
+	}
+	if found {
+		return cf.cacheResult(key, data, read)
+	}
+	return nil, ErrNotFound
+}
+
+// Podaci o citanju potrebni da bi se odlucilo da li se rezultat sme smestiti u cache
+type cacheRead struct {
+	latest     bool   //Da li se cita najnovija verzija (a ne kroz snapshot)
+	generation uint64 //Generacija cache-a pre citanja
+}
+
+// Vraca redni broj najnovijeg brisanja opsega iz memtabela koje sadrzi kljuc i vidljivo je za dati redni broj upisa
+func memtableCoveringSeq(memtables []MemTable, key string, seq uint64) uint64 {
+	covering := uint64(0)
+	for _, memtable := range memtables {
+		memtableSeq := CoveringSeq(memtable.RangeTombstones(), key, seq)
+		if memtableSeq > covering {
+			covering = memtableSeq
+		}
+	}
+	return covering
+}
+
+// Racuna vrednost kljuca cija je najnovija vidljiva verzija operand
+// Lanac verzija (Older) se dopunjuje iz starijih memtabela i sstabela ukoliko u njemu nema vrednosti na koju se operandi primenjuju
+// Verzije starije od brisanja opsega (covering) se ne uzimaju, pa se operandi upisani posle njega spajaju bez osnovne vrednosti
+func (cf *ColumnFamily) resolve(key string, data *Data, seq uint64, covering uint64, older []MemTable, read cacheRead) (*Data, error) {
+	versions := make([]*Data, 0)
+	versions = appendOperands(versions, data)
+	for _, memtable := range older {
+		if !versions[len(versions)-1].Operand {
+			break
+		}
+		found, olderData := memtable.Find(key, seq)
+		if found {
+			versions = appendOperands(versions, olderData)
+		}
+	}
+
+	if versions[len(versions)-1].Operand {
+		oldestSeq := versions[len(versions)-1].Seq
+		found, older, err := cf.lsm.Find(key, seq)
+		if err != nil {
+			return nil, err
+		}
+		//Verzije koje su vec u memtabeli se preskacu
+		for current := older; found && current != nil; current = current.Older {
+			if current.Seq < oldestSeq {
+				versions = append(versions, current)
+			}
+		}
+	}
+
+	for i, version := range versions {
+		if version.Seq < covering {
+			versions = versions[:i]
+			break
+		}
+	}
+
+	resolved, err := Resolve(cf.operator, key, versions, true)
+	if err != nil {
+		return nil, err
+	}
+	return cf.cacheResult(key, resolved, read)
+}
+
+// Dodaje verzije iz lanca do prve koja nije operand (ukljucujuci i nju)
+func appendOperands(versions []*Data, data *Data) []*Data {
+	for current := data; current != nil; current = current.Older {
+		versions = append(versions, current)
+		if !current.Operand {
+			break
+		}
+	}
+	return versions
+}
+
+// Vraca pronadjeni podatak i dodaje ga u cache
+// Obrisani i istekli podaci se ne vracaju, a starije verzije procitane kroz snapshot se ne cuvaju u cache-u
+func (cf *ColumnFamily) cacheResult(key string, data *Data, read cacheRead) (*Data, error) {
+	if data.Deleted() {
+		return nil, ErrNotFound
+	}
+	if !read.latest {
+		return data, nil
+	}
+
+	//Dodajemo u cache
+	err := cf.lru.SetIfCurrent(key, data, read.generation)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// ------------ RANGE SCAN ------------
+// vraca niz kljuceva i niz podataka koji su u opsegu datog intervala
+// Rezultati su sortirani po kljucu, a za svaki kljuc se vraca samo najnovija verzija
+func (db *DB) RangeScan(minKey string, maxKey string, pageLen uint32, pageNum uint32) ([]string, []*Data, error) {
+	return db.defaultFamily.RangeScan(minKey, maxKey, pageLen, pageNum)
+}
+
+// Pretraga koja vidi samo upise do datog rednog broja
+func (cf *ColumnFamily) rangeScan(minKey string, maxKey string, pageLen uint32, pageNum uint32, seq uint64) ([]string, []*Data, error) {
+	return cf.scanPage(minKey, func(key string) bool { return key <= maxKey }, pageLen, pageNum, seq)
+}
+
+// ------------ LIST SCAN ------------
+// vraca niz kljuceva i niz podataka koji pocinju datim prefiksom
+// Rezultati su sortirani po kljucu, a za svaki kljuc se vraca samo najnovija verzija
+func (db *DB) ListScan(prefix string, pageLen uint32, pageNum uint32) ([]string, []*Data, error) {
+	return db.defaultFamily.ListScan(prefix, pageLen, pageNum)
+}
+
+// Pretraga koja vidi samo upise do datog rednog broja
+func (cf *ColumnFamily) listScan(prefix string, pageLen uint32, pageNum uint32, seq uint64) ([]string, []*Data, error) {
+	//Kljucevi sa istim prefiksom su u sortiranom redosledu jedan za drugim
+	return cf.scanPage(prefix, func(key string) bool { return strings.HasPrefix(key, prefix) }, pageLen, pageNum, seq)
+}
+
+// Pokrece kompakciju nad svim nivoima svih familija
+// Upisi, citanja i flush se nastavljaju dok kompakcija traje
+func (db *DB) Compact() error {
+	if db.closed.Load() {
+		return ErrClosed
+	}
+	for _, cf := range db.familyList() {
+		err := cf.compact()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Kompaktuje sstabele podrazumevane familije koje preklapaju opseg [minKey, maxKey] do poslednjeg nivoa
+// Koristi se za oslobadjanje prostora posle brisanja velikog broja kljuceva iz opsega (podaci u memtabelama se ne menjaju)
+func (db *DB) CompactRange(minKey string, maxKey string) error {
+	return db.defaultFamily.CompactRange(minKey, maxKey)
+}
+
+// Ispisuje sadrzaj memtabele i svih sstabela svake familije
+func (db *DB) Print() error {
+	if db.closed.Load() {
+		return ErrClosed
+	}
+	for _, cf := range db.familyList() {
+		fmt.Println("Familija kolona: " + cf.name)
+		for _, memtable := range cf.memtables() {
+			memtable.Print()
+		}
+		err := cf.lsm.Print()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
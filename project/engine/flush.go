@@ -0,0 +1,182 @@
+package engine
+
+import (
+	. "project/keyvalue/structures/memtable"
+)
+
+// Flush memtabela u pozadini
+// Kada se memtabela neke familije popuni, memtabele svih familija koje imaju podatke postaju nepromenljive,
+// umesto njih se kreiraju nove prazne
+// Nepromenljive memtabele flush-uje jedna pozadinska gorutina redom kojim su zamenjene,
+// a citanja ih koriste sve dok njihova sstabela ne postane deo LSM stabla
+// Ukoliko flush ceka MaxImmutableMemtables grupa memtabela, upis ceka da se neka zavrsi
+
+// Memtabele familija koje su zamenjene istovremeno
+type flushJob struct {
+	families  []*ColumnFamily
+	memtables []MemTable
+	segment   uint64 //Aktivni segment WAL-a pri zameni, svi zapisi ovih memtabela su u njemu ili ranijim
+	appended  uint64 //Broj zapisa dodatih u WAL pri zameni, flush ceka da budu sacuvani
+	seq       uint64 //Redni broj poslednjeg upisa u ovim memtabelama
+}
+
+// Pokrece gorutinu koja flush-uje nepromenljive memtabele
+func (db *DB) startFlushing() {
+	db.flushDone = make(chan struct{})
+	go db.flushLoop()
+}
+
+// Zaustavlja gorutinu nakon sto flush-uje sve memtabele koje cekaju
+// Vraca gresku pri flush-u ukoliko je do nje doslo
+func (db *DB) stopFlushing() error {
+	db.flushLock.Lock()
+	db.flushStop = true
+	db.flushCond.Broadcast()
+	db.flushLock.Unlock()
+
+	<-db.flushDone
+	return db.flushErr
+}
+
+func (db *DB) flushLoop() {
+	defer close(db.flushDone)
+	for true {
+		db.flushLock.Lock()
+		for len(db.flushQueue) == 0 && !db.flushStop {
+			db.flushCond.Wait()
+		}
+		if len(db.flushQueue) == 0 {
+			db.flushLock.Unlock()
+			return
+		}
+		job := db.flushQueue[0]
+		db.flushLock.Unlock()
+
+		err := db.runFlush(job)
+
+		//Memtabele ostaju u redu dok se ne flush-uju, pa se i dalje broje u MaxImmutableMemtables
+		//Nakon greske se vise ne flush-uje, podaci su sacuvani u WAL-u i vracaju se pri sledecem otvaranju
+		db.flushLock.Lock()
+		if err != nil {
+			db.flushErr = err
+		} else {
+			db.flushQueue = db.flushQueue[1:]
+		}
+		db.flushCond.Broadcast()
+		db.flushLock.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Flush-uje memtabele jedne grupe i brise segmente WAL-a ciji su svi zapisi flush-ovani
+// (segmente pre aktivnog segmenta pri zameni, jer su zapisi ranijih grupa vec flush-ovani)
+// Memtabele se flush-uju tek kada su svi njihovi zapisi sacuvani u WAL-u,
+// pa upis koji je vratio gresku WAL-a ne postaje deo sstabela
+// Upisi se objavljuju pre flush-a, pa sstabele ne sadrze verzije koje citaoci i snapshot-ovi jos ne vide
+func (db *DB) runFlush(job *flushJob) error {
+	err := db.wal.Wait(job.appended)
+	if err != nil {
+		db.fail(err)
+		return err
+	}
+	db.publish(job.seq)
+	for i, cf := range job.families {
+		err := cf.flushImmutable(job.memtables[i])
+		if err != nil {
+			return err
+		}
+		db.scheduleCompaction()
+	}
+	return db.wal.ReleaseSegments(job.segment)
+}
+
+// Dodaje grupu memtabela u red za flush
+func (db *DB) scheduleFlush(job *flushJob) {
+	db.flushLock.Lock()
+	db.flushQueue = append(db.flushQueue, job)
+	db.flushCond.Broadcast()
+	db.flushLock.Unlock()
+}
+
+// Ceka dok broj grupa memtabela koje cekaju flush ne padne ispod MaxImmutableMemtables
+func (db *DB) waitForFlush() error {
+	db.flushLock.Lock()
+	defer db.flushLock.Unlock()
+	for len(db.flushQueue) >= int(db.config.MaxImmutableMemtables) && db.flushErr == nil {
+		db.flushCond.Wait()
+	}
+	return db.flushErr
+}
+
+// Ukoliko je neka memtabela popunjena memtabele svih familija postaju nepromenljive i flush-uju se u pozadini
+// Familije dele WAL, pa se zamenjuju sve odjednom da bi se posle flush-a grupe mogli obrisati segmenti pre aktivnog
+// Pozivalac drzi writeLock
+func (db *DB) flushIfFull() error {
+	full := false
+	for _, cf := range db.familyList() {
+		if cf.memtable.IsFull() {
+			full = true
+		}
+	}
+	if !full {
+		return nil
+	}
+
+	err := db.waitForFlush()
+	if err != nil {
+		return err
+	}
+
+	job := new(flushJob)
+	for _, cf := range db.familyList() {
+		if cf.memtable.Size() == 0 {
+			continue
+		}
+		job.families = append(job.families, cf)
+		job.memtables = append(job.memtables, cf.freeze())
+	}
+	job.segment = db.wal.ActiveSegment()
+	job.appended = db.wal.Appended()
+	job.seq = db.seq
+	db.scheduleFlush(job)
+	return nil
+}
+
+// Vraca aktivnu memtabelu i nepromenljive memtabele koje cekaju flush, od najnovije ka najstarijoj
+func (cf *ColumnFamily) memtables() []MemTable {
+	cf.memtablesLock.RLock()
+	defer cf.memtablesLock.RUnlock()
+	memtables := make([]MemTable, 0, len(cf.immutables)+1)
+	memtables = append(memtables, cf.memtable)
+	for i := len(cf.immutables) - 1; i >= 0; i-- {
+		memtables = append(memtables, cf.immutables[i])
+	}
+	return memtables
+}
+
+// Aktivna memtabela postaje nepromenljiva, a upisi se nastavljaju u novu praznu
+// Vraca memtabelu koja je postala nepromenljiva
+func (cf *ColumnFamily) freeze() MemTable {
+	cf.memtablesLock.Lock()
+	defer cf.memtablesLock.Unlock()
+	immutable := cf.memtable
+	cf.immutables = append(cf.immutables, immutable)
+	cf.memtable = NewMemTable(cf.config, cf.lsm, cf.db.snapshots)
+	return immutable
+}
+
+// Zapisuje najstariju nepromenljivu memtabelu u sstabelu i prestaje da je cita
+// Memtabela se izbacuje tek kada je sstabela u LSM stablu, pa citaoci ne propustaju njene podatke
+func (cf *ColumnFamily) flushImmutable(immutable MemTable) error {
+	err := immutable.Flush()
+	if err != nil {
+		return err
+	}
+
+	cf.memtablesLock.Lock()
+	defer cf.memtablesLock.Unlock()
+	cf.immutables = cf.immutables[1:]
+	return nil
+}
@@ -0,0 +1,89 @@
+package engine
+
+import (
+	. "project/keyvalue/structures/dataType"
+	. "project/keyvalue/structures/iterator"
+)
+
+// Iterator kroz celu bazu (memtabelu i sve sstabele) koji vidi najnovije upise
+// Za svaki kljuc vraca samo najnoviju verziju, a obrisani kljucevi se preskacu
+// Iterator drzi otvorene fajlove sstabela pa se mora zatvoriti sa Close
+func (db *DB) NewIterator() (Iterator, error) {
+	return db.defaultFamily.NewIterator()
+}
+
+// Iterator koji vidi podatke iz trenutka kreiranja snapshot-a
+func (snapshot *Snapshot) NewIterator() (Iterator, error) {
+	err := snapshot.allow()
+	if err != nil {
+		return nil, err
+	}
+	return snapshot.db.defaultFamily.newIterator(snapshot.seq)
+}
+
+// Spaja iteratore memtabele i svih sstabela familije u jedan koji vidi upise do datog rednog broja
+// Memtabele se citaju pre sstabela, pa flush izmedju ta dva koraka moze samo ponoviti verzije (a ne i izgubiti)
+func (cf *ColumnFamily) newIterator(seq uint64) (Iterator, error) {
+	seq = cf.db.readSeq(seq)
+	children := make([]Iterator, 0)
+	tombstones := make([]*RangeTombstone, 0)
+	for _, memtable := range cf.memtables() {
+		children = append(children, memtable.NewIterator())
+		tombstones = append(tombstones, memtable.RangeTombstones()...)
+	}
+	iterators, sstableTombstones, err := cf.lsm.NewIterators()
+	if err != nil {
+		return nil, err
+	}
+	children = append(children, iterators...)
+	tombstones = append(tombstones, sstableTombstones...)
+	return NewMergingIterator(children, seq, cf.operator, tombstones), nil
+}
+
+// Vraca trazenu stranicu kljuceva pocevsi od prvog kljuca koji je veci ili jednak start
+// inRange proverava da li kljuc spada u pretragu, a iteracija se prekida kod prvog koji ne spada
+// Stranice se broje od 1
+func (cf *ColumnFamily) scanPage(start string, inRange func(key string) bool, pageLen uint32, pageNum uint32, seq uint64) ([]string, []*Data, error) {
+	if pageLen == 0 || pageNum == 0 {
+		return make([]string, 0), make([]*Data, 0), nil
+	}
+	skip := uint64(pageNum-1) * uint64(pageLen)
+	keys, values, _, err := cf.scanFrom(start, inRange, skip, pageLen, seq)
+	return keys, values, err
+}
+
+// Preskace skip kljuceva od start pa vraca najvise pageLen narednih
+// Vraca i da li posle vracenih postoji jos kljuceva koji spadaju u pretragu
+func (cf *ColumnFamily) scanFrom(start string, inRange func(key string) bool, skip uint64, pageLen uint32, seq uint64) ([]string, []*Data, bool, error) {
+	keys := make([]string, 0)
+	values := make([]*Data, 0)
+	more := false
+
+	it, err := cf.newIterator(seq)
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	for it.Seek(start); it.Valid() && inRange(it.Key()); it.Next() {
+		if skip > 0 {
+			skip--
+			continue
+		}
+		if uint32(len(keys)) == pageLen {
+			more = true
+			break
+		}
+		keys = append(keys, it.Key())
+		values = append(values, it.Value())
+	}
+
+	err = it.Err()
+	closeErr := it.Close()
+	if err != nil {
+		return nil, nil, false, err
+	}
+	if closeErr != nil {
+		return nil, nil, false, closeErr
+	}
+	return keys, values, more, nil
+}
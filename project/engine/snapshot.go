@@ -0,0 +1,88 @@
+package engine
+
+import (
+	. "project/keyvalue/errs"
+	. "project/keyvalue/structures/dataType"
+)
+
+// Pogled na bazu u jednom trenutku
+// Svi GET-ovi i pretrage kroz snapshot vide samo upise koji su zavrseni pre njegovog kreiranja,
+// bez obzira na kasnije upise, flush-eve i kompakcije
+// Dok snapshot nije oslobodjen memtabela i kompakcija cuvaju starije verzije koje su mu potrebne
+type Snapshot struct {
+	db       *DB
+	seq      uint64
+	released bool
+}
+
+// Kreira snapshot vezan za poslednji upis
+// Snapshot se mora osloboditi sa Release kada vise nije potreban
+func (db *DB) NewSnapshot() (*Snapshot, error) {
+	err := db.usable()
+	if err != nil {
+		return nil, err
+	}
+	//Snapshot se belezi pre objavljivanja sledeceg upisa, pa kompakcija cuva verziju koju snapshot vidi
+	snapshot := new(Snapshot)
+	snapshot.db = db
+	snapshot.seq = db.acquireVisible()
+	return snapshot, nil
+}
+
+// Redni broj poslednjeg upisa koji snapshot vidi
+func (snapshot *Snapshot) Seq() uint64 {
+	return snapshot.seq
+}
+
+// Proverava da li se snapshot jos moze koristiti
+func (snapshot *Snapshot) allow() error {
+	if snapshot.released {
+		return ErrReleased
+	}
+	return snapshot.db.allow()
+}
+
+// Cita podatak onakav kakav je bio u trenutku kreiranja snapshot-a
+func (snapshot *Snapshot) Get(key string) (*Data, error) {
+	err := snapshot.allow()
+	if err != nil {
+		return nil, err
+	}
+	return snapshot.db.defaultFamily.get(key, snapshot.seq)
+}
+
+// RangeScan nad podacima iz trenutka kreiranja snapshot-a
+func (snapshot *Snapshot) RangeScan(minKey string, maxKey string, pageLen uint32, pageNum uint32) ([]string, []*Data, error) {
+	err := snapshot.allow()
+	if err != nil {
+		return nil, nil, err
+	}
+	return snapshot.db.defaultFamily.rangeScan(minKey, maxKey, pageLen, pageNum, snapshot.seq)
+}
+
+// ListScan nad podacima iz trenutka kreiranja snapshot-a
+func (snapshot *Snapshot) ListScan(prefix string, pageLen uint32, pageNum uint32) ([]string, []*Data, error) {
+	err := snapshot.allow()
+	if err != nil {
+		return nil, nil, err
+	}
+	return snapshot.db.defaultFamily.listScan(prefix, pageLen, pageNum, snapshot.seq)
+}
+
+// Oslobadja snapshot
+// Starije verzije koje su bile potrebne samo njemu brisu se pri sledecem upisu kljuca, flush-u ili kompakciji
+func (snapshot *Snapshot) Release() {
+	if snapshot.released {
+		return
+	}
+	snapshot.released = true
+	snapshot.db.releaseSnapshot(snapshot.seq)
+}
+
+// Oslobadja snapshot na datom rednom broju
+// Ukoliko je bio najstariji ili najnoviji, kompakcije koje je odlagao mogu da se pokrenu
+func (db *DB) releaseSnapshot(seq uint64) {
+	if db.snapshots.Release(seq) {
+		db.wakeCompaction()
+	}
+}
@@ -0,0 +1,160 @@
+package engine
+
+import (
+	. "project/keyvalue/errs"
+	"time"
+)
+
+// Usporavanje i zaustavljanje upisa (write stall)
+// Flush dodaje sstabele u prvi nivo brze nego sto ih kompakcija moze prazniti,
+// a svaka sstabela prvog nivoa usporava citanja
+// Nakon svakog flush-a i svake kompakcije se racuna broj sstabela u prvom nivou (najveci medju familijama)
+// i broj bajtova koji cekaju kompakciju (zbir svih familija) i porede se sa pragovima iz konfiguracije baze:
+// iznad mekog praga (slowdown/soft) svaki upis ceka to duze sto je prag vise prekoracen, najvise MAX_WRITE_DELAY,
+// a iznad tvrdog praga (stop/hard) upisi cekaju dok kompakcija ne spusti vrednosti ispod njega
+
+// Stanje upisa
+type WriteStall int
+
+const (
+	WRITE_NORMAL  WriteStall = iota //Upisi se izvrsavaju bez cekanja
+	WRITE_DELAYED                   //Upisi se usporavaju
+	WRITE_STOPPED                   //Upisi cekaju kompakciju
+)
+
+func (stall WriteStall) String() string {
+	switch stall {
+	case WRITE_DELAYED:
+		return "delayed"
+	case WRITE_STOPPED:
+		return "stopped"
+	}
+	return "normal"
+}
+
+// Najduze cekanje jednog upisa iznad mekog praga
+const MAX_WRITE_DELAY = 10 * time.Millisecond
+
+// Pocetak od kog se mere pocetci cekanja, pa se vremena racunaju monotonim satom
+var stallEpoch = time.Now()
+
+// Racuna stanje upisa iz trenutnih nivoa svih familija i budi upise koji cekaju
+// Poziva se nakon svake promene nivoa (flush, kompakcija)
+// Racunanja se izvrsavaju jedno po jedno, pa poslednje sacuvano stanje uvek odgovara poslednjoj promeni
+func (db *DB) updateWriteStall() {
+	db.stallUpdateLock.Lock()
+	defer db.stallUpdateLock.Unlock()
+	level1Tables := uint32(0)
+	pendingBytes := uint64(0)
+	for _, cf := range db.familyList() {
+		//Fifo i time_window kompakcije drze sve sstabele u prvom nivou, pa se on kod njih ne broji
+		compactionType := cf.config.CompactionType
+		if compactionType == "size_tiered" || compactionType == "leveled" {
+			tables := cf.lsm.LevelSize(1)
+			if tables > level1Tables {
+				level1Tables = tables
+			}
+		}
+		bytes, err := cf.lsm.PendingCompactionBytes()
+		if err != nil {
+			//Procena nije moguca, stanje ostaje isto do sledece promene nivoa,
+			//a zaustavljeni upisi vracaju gresku umesto da cekaju promenu koja mozda nece doci
+			db.stallLock.Lock()
+			db.stallErr = err
+			db.stallCond.Broadcast()
+			db.stallLock.Unlock()
+			return
+		}
+		pendingBytes += bytes
+	}
+
+	config := db.config
+	stall := WRITE_NORMAL
+	severity := float64(0) //Koliko je meki prag prekoracen, od 0 do 1
+	if uint(level1Tables) >= config.Level1StopTables || pendingBytes >= config.HardPendingCompactionBytes {
+		stall = WRITE_STOPPED
+	} else {
+		if uint(level1Tables) >= config.Level1SlowdownTables {
+			stall = WRITE_DELAYED
+			severity = float64(uint(level1Tables)-config.Level1SlowdownTables+1) /
+				float64(config.Level1StopTables-config.Level1SlowdownTables+1)
+		}
+		if pendingBytes >= config.SoftPendingCompactionBytes {
+			stall = WRITE_DELAYED
+			bytesSeverity := float64(pendingBytes-config.SoftPendingCompactionBytes+1) /
+				float64(config.HardPendingCompactionBytes-config.SoftPendingCompactionBytes+1)
+			if bytesSeverity > severity {
+				severity = bytesSeverity
+			}
+		}
+	}
+
+	db.stallLock.Lock()
+	if stall != WRITE_NORMAL && db.stall == WRITE_NORMAL {
+		db.stallStart = time.Now()
+	}
+	db.stall = stall
+	db.stallErr = nil
+	db.writeDelay = time.Duration(severity * float64(MAX_WRITE_DELAY))
+	db.level1Tables = level1Tables
+	db.pendingCompactionBytes = pendingBytes
+	db.stallCond.Broadcast()
+	db.stallLock.Unlock()
+}
+
+// Usporava ili zaustavlja upis u zavisnosti od stanja upisa
+// Poziva se pre zauzimanja writeLock-a (vidi startWrite), pa upisi cekaju istovremeno
+// Vraca gresku ukoliko je baza zatvorena, kompakcija vise ne radi ili se stanje upisa ne moze proceniti dok upis ceka
+func (db *DB) stallWrite() error {
+	db.stallLock.Lock()
+	defer db.stallLock.Unlock()
+	if db.stall == WRITE_NORMAL {
+		return nil
+	}
+
+	start := time.Since(stallEpoch)
+	db.waitingWrites++
+	db.waitingSince += start
+	defer func() {
+		db.waitingWrites--
+		db.waitingSince -= start
+		db.stallDuration += time.Since(stallEpoch) - start
+	}()
+	if db.stall == WRITE_STOPPED {
+		db.stoppedWrites++
+		for db.stall == WRITE_STOPPED {
+			if db.closed.Load() {
+				return ErrClosed
+			}
+			err := db.compactionError()
+			if err != nil {
+				return err
+			}
+			if db.stallErr != nil {
+				return db.stallErr
+			}
+			db.stallCond.Wait()
+		}
+	}
+	if db.stall == WRITE_DELAYED {
+		db.delayedWrites++
+		delay := db.writeDelay
+		db.stallLock.Unlock()
+		time.Sleep(delay)
+		db.stallLock.Lock()
+	}
+	return nil
+}
+
+// Ukupno vreme cekanja upisa, ukljucujuci upise koji jos cekaju
+// Poziva se pod stallLock-om
+func (db *DB) stalledTime() time.Duration {
+	return db.stallDuration + time.Duration(db.waitingWrites)*time.Since(stallEpoch) - db.waitingSince
+}
+
+// Budi upise koji cekaju kompakciju da bi primetili zatvaranje baze
+func (db *DB) wakeStalledWrites() {
+	db.stallLock.Lock()
+	db.stallCond.Broadcast()
+	db.stallLock.Unlock()
+}
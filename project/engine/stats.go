@@ -0,0 +1,41 @@
+package engine
+
+import (
+	. "project/keyvalue/errs"
+	"time"
+)
+
+// Statistike rada baze
+type Stats struct {
+	WriteStall             WriteStall    //Trenutno stanje upisa
+	StalledFor             time.Duration //Koliko dugo traje trenutno usporavanje ili zaustavljanje (0 ukoliko upisi nisu ograniceni)
+	StallDuration          time.Duration //Ukupno vreme koje su upisi cekali zbog usporavanja ili zaustavljanja (ukljucujuci upise koji jos cekaju)
+	DelayedWrites          uint64        //Broj upisa koji su usporeni
+	StoppedWrites          uint64        //Broj upisa koji su cekali kompakciju
+	Level1Tables           uint32        //Broj sstabela u prvom nivou (najveci medju familijama)
+	PendingCompactionBytes uint64        //Bajtovi sstabela koji cekaju kompakciju u svim familijama
+	DroppedTombstones      uint64        //Broj tombstone-ova i brisanja opsega koje su kompakcije izbacile od otvaranja baze (u svim familijama)
+}
+
+// Vraca trenutne statistike baze
+func (db *DB) Stats() (*Stats, error) {
+	if db.closed.Load() {
+		return nil, ErrClosed
+	}
+	db.stallLock.Lock()
+	defer db.stallLock.Unlock()
+	stats := new(Stats)
+	stats.WriteStall = db.stall
+	if db.stall != WRITE_NORMAL {
+		stats.StalledFor = time.Since(db.stallStart)
+	}
+	stats.StallDuration = db.stalledTime()
+	stats.DelayedWrites = db.delayedWrites
+	stats.StoppedWrites = db.stoppedWrites
+	stats.Level1Tables = db.level1Tables
+	stats.PendingCompactionBytes = db.pendingCompactionBytes
+	for _, cf := range db.familyList() {
+		stats.DroppedTombstones += cf.lsm.DroppedTombstones()
+	}
+	return stats, nil
+}
@@ -0,0 +1,136 @@
+package engine
+
+import (
+	"errors"
+	. "project/keyvalue/errs"
+	. "project/keyvalue/structures/dataType"
+)
+
+// Optimisticka transakcija nad vise kljuceva
+// Citanja vide bazu iz trenutka pocetka transakcije (kroz snapshot), a upisi se cuvaju u memoriji
+// Pri Commit-u se proverava da niko nije izmenio procitane kljuceve u medjuvremenu:
+// ukoliko jeste vraca se greska koja je ErrConflict i nista se ne upisuje,
+// a u suprotnom se svi upisi primenjuju atomicno kao jedan WriteBatch
+// Kljucevi koji su samo upisani (bez citanja) se ne proveravaju
+// Nakon Commit-a (uspesnog ili ne) i Rollback-a sve operacije vracaju ErrTxnDone
+// Vise transakcija moze raditi paralelno, ali jednu transakciju koristi samo jedna gorutina
+type Transaction struct {
+	db       *DB
+	snapshot *Snapshot
+	reads    map[string]uint64 //Verzija svakog procitanog kljuca (0 ukoliko nije postojao)
+	writes   map[string]*Data  //Poslednji upis svakog kljuca, da bi transakcija videla svoje upise
+	batch    *WriteBatch
+	done     bool
+}
+
+// Zapocinje transakciju nad podrazumevanom familijom
+// Transakcija se mora zavrsiti sa Commit ili Rollback da bi se oslobodio njen snapshot
+func (db *DB) Begin() (*Transaction, error) {
+	err := db.allow()
+	if err != nil {
+		return nil, err
+	}
+	snapshot, err := db.NewSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	txn := new(Transaction)
+	txn.db = db
+	txn.snapshot = snapshot
+	txn.reads = make(map[string]uint64)
+	txn.writes = make(map[string]*Data)
+	txn.batch = NewWriteBatch()
+	return txn, nil
+}
+
+func (txn *Transaction) allow() error {
+	if txn.done {
+		return ErrTxnDone
+	}
+	return txn.db.allow()
+}
+
+// Cita kljuc kako ga transakcija vidi
+// Kljucevi koje je transakcija vec upisala vracaju upisanu vrednost,
+// a ostali se citaju iz snapshot-a i pamte se za proveru pri Commit-u
+func (txn *Transaction) Get(key string) (*Data, error) {
+	err := txn.allow()
+	if err != nil {
+		return nil, err
+	}
+	written, found := txn.writes[key]
+	if found {
+		if written.Tombstone {
+			return nil, ErrNotFound
+		}
+		return written, nil
+	}
+
+	data, err := txn.db.defaultFamily.get(key, txn.snapshot.seq)
+	if errors.Is(err, ErrNotFound) {
+		txn.reads[key] = 0
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	txn.reads[key] = data.Seq
+	return data, nil
+}
+
+// Dodaje upis koji ce se primeniti pri Commit-u
+func (txn *Transaction) Put(key string, value []byte) error {
+	if txn.done {
+		return ErrTxnDone
+	}
+	txn.batch.Put(key, value)
+	txn.writes[key] = NewData(value, false, 0)
+	return nil
+}
+
+// Dodaje brisanje koje ce se primeniti pri Commit-u
+func (txn *Transaction) Delete(key string) error {
+	if txn.done {
+		return ErrTxnDone
+	}
+	txn.batch.Delete(key)
+	txn.writes[key] = NewData(make([]byte, 0), true, 0)
+	return nil
+}
+
+// Proverava procitane kljuceve i primenjuje sve upise
+// Ukoliko je neki procitani kljuc u medjuvremenu izmenjen ili obrisan vraca gresku koja je ErrConflict
+func (txn *Transaction) Commit() error {
+	err := txn.allow()
+	if err != nil {
+		return err
+	}
+	defer txn.finish()
+
+	//Niko ne sme upisati izmedju provere i primene upisa
+	return txn.db.writeDurably(func() error {
+		for key, readVersion := range txn.reads {
+			version, err := txn.db.defaultFamily.currentVersion(key)
+			if err != nil {
+				return err
+			}
+			if version != readVersion {
+				return NewConflictError(key, readVersion, version)
+			}
+		}
+		return txn.db.write(txn.batch)
+	})
+}
+
+// Odbacuje sve upise transakcije
+func (txn *Transaction) Rollback() {
+	if txn.done {
+		return
+	}
+	txn.finish()
+}
+
+func (txn *Transaction) finish() {
+	txn.done = true
+	txn.snapshot.Release()
+}
@@ -0,0 +1,74 @@
+package errs
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Greske koje pozivaoci mogu proveriti sa errors.Is
+var (
+	ErrNotFound        = errors.New("kljuc ne postoji u bazi podataka")
+	ErrCorruption      = errors.New("podaci na disku su osteceni")
+	ErrIO              = errors.New("greska prilikom rada sa diskom")
+	ErrRateLimited     = errors.New("previse zahteva, pokusajte ponovo kasnije")
+	ErrClosed          = errors.New("baza podataka je zatvorena")
+	ErrReleased        = errors.New("snapshot je vec oslobodjen")
+	ErrInvalidToken    = errors.New("neispravan token za nastavak pretrage")
+	ErrTokenExpired    = errors.New("token pretrage je istekao ili je oslobodjen")
+	ErrConflict        = errors.New("uslov upisa nije ispunjen")
+	ErrNoMergeOperator = errors.New("merge operator nije zadat")
+	ErrMergeFailed     = errors.New("spajanje operanada nije uspelo")
+	ErrNoFamily        = errors.New("familija kolona ne postoji")
+	ErrFamilyExists    = errors.New("familija kolona vec postoji")
+	ErrInvalidFamily   = errors.New("neispravan naziv familije kolona")
+	ErrTxnDone         = errors.New("transakcija je vec zavrsena")
+	ErrInvalidRange    = errors.New("neispravan opseg kljuceva")
+	ErrFormat          = errors.New("podaci na disku su u nepodrzanom formatu")
+)
+
+// Greska koja pripada jednoj od gore navedenih vrsta
+// a cuva i originalnu gresku (npr. os.ErrNotExist ostaje proverljiv)
+type kindError struct {
+	kind error
+	err  error
+}
+
+func (e *kindError) Error() string {
+	return e.kind.Error() + ": " + e.err.Error()
+}
+
+func (e *kindError) Unwrap() error {
+	return e.err
+}
+
+func (e *kindError) Is(target error) bool {
+	return target == e.kind
+}
+
+// Obmotava gresku operativnog sistema u ErrIO
+func NewIOError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &kindError{kind: ErrIO, err: err}
+}
+
+// Vraca ErrCorruption sa opisom sta je osteceno
+func NewCorruptionError(format string, args ...interface{}) error {
+	return &kindError{kind: ErrCorruption, err: fmt.Errorf(format, args...)}
+}
+
+// Vraca ErrFormat sa opisom fajla i verzije formata u kojoj je zapisan
+func NewFormatError(format string, args ...interface{}) error {
+	return &kindError{kind: ErrFormat, err: fmt.Errorf(format, args...)}
+}
+
+// Vraca ErrConflict sa trenutnom i ocekivanom verzijom kljuca
+func NewConflictError(key string, expected uint64, actual uint64) error {
+	return &kindError{kind: ErrConflict, err: fmt.Errorf("kljuc %s ima verziju %d umesto %d", key, actual, expected)}
+}
+
+// Vraca ErrMergeFailed sa opisom zasto operandi nisu mogli biti spojeni
+func NewMergeError(format string, args ...interface{}) error {
+	return &kindError{kind: ErrMergeFailed, err: fmt.Errorf(format, args...)}
+}
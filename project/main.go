@@ -2,7 +2,10 @@ package main
 
 import (
 	"bufio"
+	"errors"
+	"flag"
 	"fmt"
+	"log"
 	"os"
 	"strings"
 
@@ -10,20 +13,12 @@ import (
 
 	"time"
 
-	// "time"
-
-	// . "project/keyvalue/structures/dataType"
-	. "project/keyvalue/structures/least_reacently_used"
-	. "project/keyvalue/structures/lsm"
-	. "project/keyvalue/structures/memtable"
-
+	. "project/keyvalue/engine"
+	. "project/keyvalue/errs"
 	. "project/keyvalue/menu_functions"
-	. "project/keyvalue/structures/token_bucket"
-	. "project/keyvalue/structures/wal"
-	// . "project/keyvalue/structures/sstable"
 )
 
-func menu(mem MemTable, lru *LRUCache, bucket *TokenBucket) {
+func menu(db *DB) {
 	fmt.Println("=======================================")
 	fmt.Println("============= GLAVNI MENI =============")
 	fmt.Println("=======================================")
@@ -40,6 +35,9 @@ func menu(mem MemTable, lru *LRUCache, bucket *TokenBucket) {
 	fmt.Println("10 - SimHash menu")
 	fmt.Println("11 - Ispisi sve podatke")
 	fmt.Println("12 - Generisanje unosa")
+	fmt.Println("13 - Statistike")
+	fmt.Println("14 - DELETE RANGE")
+	fmt.Println("15 - KOMPAKCIJA OPSEGA")
 	fmt.Println("X - Izlaz iz programa")
 	fmt.Println("=======================================")
 	fmt.Print("Izaberite opciju: ")
@@ -59,76 +57,101 @@ func menu(mem MemTable, lru *LRUCache, bucket *TokenBucket) {
 	case "1":
 		key, val := GetUserInput()
 		if key != "*"{
-			PUT(key, val, mem, bucket)
-			fmt.Println("Uspesno dodavanje")
+			err := db.Put(key, val)
+			if err == nil {
+				fmt.Println("Uspesno dodavanje")
+			} else if errors.Is(err, ErrRateLimited) {
+				fmt.Println("Zahtev je odbijen, pokusajte ponovo")
+			} else {
+				PrintError(err)
+			}
 		}
 	case "2":
 		key:= GetKeyInput()
 		if key != "*"{
 			start := time.Now()
-			found, data := GET(key, mem, lru, bucket)
+			data, err := db.Get(key)
 			elapsedTime := time.Since(start)
-			if found {
+			if err == nil {
 				data.Print()
 				fmt.Printf("Vreme dobavljanja podatka: %s\n", elapsedTime)
-			} else {
+			} else if errors.Is(err, ErrNotFound) {
 				fmt.Println("Kljuc se ne nalazi u bazi podataka")
+			} else if errors.Is(err, ErrRateLimited) {
+				fmt.Println("Zahtev je odbijen, pokusajte ponovo")
+			} else {
+				PrintError(err)
 			}
 		}
 		
 	case "3":
 		key:= GetKeyInput()
 		if key != "*"{
-			DELETE(key, mem, lru, bucket)
-			fmt.Println("Uspesno brisanje")
+			err := db.Delete(key)
+			if err == nil {
+				fmt.Println("Uspesno brisanje")
+			} else if errors.Is(err, ErrRateLimited) {
+				fmt.Println("Zahtev je odbijen, pokusajte ponovo")
+			} else {
+				PrintError(err)
+			}
 		}
 	case "4":
-		InitiateListScan(mem, bucket)
+		InitiateListScan(db)
 	case "5":
-		InitiateRangeScan(mem, bucket)
+		InitiateRangeScan(db)
 	case "6":
-		RunCompact()
+		PrintError(db.Compact())
 	case "7":
-		CountMinSKetchMenu(mem, lru, bucket)
+		CountMinSKetchMenu(db)
 	case "8":
-		BloomFilterMenu(mem, lru, bucket)
+		BloomFilterMenu(db)
 	case "9":
-		HyperLogLogMenu(mem, lru, bucket)
+		HyperLogLogMenu(db)
 	case "10":
-		SimHashMenu(mem, lru, bucket)
+		SimHashMenu(db)
 	case "11":
-		mem.Print()
-		ReadLsm().Print()
+		PrintError(db.Print())
 	case "12":
-		GenerateEntries(mem, bucket)
+		GenerateEntries(db)
+	case "13":
+		PrintStats(db)
+	case "14":
+		InitiateDeleteRange(db)
+	case "15":
+		InitiateCompactRange(db)
 	case "x":
-		fmt.Println("Uspesan izlaz!")
-		os.Exit(0)
+		exit(db)
 	case "X":
-		fmt.Println("Uspesan izlaz!")
-		os.Exit(0)
+		exit(db)
 	default:
 		fmt.Println("Neispravan unos. Molimo vas probajte opet.")
 	}
 }
 
-func main() {
-	//inicijalizujemo strukturu fajlova
-	InitializeLsm()
-	
-	//Ucitavamo CACHE (LRU)
-	lru := ReadLru()
+// Zatvara bazu i izlazi iz programa
+func exit(db *DB) {
+	err := db.Close()
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("Uspesan izlaz!")
+	os.Exit(0)
+}
 
-	//Na pocetku ucitavamo iz WAL-a u memtabelu
-	wal := NewWriteAheadLog("files/wal")
-	memtable := LoadToMemTable(wal.InitiateMemTable())
+func main() {
+	//Direktorijum sa podacima i putanja do konfiguracije se mogu zadati pri pokretanju
+	dir := flag.String("dir", "files", "direktorijum sa podacima baze")
+	configPath := flag.String("config", "config/config.yml", "putanja do konfiguracionog fajla")
+	flag.Parse()
 
-	//Ogranicenje brzine pristupa
-	bucket := NewTokenBucket()
+	db, err := Open(*dir, &Options{ConfigPath: *configPath, ColumnFamilies: MenuColumnFamilies()})
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	for true {
-		menu(memtable, lru, bucket)
+		menu(db)
 	}
 	
 }
-
@@ -5,15 +5,13 @@ import (
 	"bytes"
 	"fmt"
 	"os"
+	. "project/keyvalue/engine"
 	. "project/keyvalue/structures/bloom"
-	. "project/keyvalue/structures/least_reacently_used"
-	. "project/keyvalue/structures/memtable"
-	. "project/keyvalue/structures/token_bucket"
 	"strconv"
 	"strings"
 )
 
-func CreateBloomFilter(mem MemTable, lru *LRUCache, bucket *TokenBucket) (bool, string, *BloomFilter) {
+func CreateBloomFilter(cf *ColumnFamily) (bool, string, *BloomFilter) {
 	scanner := bufio.NewScanner(os.Stdin)
     
 	var input string //kljuc
@@ -28,9 +26,9 @@ func CreateBloomFilter(mem MemTable, lru *LRUCache, bucket *TokenBucket) (bool,
 		if input == "*" {
 			return true, input, nil
 		}
-		input = "BloomFilter" + input
-		found, data := GET(input, mem, lru, bucket)
-		if found == true {
+		data, err := cf.Get(input)
+		PrintError(err)
+		if err == nil {
 			var choice string
 
 			for true {
@@ -158,7 +156,7 @@ func CreateBloomFilter(mem MemTable, lru *LRUCache, bucket *TokenBucket) (bool,
 	return false, input, blm
 }
 
-func GetBloomFilter(mem MemTable, lru *LRUCache, bucket *TokenBucket) (bool, string, *BloomFilter) {
+func GetBloomFilter(cf *ColumnFamily) (bool, string, *BloomFilter) {
 	var key string
 	blm := new(BloomFilter)
 
@@ -167,10 +165,10 @@ func GetBloomFilter(mem MemTable, lru *LRUCache, bucket *TokenBucket) (bool, str
 	if key == "*" {
 		return false, key, nil
 	}
-	key = "BloomFilter" + key
 	
-	found, data := GET(key, mem, lru, bucket)
-	if found {
+	data, err := cf.Get(key)
+	PrintError(err)
+	if err == nil {
 		cmsBytes := data.Value
 		blm = MenuByteToBloomFilter(cmsBytes)
 		fmt.Println("Uspesno dobavljanje")
@@ -214,12 +212,17 @@ func BloomFilterFindElem(blm *BloomFilter) {
 	}
 }
 
-func BloomFilterPUT(key string, blm *BloomFilter, mem MemTable, bucket *TokenBucket) {
+func BloomFilterPUT(key string, blm *BloomFilter, cf *ColumnFamily) error {
 	bytesBLM := MenuBloomFilterToByte(blm)
-	PUT(key, bytesBLM, mem, bucket)
+	return cf.Put(key, bytesBLM)
 }
 
-func BloomFilterMenu(mem MemTable, lru *LRUCache, bucket *TokenBucket) {
+func BloomFilterMenu(db *DB) {
+	cf, err := db.ColumnFamily(BLOOM_FILTER_FAMILY)
+	if err != nil {
+		PrintError(err)
+		return
+	}
 	scanner := bufio.NewScanner(os.Stdin)
 	activeBLM := new(BloomFilter)
 	var activeKey string //kljuc Bloom filtera
@@ -255,20 +258,20 @@ func BloomFilterMenu(mem MemTable, lru *LRUCache, bucket *TokenBucket) {
 
 		switch input {
 		case "1":
-			found, tempKey, tempBLM := CreateBloomFilter(mem, lru, bucket)
+			found, tempKey, tempBLM := CreateBloomFilter(cf)
 				if !found {
 					activeBLM = tempBLM
 					activeKey = tempKey
-					userkey = activeKey[11:]
+					userkey = activeKey
 				}
 
 		case "2":
-			found, tempKey, tempBLM := GetBloomFilter(mem, lru, bucket)
+			found, tempKey, tempBLM := GetBloomFilter(cf)
 			if tempKey != "*" {
 				if found {
 					activeBLM = tempBLM
 					activeKey = tempKey
-					userkey = activeKey[11:]
+					userkey = activeKey
 				} else {
 					fmt.Println("Ne postoji BloomFilter sa datim kljucem")
 				}
@@ -289,17 +292,23 @@ func BloomFilterMenu(mem MemTable, lru *LRUCache, bucket *TokenBucket) {
 			}
 		case "5":
 			if len(activeKey) != 0 {
-				BloomFilterPUT(activeKey, activeBLM, mem, bucket)
-				fmt.Println("Uspesan upis")
+				err := BloomFilterPUT(activeKey, activeBLM, cf)
+				PrintError(err)
+				if err == nil {
+					fmt.Println("Uspesan upis")
+				}
 			} else {
 				fmt.Println("Nije izabran aktivni BloomFilter")
 			}
 		case "6":
 			if len(activeKey) != 0 {
-				DELETE(activeKey, mem, lru, bucket)
+				err := cf.Delete(activeKey)
+				PrintError(err)
+				if err == nil {
+					fmt.Println("Uspesno brisanje")
+				}
 			} else {
 				fmt.Println("Nije izabran aktivni BloomFilter")
-				fmt.Println("Uspesno brisanje")
 			}
 		case "x":
 			return
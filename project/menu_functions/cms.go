@@ -5,15 +5,15 @@ import (
 	"bytes"
 	"fmt"
 	"os"
+	. "project/keyvalue/engine"
 	. "project/keyvalue/structures/cms"
-	. "project/keyvalue/structures/least_reacently_used"
-	. "project/keyvalue/structures/memtable"
-	. "project/keyvalue/structures/token_bucket"
 	"strconv"
 	"strings"
 )
 
-func CreateCountMinSketch(mem MemTable, lru *LRUCache, bucket *TokenBucket) (bool, string, *CountMinSketch) {
+// korisnik unosi kljuc i kreira se novi CountMinSketch
+// poslednja povratna vrednost je true ukoliko je korisnik izabrao postojeci CountMinSketch iz baze
+func CreateCountMinSketch(cf *ColumnFamily) (bool, string, *CountMinSketch, bool) {
 	scanner := bufio.NewScanner(os.Stdin)
 	var input string
 	var epsilon float64
@@ -25,11 +25,11 @@ func CreateCountMinSketch(mem MemTable, lru *LRUCache, bucket *TokenBucket) (boo
 
 		input = GetKeyInput()
 		if input == "*" {
-			return true, input, nil
+			return true, input, nil, false
 		}
-		input = "CountMinSketch" + input
-		found, data := GET(input, mem, lru, bucket)
-		if found == true {
+		data, err := cf.Get(input)
+		PrintError(err)
+		if err == nil {
 			var choice string
 
 			for true {
@@ -46,12 +46,16 @@ func CreateCountMinSketch(mem MemTable, lru *LRUCache, bucket *TokenBucket) (boo
 				}
 
 				if choice == "*" {
-					return true, input, nil
+					return true, input, nil, false
 				}
 
 				if choice == "1" {
-					cms = BytesToCountMinSketch(data.Value)
-					return false, input, cms
+					cms, err = BytesToCountMinSketch(data.Value)
+					if err != nil {
+						PrintError(err)
+						continue
+					}
+					return false, input, cms, true
 
 				}else if choice == "2"{
 
@@ -62,7 +66,7 @@ func CreateCountMinSketch(mem MemTable, lru *LRUCache, bucket *TokenBucket) (boo
 
 						err := scanner.Err()
 						if tempInput == "*" {
-							return true, tempInput, nil
+							return true, tempInput, nil, false
 						}
 						if err != nil {
 							fmt.Println("Greska prilikom unosa: ", err)
@@ -81,7 +85,7 @@ func CreateCountMinSketch(mem MemTable, lru *LRUCache, bucket *TokenBucket) (boo
 
 						err := scanner.Err()
 						if tempInput == "*" {
-							return true, tempInput, nil
+							return true, tempInput, nil, false
 						}
 						if err != nil {
 							fmt.Println("Greska prilikom unosa: ", err)
@@ -95,12 +99,12 @@ func CreateCountMinSketch(mem MemTable, lru *LRUCache, bucket *TokenBucket) (boo
 					}
 
 					cms = NewCountMinSketch(epsilon, delta)
-					return false, input, cms
+					return false, input, cms, false
 				} else{
 					fmt.Println("Molimo vas unesite 1 ili 2")
 				}
 			}
-			return true, input, nil
+			return true, input, nil, false
 		}else {
 
 			for true {
@@ -110,7 +114,7 @@ func CreateCountMinSketch(mem MemTable, lru *LRUCache, bucket *TokenBucket) (boo
 
 				err := scanner.Err()
 				if tempInput == "*" {
-					return true, tempInput, nil
+					return true, tempInput, nil, false
 				}
 				if err != nil {
 					fmt.Println("Greska prilikom unosa: ", err)
@@ -129,7 +133,7 @@ func CreateCountMinSketch(mem MemTable, lru *LRUCache, bucket *TokenBucket) (boo
 
 				err := scanner.Err()
 				if tempInput == "*" {
-					return true, tempInput, nil
+					return true, tempInput, nil, false
 				}
 				if err != nil {
 					fmt.Println("Greska prilikom unosa: ", err)
@@ -147,10 +151,10 @@ func CreateCountMinSketch(mem MemTable, lru *LRUCache, bucket *TokenBucket) (boo
 		}
 	}
 
-	return false, input, cms
+	return false, input, cms, false
 }
 //dobavlja cms iz baze podataka
-func CountMinSketchGET(mem MemTable, lru *LRUCache, bucket *TokenBucket) (bool, string, *CountMinSketch) {
+func CountMinSketchGET(cf *ColumnFamily) (bool, string, *CountMinSketch) {
 	var key string
 	cms := new(CountMinSketch)
 
@@ -160,29 +164,35 @@ func CountMinSketchGET(mem MemTable, lru *LRUCache, bucket *TokenBucket) (bool,
 	if key == "*" {
 		return false, key, nil
 	}
-	key = "CountMinSketch" + key
 	
-	found, data := GET(key, mem, lru, bucket)
-	if found {
+	data, err := cf.Get(key)
+	PrintError(err)
+	if err == nil {
 		cmsBytes := data.Value
-		cms = BytesToCountMinSketch(cmsBytes)
+		cms, err = BytesToCountMinSketch(cmsBytes)
+		if err != nil {
+			PrintError(err)
+			return false, key, nil
+		}
 		return true, key, cms
 	}
 	return false, key, nil
 
 }
 
-func CountMinSketchAddElement(cms *CountMinSketch) {
+// Vraca dodati element i da li je dodavanje uspelo
+func CountMinSketchAddElement(cms *CountMinSketch) ([]byte, bool) {
 	var val []byte
 
 	//unos
 	fmt.Println("Unesite podatak koji zelite da dodate: ")
 	val = GetValueInput()
 	if bytes.Compare(val, []byte("*")) == 0 { //ukoliko je zvezdica, izadji iz funkcije
-		return
+		return val, false
 	}
 	AddToCms(cms, val)
 	fmt.Println("Uspesno dodavanje")
+	return val, true
 }
 
 func CountMinSketchCheckFrequency(cms *CountMinSketch) {
@@ -201,24 +211,48 @@ func CountMinSketchCheckFrequency(cms *CountMinSketch) {
 	fmt.Println(freq)
 }
 
-func CountMinSketchPUT(key string, cms *CountMinSketch, mem MemTable, bucket *TokenBucket) {
-	bytesCms := CountMinSkechToBytes(cms)
-	PUT(key, bytesCms, mem, bucket)
-	fmt.Println("Uspesno dodavanje")
+// Upisuje CountMinSketch u bazu
+// Ukoliko je vec sacuvan upisuju se samo elementi dodati od poslednjeg upisa (kao merge operandi)
+// tako da se CountMinSketch u bazi ne cita i ne prepisuje ceo
+// Vraca da li je upis uspeo
+func CountMinSketchPUT(key string, cms *CountMinSketch, added [][]byte, stored bool, db *DB, cf *ColumnFamily) bool {
+	var err error
+	if stored {
+		batch := NewWriteBatch()
+		for _, elem := range added {
+			batch.MergeCF(cf, key, elem)
+		}
+		err = db.Write(batch)
+	} else {
+		bytesCms := CountMinSkechToBytes(cms)
+		err = cf.Put(key, bytesCms)
+	}
+	PrintError(err)
+	if err == nil {
+		fmt.Println("Uspesno dodavanje")
+	}
+	return err == nil
 }
 
-func CountMinSketchDELETE(key string, mem MemTable, lru *LRUCache, bucket *TokenBucket) {
-	DELETE(key, mem, lru, bucket)
+func CountMinSketchDELETE(key string, cf *ColumnFamily) error {
+	return cf.Delete(key)
 }
 
 
 
-func CountMinSKetchMenu(mem MemTable, lru *LRUCache, bucket *TokenBucket) {
+func CountMinSKetchMenu(db *DB) {
+	cf, err := db.ColumnFamily(COUNT_MIN_SKETCH_FAMILY)
+	if err != nil {
+		PrintError(err)
+		return
+	}
 	scanner := bufio.NewScanner(os.Stdin)
 	activeCMS := new(CountMinSketch)
 	var activeKey string //kljuc CMS-a
 	var userkey string //kljuc koji je korisnik uneo i koji se ispisuje korisniku
 	userkey = ""
+	stored := false            //da li je aktivni CMS vec sacuvan u bazi
+	added := make([][]byte, 0) //elementi dodati od poslednjeg upisa u bazu
 	for true {
 
 		fmt.Println("=======================================")
@@ -249,20 +283,24 @@ func CountMinSKetchMenu(mem MemTable, lru *LRUCache, bucket *TokenBucket) {
 
 		switch input {
 		case "1":
-			found, tempKey, tempCms := CreateCountMinSketch(mem, lru, bucket)
+			found, tempKey, tempCms, loaded := CreateCountMinSketch(cf)
 			if !found {
 				activeCMS = tempCms
 				activeKey = tempKey
-				userkey = activeKey[14:]
+				userkey = activeKey
+				stored = loaded
+				added = make([][]byte, 0)
 			}
 			
 		case "2":
-			found, key, tempCMS := CountMinSketchGET(mem, lru, bucket)
+			found, key, tempCMS := CountMinSketchGET(cf)
 			if key != "*" {
 				if found {
 					activeCMS = tempCMS
 					activeKey = key
-					userkey = activeKey[14:]
+					userkey = activeKey
+					stored = true
+					added = make([][]byte, 0)
 					fmt.Println("Uspesno dobavljanje")
 				} else {
 					fmt.Println("Ne postoji CountMinSKetch sa datim kljucem")
@@ -272,7 +310,10 @@ func CountMinSKetchMenu(mem MemTable, lru *LRUCache, bucket *TokenBucket) {
 		case "3":
 
 			if len(activeKey) != 0 {
-				CountMinSketchAddElement(activeCMS)
+				elem, ok := CountMinSketchAddElement(activeCMS)
+				if ok {
+					added = append(added, elem)
+				}
 			} else{
 				fmt.Println("Nije izabran aktivni CMS")
 			}
@@ -285,14 +326,21 @@ func CountMinSKetchMenu(mem MemTable, lru *LRUCache, bucket *TokenBucket) {
 			}
 		case "5":
 			if len(activeKey) != 0 {
-				CountMinSketchPUT(activeKey, activeCMS, mem, bucket)
+				if CountMinSketchPUT(activeKey, activeCMS, added, stored, db, cf) {
+					stored = true
+					added = make([][]byte, 0)
+				}
 			} else{
 				fmt.Println("Nije izabran aktivni CMS")
 			}
 		case "6":
 			if len(activeKey) != 0 {
-				CountMinSketchDELETE(activeKey, mem, lru, bucket)
-				fmt.Println("Uspesno brisanje")
+				err := CountMinSketchDELETE(activeKey, cf)
+				PrintError(err)
+				if err == nil {
+					stored = false
+					fmt.Println("Uspesno brisanje")
+				}
 			} else{
 				fmt.Println("Nije izabran aktivni CMS")
 			}
@@ -4,19 +4,17 @@ import (
 	"bufio"
 	"fmt"
 	"os"
+	. "project/keyvalue/engine"
 	. "project/keyvalue/structures/hll"
-	. "project/keyvalue/structures/least_reacently_used"
-	. "project/keyvalue/structures/memtable"
-	. "project/keyvalue/structures/token_bucket"
 	"strconv"
 	"strings"
 )
 
 // korisnik unosi kljuc i kreira se novi HLL
-func CreateHyperLogLog(mem MemTable, lru *LRUCache, bucket *TokenBucket) (bool, string, *HLL) {
+// poslednja povratna vrednost je true ukoliko je korisnik izabrao postojeci HLL iz baze
+func CreateHyperLogLog(cf *ColumnFamily) (bool, string, *HLL, bool) {
 	var input string //kljuc
 	hll := new(HLL)
-	var precision uint8
 	var tempInput string
 	scanner := bufio.NewScanner(os.Stdin)
 
@@ -24,11 +22,11 @@ func CreateHyperLogLog(mem MemTable, lru *LRUCache, bucket *TokenBucket) (bool,
 
 		input = GetKeyInput()
 		if input == "*" {
-			return true, input, nil
+			return true, input, nil, false
 		}
-		input = "HyperLogLog" + input
-		found, data := GET(input, mem, lru, bucket)
-		if found == true {
+		data, err := cf.Get(input)
+		PrintError(err)
+		if err == nil {
 			var choice string
 
 			for true {
@@ -46,13 +44,17 @@ func CreateHyperLogLog(mem MemTable, lru *LRUCache, bucket *TokenBucket) (bool,
 				}
 
 				if choice == "*" {
-					return true, input, nil
+					return true, input, nil, false
 				}
 
 				if choice == "1" {
-					hll = BytesToHyperLogLog(data.Value)
+					hll, err = BytesToHyperLogLog(data.Value)
+					if err != nil {
+						PrintError(err)
+						continue
+					}
 					fmt.Println("Uspesno dobavljanje")
-					return false, input, hll
+					return false, input, hll, true
 
 				} else if choice == "2" {
 
@@ -63,29 +65,33 @@ func CreateHyperLogLog(mem MemTable, lru *LRUCache, bucket *TokenBucket) (bool,
 
 						err := scanner.Err()
 						if tempInput == "*" {
-							return true, input, nil
+							return true, input, nil, false
 						}
 						if err != nil {
 							fmt.Println("Greska prilikom unosa: ", err)
 						} else if !IsNumeric(tempInput) {
 							fmt.Println("Molimo vas unesite broj.")
 						} else {
-							tempInt, _ := strconv.ParseUint(tempInput, 10, 8)
-							precision = uint8(tempInt)
-							break
+							tempInt, err := strconv.ParseUint(tempInput, 10, 8)
+							if err == nil {
+								hll, err = NewHLL(uint8(tempInt))
+							}
+							if err == nil {
+								break
+							}
+							fmt.Println("Preciznost mora biti izmedju", HLL_MIN_PRECISION, "i", HLL_MAX_PRECISION)
 						}
 
 					}
 
-					hll, _ = NewHLL(precision)
 					fmt.Println("Uspesno dodavanje")
-					return false, input, hll
+					return false, input, hll, false
 				} else {
 					fmt.Println("Molimo vas unesite 1 ili 2")
 				}
 			}
 
-			return true, input, nil
+			return true, input, nil, false
 		} else {
 
 			for true {
@@ -95,31 +101,34 @@ func CreateHyperLogLog(mem MemTable, lru *LRUCache, bucket *TokenBucket) (bool,
 
 				err := scanner.Err()
 				if tempInput == "*" {
-					return true, input, nil
+					return true, input, nil, false
 				}
 				if err != nil {
 					fmt.Println("Greska prilikom unosa")
 				} else if !IsNumeric(tempInput) {
 					fmt.Println("Molimo vas unesite broj.")
 				} else {
-					tempInt, _ := strconv.ParseUint(tempInput, 10, 8)
-					precision = uint8(tempInt)
-					break
-					
+					tempInt, err := strconv.ParseUint(tempInput, 10, 8)
+					if err == nil {
+						hll, err = NewHLL(uint8(tempInt))
+					}
+					if err == nil {
+						break
+					}
+					fmt.Println("Preciznost mora biti izmedju", HLL_MIN_PRECISION, "i", HLL_MAX_PRECISION)
 				}
 
 			}
-			hll, _ = NewHLL(precision)
 
 			break
 		}
 	}
 	fmt.Println()
 	fmt.Println("Uspesno dodavanje")
-	return false, input, hll
+	return false, input, hll, false
 }
 
-func GetHyperLogLog(mem MemTable, lru *LRUCache, bucket *TokenBucket) (bool, string, *HLL) {
+func GetHyperLogLog(cf *ColumnFamily) (bool, string, *HLL) {
 	var key string
 	hll := new(HLL)
 
@@ -128,19 +137,24 @@ func GetHyperLogLog(mem MemTable, lru *LRUCache, bucket *TokenBucket) (bool, str
 	if key == "*" {
 		return false, key, nil
 	}
-	key = "HyperLogLog" + key
 
-	found, data := GET(key, mem, lru, bucket)
-	if found {
+	data, err := cf.Get(key)
+	PrintError(err)
+	if err == nil {
 		hllBytes := data.Value
-		hll = BytesToHyperLogLog(hllBytes)
+		hll, err = BytesToHyperLogLog(hllBytes)
+		if err != nil {
+			PrintError(err)
+			return false, key, nil
+		}
 		fmt.Println("Uspesno dobavljanje")
 		return true, key, hll
 	}
 	return false, key, hll
 }
 
-func HyperLogLogAddElement(hll *HLL) {
+// Vraca dodati element i da li je dodavanje uspelo
+func HyperLogLogAddElement(hll *HLL) (string, bool) {
 	var val string
 	scanner := bufio.NewScanner(os.Stdin)
 	//unos
@@ -153,7 +167,7 @@ func HyperLogLogAddElement(hll *HLL) {
 		if err != nil {
 			fmt.Println("Greska prilikom unosa")
 		} else if val == "*" {
-			return
+			return val, false
 		} else {
 			break
 		}
@@ -161,6 +175,7 @@ func HyperLogLogAddElement(hll *HLL) {
 
 	hll.AddToHLL(val)
 	fmt.Println("Uspesno dodavanje")
+	return val, true
 }
 
 func HyperLogLogEstimate(hll *HLL) {
@@ -171,17 +186,41 @@ func HyperLogLogEstimate(hll *HLL) {
 
 }
 
-func HyperLogLogPUT(key string, hll *HLL, mem MemTable, bucket *TokenBucket) {
-	byteshll := HyperLogLogToBytes(hll)
-	PUT(key, byteshll, mem, bucket)
-	fmt.Println("Uspesno dodavanje")
+// Upisuje HyperLogLog u bazu
+// Ukoliko je vec sacuvan upisuju se samo elementi dodati od poslednjeg upisa (kao merge operandi)
+// tako da se HyperLogLog u bazi ne cita i ne prepisuje ceo
+// Vraca da li je upis uspeo
+func HyperLogLogPUT(key string, hll *HLL, added []string, stored bool, db *DB, cf *ColumnFamily) bool {
+	var err error
+	if stored {
+		batch := NewWriteBatch()
+		for _, elem := range added {
+			batch.MergeCF(cf, key, []byte(elem))
+		}
+		err = db.Write(batch)
+	} else {
+		byteshll := HyperLogLogToBytes(hll)
+		err = cf.Put(key, byteshll)
+	}
+	PrintError(err)
+	if err == nil {
+		fmt.Println("Uspesno dodavanje")
+	}
+	return err == nil
 }
 
-func HyperLogLogMenu(mem MemTable, lru *LRUCache, bucket *TokenBucket) {
+func HyperLogLogMenu(db *DB) {
+	cf, err := db.ColumnFamily(HYPER_LOG_LOG_FAMILY)
+	if err != nil {
+		PrintError(err)
+		return
+	}
 	activehll := new(HLL)
 	var activeKey string //kljuc HyperLogLog-a
 	var userkey string   //kljuc koji je korisnik uneo i koji se ispisuje korisniku
 	userkey = ""
+	stored := false            //da li je aktivni HyperLogLog vec sacuvan u bazi
+	added := make([]string, 0) //elementi dodati od poslednjeg upisa u bazu
 	scanner := bufio.NewScanner(os.Stdin)
 	for true {
 
@@ -212,20 +251,24 @@ func HyperLogLogMenu(mem MemTable, lru *LRUCache, bucket *TokenBucket) {
 		}
 		switch input {
 		case "1":
-			found, tempKey, temphll := CreateHyperLogLog(mem, lru, bucket)
+			found, tempKey, temphll, loaded := CreateHyperLogLog(cf)
 			if !found {
 				activehll = temphll
 				activeKey = tempKey
-				userkey = activeKey[11:]
+				userkey = activeKey
+				stored = loaded
+				added = make([]string, 0)
 			}
 
 		case "2":
-			found, key, temphll := GetHyperLogLog(mem, lru, bucket)
+			found, key, temphll := GetHyperLogLog(cf)
 			if key != "*" {
 				if found {
 					activehll = temphll
 					activeKey = key
-					userkey = activeKey[11:]
+					userkey = activeKey
+					stored = true
+					added = make([]string, 0)
 					fmt.Println("Uspesno dobavljanje")
 				} else {
 					fmt.Println("Ne postoji HyperLogLog sa datim kljucem")
@@ -235,7 +278,10 @@ func HyperLogLogMenu(mem MemTable, lru *LRUCache, bucket *TokenBucket) {
 		case "3":
 
 			if len(activeKey) != 0 {
-				HyperLogLogAddElement(activehll)
+				elem, ok := HyperLogLogAddElement(activehll)
+				if ok {
+					added = append(added, elem)
+				}
 			} else {
 				fmt.Println("Nije izabran aktivni HyperLogLog")
 			}
@@ -248,14 +294,21 @@ func HyperLogLogMenu(mem MemTable, lru *LRUCache, bucket *TokenBucket) {
 			}
 		case "5":
 			if len(activeKey) != 0 {
-				HyperLogLogPUT(activeKey, activehll, mem, bucket)
+				if HyperLogLogPUT(activeKey, activehll, added, stored, db, cf) {
+					stored = true
+					added = make([]string, 0)
+				}
 			} else {
 				fmt.Println("Nije izabran aktivni HyperLogLog")
 			}
 		case "6":
 			if len(activeKey) != 0 {
-				DELETE(activeKey, mem, lru, bucket)
-				fmt.Println("Uspesno brisanje")
+				err := cf.Delete(activeKey)
+				PrintError(err)
+				if err == nil {
+					stored = false
+					fmt.Println("Uspesno brisanje")
+				}
 			} else {
 				fmt.Println("Nije izabran aktivni HyperLogLog")
 
@@ -2,23 +2,49 @@ package menu_functions
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"math/rand"
 	"os"
-	. "project/keyvalue/structures/dataType"
-	. "project/keyvalue/structures/entry"
-	. "project/keyvalue/structures/least_reacently_used"
-	. "project/keyvalue/structures/lsm"
-	. "project/keyvalue/structures/memtable"
-	. "project/keyvalue/structures/scan"
-	. "project/keyvalue/structures/token_bucket"
-	. "project/keyvalue/structures/wal"
+	. "project/keyvalue/engine"
+	. "project/keyvalue/errs"
+	. "project/keyvalue/structures/merge_operator"
 	"regexp"
 	"strconv"
 	"strings"
 	"time"
 )
 
+//Ispisuje gresku ukoliko je operacija neuspesna iz nekog drugog razloga
+//osim nepostojanja kljuca (to svaki meni ispisuje na svoj nacin)
+func PrintError(err error) {
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		fmt.Println("Greska: ", err)
+	}
+}
+
+//Familije kolona u kojima meniji cuvaju verovatnosne strukture
+//(odvojene su od korisnickih kljuceva pa se ne pojavljuju u LIST i RANGE SCAN pretragama)
+const (
+	BLOOM_FILTER_FAMILY     = "BloomFilter"
+	COUNT_MIN_SKETCH_FAMILY = "CountMinSketch"
+	HYPER_LOG_LOG_FAMILY    = "HyperLogLog"
+	SIM_HASH_FAMILY         = "SimHash"
+)
+
+//Opcije familija iz menija, zadaju se pri otvaranju baze
+//Elementi dodati u HyperLogLog i CountMinSketch se upisuju kao merge operandi
+//pa se sacuvani sketch ne prepisuje ceo pri svakom upisu
+//Parametri operatora se koriste samo ukoliko sketch ne postoji u bazi
+func MenuColumnFamilies() map[string]*ColumnFamilyOptions {
+	return map[string]*ColumnFamilyOptions{
+		BLOOM_FILTER_FAMILY:     {},
+		COUNT_MIN_SKETCH_FAMILY: {MergeOperator: CountMinSketchAddOperator{Epsilon: 0.01, Delta: 0.01}},
+		HYPER_LOG_LOG_FAMILY:    {MergeOperator: HyperLogLogAddOperator{Precision: 10}},
+		SIM_HASH_FAMILY:         {},
+	}
+}
+
 //Ukoliko string ima samo cifre vraca true
 func IsNumeric(word string) bool{
 	return regexp.MustCompile(`\d`).MatchString(word)
@@ -34,17 +60,8 @@ func GetKeyInput() (string) {
 		key = strings.TrimSpace(scanner.Text())
 		err := scanner.Err()
 
-		//validacije rezervisanih reci
 		if err != nil {
 			fmt.Println("Greska prilikom unosa: ", err)
-		} else if strings.HasPrefix(key, "BloomFilter") {
-			fmt.Println("Upotrebili ste rezervisani prefix! Molimo vas unesite drugi kljuc.")
-		} else if strings.HasPrefix(key, "CountMinSketch") {
-			fmt.Println("Upotrebili ste rezervisani prefix! Molimo vas unesite drugi kljuc.")
-		} else if strings.HasPrefix(key, "HyperLogLog") {
-			fmt.Println("Upotrebili ste rezervisani prefix! Molimo vas unesite drugi kljuc.")
-		} else if strings.HasPrefix(key, "SimHash") {
-			fmt.Println("Upotrebili ste rezervisani prefix! Molimo vas unesite drugi kljuc.")
 		} else {
 			break
 		}
@@ -82,100 +99,8 @@ func GetUserInput() (string, []byte){
 
 }
 
-// ------------ WRITEPATH ------------
-// Upisuje podatak u bazu i vraca da li je operacija bila uspesna
-func PUT(key string, value []byte, memtable MemTable, bucket *TokenBucket) bool {
-	if !bucket.Take() {
-		return false
-	} 
-
-	//PRAVIMO DATA ZA UPIS
-	data:= new(Data)
-	data.Value = value
-	data.Timestamp = uint64(time.Now().Unix()) //upisuje se trenutno vreme
-	data.Tombstone = false
-
-	//UPISUJEMO U WAL
-	wal := NewWriteAheadLog("files/wal")
-	entry := NewEntry(key, data)
-	wal.WriteEntry(entry)
-
-	//UPISEMO U OM -> MEMTABLE
-	memtable.Put(key, data)
-
-	return true
-}
-
-//Logicko brisanje
-func DELETE(key string, memtable MemTable,lru *LRUCache, bucket *TokenBucket) bool {
-	if !bucket.Take() {
-		return false
-	} 
-	//UPISUJEMO U WAL kao obrisan
-	data:= new(Data)
-	data.Timestamp = uint64(time.Now().Unix())
-	data.Tombstone = true
-	data.Value = make([]byte, 0) //Posto je obrisan necemo cuvati vrednost
-
-	wal := NewWriteAheadLog("files/wal")
-	entry := NewEntry(key, data)
-	wal.WriteEntry(entry)
-
-
-	//Brisemo u memtable-u
-	//Ukoliko se ne nalazi u OM poslace se novi put zahtev automatski
-	memtable.Remove(key)
-
-	//Brisemo u cache-u
-	lru.Delete(key)
-
-	return true
-}
-
-// ------------ READPATH ------------
-// Cita podatak i ukoliko je uspesno citanje smesta ga u cache
-func GET(key string, memtable MemTable,lru *LRUCache, bucket *TokenBucket) (bool, *Data){
-	if !bucket.Take() {
-		return false, nil
-	} 
-
-	//1. Proveravamo memtable
-	found, data := memtable.Find(key)
-	if found{
-		if data.Tombstone == false{
-			//Dodajemo u cache
-			lru.Set(key, data)
-
-			return true, data
-		} else {
-			return false, nil
-		}
-	}
-
-	//2. Proveravamo Cache
-	found, data = lru.Get(key)
-	if found {
-		return true, data
-	}
-
-	//3. Proveravamo sstabele
-	lsm := ReadLsm()
-	found, data = lsm.Find(key)
-	if found{
-		if data.Tombstone == false{
-			//Dodajemo u cache
-			lru.Set(key, data)
-
-			return true, data
-		} else {
-			return false, nil
-		}
-	}
-	return false, nil
-}
-
 //Funkcija koja uzima unos korisnika i poziva RangeScan
-func InitiateRangeScan(mem MemTable, bucket *TokenBucket) {
+func InitiateRangeScan(db *DB) {
 	var minKey string
 	var maxKey string
 	var pageLen uint32
@@ -250,8 +175,10 @@ func InitiateRangeScan(mem MemTable, bucket *TokenBucket) {
 			break
 		}
 	}
-	found, keys, datas := RANGE_SCAN(minKey, maxKey, pageLen, pageNum, mem, bucket)
-	if found {
+	keys, datas, err := db.RangeScan(minKey, maxKey, pageLen, pageNum)
+	if err != nil {
+		PrintError(err)
+	} else if len(keys) > 0 {
 		fmt.Println("=======================================")
 		fmt.Println("========== REZULTAT PRETRAGE ==========")
 		fmt.Println("=======================================")
@@ -265,34 +192,8 @@ func InitiateRangeScan(mem MemTable, bucket *TokenBucket) {
 	}
 }
 
-// ------------ RANGE SCAN ------------
-// vraca niz kljuceva i niz podataka koji su u opsegu datog intervala
-// Vraca rezultate u opsegu od najnovijeg do najstarijeg
-// To postize tako sto iterira od najnovije do najstarije sstabele
-func RANGE_SCAN(minKey string, maxKey string, pageLen uint32, pageNum uint32, memtable MemTable, bucket *TokenBucket) (bool, []string, []*Data){
-	if !bucket.Take() {
-		return false, nil, nil
-	} 
-
-	lsm := ReadLsm()
-	scan := NewScan(pageLen, pageNum)
-
-	//Trazimo prvo u memtabeli
-	memtable.RangeScan(minKey, maxKey, scan)
-	if scan.FoundResults < scan.SelectedPageEnd{
-		//Trazimo u svim sstabelama i azuriramo scan nakon svakog poklapanja
-		lsm.RangeScan(minKey, maxKey, scan)
-	}
-
-	if len(scan.Keys) == 0{
-		return false, nil, nil
-	}
-
-	return true, scan.Keys, scan.Data
-}
-
 //Funkcija koja uzima unos korisnika i poziva ListScan
-func InitiateListScan(mem MemTable, bucket *TokenBucket) {
+func InitiateListScan(db *DB) {
 	var prefix string
 	var pageLen uint32
 	var pageNum uint32
@@ -350,8 +251,10 @@ func InitiateListScan(mem MemTable, bucket *TokenBucket) {
 			break
 		}
 	}
-	found, keys, datas := LIST_SCAN(prefix, pageLen, pageNum, mem, bucket)
-	if found {
+	keys, datas, err := db.ListScan(prefix, pageLen, pageNum)
+	if err != nil {
+		PrintError(err)
+	} else if len(keys) > 0 {
 		fmt.Println("=======================================")
 		fmt.Println("========== REZULTAT PRETRAGE ==========")
 		fmt.Println("=======================================")
@@ -365,30 +268,96 @@ func InitiateListScan(mem MemTable, bucket *TokenBucket) {
 	}
 }
 
-// ------------ LIST SCAN ------------
-// vraca niz kljuceva i niz podataka koji pocinju datim prefiksom
-// Vraca rezultate u opsegu od najnovijeg do najstarijeg
-// To postize tako sto iterira od najnovije do najstarije sstabele
-func LIST_SCAN(prefix string, pageLen uint32, pageNum uint32, memtable MemTable, bucket *TokenBucket) (bool, []string, []*Data){
-	if !bucket.Take() {
-		return false, nil, nil
-	} 
-	
-	lsm := ReadLsm()
-	scan := NewScan(pageLen, pageNum)
-
-	//Trazimo prvo u memtabeli
-	memtable.ListScan(prefix, scan)
-	if scan.FoundResults < scan.SelectedPageEnd{
-		//Trazimo u svim sstabelama i azuriramo scan nakon svakog poklapanja
-		lsm.ListScan(prefix, scan)
+//Funkcija koja uzima unos korisnika i brise sve kljuceve od pocetnog (ukljucujuci) do krajnjeg (iskljucujuci)
+func InitiateDeleteRange(db *DB) {
+	var startKey string
+	var endKey string
+
+	for true {
+		fmt.Println("Unesite pocetni kljuc: ")
+		n, err := fmt.Scanln(&startKey)
+		if startKey == "*" {
+			return
+		}
+
+		if err != nil {
+			fmt.Println("Greska prilikom unosa: ", err)
+		} else if n == 0 {
+			fmt.Println("Prazan unos.  Molimo vas probajte opet.")
+		} else {
+			break
+		}
 	}
+	for true {
+		fmt.Println("Unesite krajnji kljuc (ne brise se): ")
+		n, err := fmt.Scanln(&endKey)
+		if endKey == "*" {
+			return
+		}
 
-	if len(scan.Keys) == 0{
-		return false, nil, nil
+		if err != nil {
+			fmt.Println("Greska prilikom unosa: ", err)
+		} else if n == 0 {
+			fmt.Println("Prazan unos.  Molimo vas probajte opet.")
+		} else {
+			break
+		}
 	}
+	err := db.DeleteRange(startKey, endKey)
+	if err == nil {
+		fmt.Println("Uspesno brisanje opsega")
+	} else if errors.Is(err, ErrInvalidRange) {
+		fmt.Println("Pocetni kljuc mora biti manji od krajnjeg")
+	} else if errors.Is(err, ErrRateLimited) {
+		fmt.Println("Zahtev je odbijen, pokusajte ponovo")
+	} else {
+		PrintError(err)
+	}
+}
 
-	return true, scan.Keys, scan.Data
+//Funkcija koja uzima unos korisnika i kompaktuje sstabele iz opsega do poslednjeg nivoa
+func InitiateCompactRange(db *DB) {
+	var minKey string
+	var maxKey string
+
+	for true {
+		fmt.Println("Unesite najmanji kljuc: ")
+		n, err := fmt.Scanln(&minKey)
+		if minKey == "*" {
+			return
+		}
+
+		if err != nil {
+			fmt.Println("Greska prilikom unosa: ", err)
+		} else if n == 0 {
+			fmt.Println("Prazan unos.  Molimo vas probajte opet.")
+		} else {
+			break
+		}
+	}
+	for true {
+		fmt.Println("Unesite najveci kljuc: ")
+		n, err := fmt.Scanln(&maxKey)
+		if maxKey == "*" {
+			return
+		}
+
+		if err != nil {
+			fmt.Println("Greska prilikom unosa: ", err)
+		} else if n == 0 {
+			fmt.Println("Prazan unos.  Molimo vas probajte opet.")
+		} else {
+			break
+		}
+	}
+	err := db.CompactRange(minKey, maxKey)
+	if err == nil {
+		fmt.Println("Uspesna kompakcija opsega")
+	} else if errors.Is(err, ErrInvalidRange) {
+		fmt.Println("Najmanji kljuc ne sme biti veci od najveceg")
+	} else {
+		PrintError(err)
+	}
 }
 
 func TimestampToTime(timestamp uint64) time.Time {
@@ -418,7 +387,7 @@ func RandomString(length int) string {
 
 
 // ---------- GENERATOR ----------
-func GenerateEntries(memtable MemTable, bucket *TokenBucket){
+func GenerateEntries(db *DB){
 	scanner := bufio.NewScanner(os.Stdin)
 	num := 0
 	for true{
@@ -443,8 +412,11 @@ func GenerateEntries(memtable MemTable, bucket *TokenBucket){
 		value := []byte(RandomString(5))
 		key := RandomString(5)
 		
-		if !PUT(key,value,memtable,bucket){
+		err := db.Put(key, value)
+		if errors.Is(err, ErrRateLimited){
 			fmt.Println("NAPAD")
+		} else if err != nil {
+			PrintError(err)
 		} else {
 			fmt.Println("PROSLO ", i+1)
 		}
@@ -453,3 +425,23 @@ func GenerateEntries(memtable MemTable, bucket *TokenBucket){
 	fmt.Println("----------- KRAJ GENERISANJA -----------")
 }
 
+// ---------- STATISTIKE ----------
+func PrintStats(db *DB) {
+	stats, err := db.Stats()
+	if err != nil {
+		PrintError(err)
+		return
+	}
+	fmt.Println("=======================================")
+	fmt.Println("Stanje upisa: ", stats.WriteStall)
+	if stats.StalledFor > 0 {
+		fmt.Println("Upisi su ograniceni vec: ", stats.StalledFor)
+	}
+	fmt.Println("Ukupno cekanje upisa: ", stats.StallDuration)
+	fmt.Println("Usporenih upisa: ", stats.DelayedWrites)
+	fmt.Println("Zaustavljenih upisa: ", stats.StoppedWrites)
+	fmt.Println("Sstabela u prvom nivou: ", stats.Level1Tables)
+	fmt.Println("Bajtova koji cekaju kompakciju: ", stats.PendingCompactionBytes)
+	fmt.Println("Izbacenih tombstone-ova: ", stats.DroppedTombstones)
+	fmt.Println("=======================================")
+}
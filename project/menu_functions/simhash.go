@@ -4,36 +4,35 @@ import (
 	"bufio"
 	"fmt"
 	"os"
+	. "project/keyvalue/engine"
 	. "project/keyvalue/structures/dataType"
-	. "project/keyvalue/structures/least_reacently_used"
-	. "project/keyvalue/structures/memtable"
 	. "project/keyvalue/structures/simhash"
-	. "project/keyvalue/structures/token_bucket"
 	"strings"
 )
 
 //Generise i upisuje u bazu podataka binarni kod
-func SimHashGenerateBinaryHash(mem MemTable, lru *LRUCache, bucket *TokenBucket) {
+func SimHashGenerateBinaryHash(cf *ColumnFamily) {
 	var value []byte
 
 	key := GetKeyInput()
 	if key != "*" {
-		key = "SimHash" + key
 		value = GetValueInput()
 	
 		binaryHash := HashText(GenerateWeightedMap(value))
 		binaryBytes := BinaryHashToByte(binaryHash)
-		PUT(key, binaryBytes, mem, bucket)
-		fmt.Println("Uspesan upis.")
+		err := cf.Put(key, binaryBytes)
+		PrintError(err)
+		if err == nil {
+			fmt.Println("Uspesan upis.")
+		}
 	}
 
 }
 
 //Ukoliko se kljucevi nalaze u datoteci poredi ih i vraca hemingovo rastojanje izmedju vrednosti
-func SimHashCompare(mem MemTable, lru *LRUCache, bucket *TokenBucket) {
-	var found1 bool
+func SimHashCompare(cf *ColumnFamily) {
+	var err error
 	data1 := new(Data)
-	var found2 bool
 	data2 := new(Data)
 	fmt.Println("Unesite prvi pa zatim drugi kljuc")
 	fmt.Println("Kljuc 1 : ")
@@ -43,11 +42,11 @@ func SimHashCompare(mem MemTable, lru *LRUCache, bucket *TokenBucket) {
 		if key1 == "*" {
 			return
 		}
-		key1 = "SimHash" + key1
 
-		found1, data1 = GET(key1, mem, lru, bucket)
+		data1, err = cf.Get(key1)
+		PrintError(err)
 
-		if found1 == false {
+		if err != nil {
 			fmt.Println("Kljuc 1 se ne nalazi u bazi podataka.")
 		} else {
 			break
@@ -60,11 +59,11 @@ func SimHashCompare(mem MemTable, lru *LRUCache, bucket *TokenBucket) {
 		if key2 == "*" {
 			return
 		}
-		key2 = "SimHash" + key2
 
-		found2, data2 = GET(key2, mem, lru, bucket)
+		data2, err = cf.Get(key2)
+		PrintError(err)
 
-		if found2 == false {
+		if err != nil {
 			fmt.Println("Kljuc 2 se ne nalazi u bazi podataka.")
 		} else {
 			break
@@ -78,7 +77,12 @@ func SimHashCompare(mem MemTable, lru *LRUCache, bucket *TokenBucket) {
 }
 
 
-func SimHashMenu(mem MemTable, lru *LRUCache, bucket *TokenBucket) {
+func SimHashMenu(db *DB) {
+	cf, err := db.ColumnFamily(SIM_HASH_FAMILY)
+	if err != nil {
+		PrintError(err)
+		return
+	}
 	scanner := bufio.NewScanner(os.Stdin)
 	for true {
 
@@ -101,17 +105,19 @@ func SimHashMenu(mem MemTable, lru *LRUCache, bucket *TokenBucket) {
 		
 		switch input {
 		case "1":
-			SimHashGenerateBinaryHash(mem, lru, bucket)
+			SimHashGenerateBinaryHash(cf)
 
 
 		case "2":
-			SimHashCompare(mem, lru, bucket)
+			SimHashCompare(cf)
 		case "3":
 			key := GetKeyInput()
 			if key != "*" {
-				key = "SimHash" + key
-				DELETE(key, mem, lru, bucket)
-				fmt.Println("Uspesno brisanje")
+				err := cf.Delete(key)
+				PrintError(err)
+				if err == nil {
+					fmt.Println("Uspesno brisanje")
+				}
 			}
 
 		case "x":
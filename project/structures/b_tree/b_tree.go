@@ -3,7 +3,6 @@ package b_tree
 import (
 	"fmt"
 	. "project/keyvalue/structures/dataType"
-	. "project/keyvalue/structures/scan"
 	"strings"
 )
 
@@ -345,106 +344,6 @@ func (bTree *BTree) InorderTraverse(node *BTreeNode, keys *[]string, Values *[]*
 	}
 }
 
-func (bTree *BTree) RangeScan(minKey string, maxKey string,node *BTreeNode, scan *Scan) {
-	if node == nil {
-		return
-	}
-	if scan.FoundResults >= scan.SelectedPageEnd{
-		return
-	}
-	for i := 0; i < len(node.children)-1; i++ {
-		bTree.RangeScan(minKey, maxKey, node.children[i], scan)
-		if i < len(node.keys) {
-			if node.keys[i] >= minKey && node.keys[i] <= maxKey{
-				if !node.Values[node.keys[i]].Tombstone{
-					//Obelezimo dati kljuc da je procitan
-					scan.SelectedKeys[node.keys[i]] = true
-
-					scan.FoundResults++
-					if scan.FoundResults >= scan.SelectedPageStart && scan.FoundResults <= scan.SelectedPageEnd{
-						scan.Keys = append(scan.Keys, node.keys[i])
-						scan.Data = append(scan.Data, node.Values[node.keys[i]])
-					}
-				} else {
-					//Posto je obrisan oznacicemo ga kao obrisanog da se ne uzima u obzir dalje
-					scan.RemovedKeys[node.keys[i]] = true
-				}
-			}
-		}
-	}
-	if len(node.children) > 0 {
-		bTree.RangeScan(minKey, maxKey, node.children[len(node.children)-1], scan)
-	} else {
-		for i := 0; i < len(node.keys); i++ {
-			if node.keys[i] >= minKey && node.keys[i] <= maxKey{
-				if !node.Values[node.keys[i]].Tombstone{
-					//Obelezimo dati kljuc da je procitan
-					scan.SelectedKeys[node.keys[i]] = true
-
-					scan.FoundResults++
-					if scan.FoundResults >= scan.SelectedPageStart && scan.FoundResults <= scan.SelectedPageEnd{
-						scan.Keys = append(scan.Keys, node.keys[i])
-						scan.Data = append(scan.Data, node.Values[node.keys[i]])
-					}
-				} else {
-					//Posto je obrisan oznacicemo ga kao obrisanog da se ne uzima u obzir dalje
-					scan.RemovedKeys[node.keys[i]] = true
-				}
-			}
-		}
-	}
-}
-
-func (bTree *BTree) ListScan(prefix string,node *BTreeNode, scan *Scan) {
-	if node == nil {
-		return
-	}
-	if scan.FoundResults >= scan.SelectedPageEnd{
-		return
-	}
-	for i := 0; i < len(node.children)-1; i++ {
-		bTree.ListScan(prefix, node.children[i], scan)
-		if i < len(node.keys) {
-			if strings.HasPrefix(node.keys[i], prefix){
-				if !node.Values[node.keys[i]].Tombstone{
-					//Obelezimo dati kljuc da je procitan
-					scan.SelectedKeys[node.keys[i]] = true
-
-					scan.FoundResults++
-					if scan.FoundResults >= scan.SelectedPageStart && scan.FoundResults <= scan.SelectedPageEnd{
-						scan.Keys = append(scan.Keys, node.keys[i])
-						scan.Data = append(scan.Data, node.Values[node.keys[i]])
-					}
-				} else {
-					//Posto je obrisan oznacicemo ga kao obrisanog da se ne uzima u obzir dalje
-					scan.RemovedKeys[node.keys[i]] = true
-				}
-			}
-		}
-	}
-	if len(node.children) > 0 {
-		bTree.ListScan(prefix, node.children[len(node.children)-1], scan)
-	} else {
-		for i := 0; i < len(node.keys); i++ {
-			if strings.HasPrefix(node.keys[i], prefix){
-				if !node.Values[node.keys[i]].Tombstone{
-					//Obelezimo dati kljuc da je procitan
-					scan.SelectedKeys[node.keys[i]] = true
-
-					scan.FoundResults++
-					if scan.FoundResults >= scan.SelectedPageStart && scan.FoundResults <= scan.SelectedPageEnd{
-						scan.Keys = append(scan.Keys, node.keys[i])
-						scan.Data = append(scan.Data, node.Values[node.keys[i]])
-					}
-				} else {
-					//Posto je obrisan oznacicemo ga kao obrisanog da se ne uzima u obzir dalje
-					scan.RemovedKeys[node.keys[i]] = true
-				}
-			}
-		}
-	}
-}
-
 // Ispis b stabla
 func (t *BTree) PrintBTree() {
 	var queue []*BTreeNode
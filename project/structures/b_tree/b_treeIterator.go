@@ -0,0 +1,69 @@
+package b_tree
+
+import (
+	. "project/keyvalue/structures/dataType"
+	"sort"
+)
+
+// Iterator kroz b stablo
+// Pri kreiranju se kljucevi obilaze inorder i pamte redom, pa se dalje krece po indeksu
+// (b stablo u memtabeli je malo, a ovako nisu potrebni pokazivaci na susedne cvorove)
+// Vrednost je najnovija verzija kljuca (starije su u lancu Data.Older)
+type BTreeIterator struct {
+	keys     []string
+	values   []*Data
+	position int
+}
+
+func (bTree *BTree) NewIterator() *BTreeIterator {
+	it := new(BTreeIterator)
+	it.keys = make([]string, 0)
+	it.values = make([]*Data, 0)
+	bTree.InorderTraverse(bTree.Root, &it.keys, &it.values)
+	it.position = len(it.keys)
+	return it
+}
+
+func (it *BTreeIterator) Seek(key string) {
+	it.position = sort.SearchStrings(it.keys, key)
+}
+
+func (it *BTreeIterator) SeekToFirst() {
+	it.position = 0
+}
+
+func (it *BTreeIterator) SeekToLast() {
+	it.position = len(it.keys) - 1
+}
+
+func (it *BTreeIterator) Next() {
+	if it.Valid() {
+		it.position++
+	}
+}
+
+func (it *BTreeIterator) Prev() {
+	if it.Valid() {
+		it.position--
+	}
+}
+
+func (it *BTreeIterator) Valid() bool {
+	return it.position >= 0 && it.position < len(it.keys)
+}
+
+func (it *BTreeIterator) Key() string {
+	return it.keys[it.position]
+}
+
+func (it *BTreeIterator) Value() *Data {
+	return it.values[it.position]
+}
+
+func (it *BTreeIterator) Err() error {
+	return nil
+}
+
+func (it *BTreeIterator) Close() error {
+	return nil
+}
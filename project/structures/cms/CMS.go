@@ -3,7 +3,9 @@ package cms
 import (
 	"bytes"
 	"encoding/binary"
-	"log"
+	"errors"
+	"fmt"
+	"io"
 	"math"
 )
 
@@ -100,44 +102,49 @@ func CountMinSkechToBytes(cms *CountMinSketch) []byte {
 }
 
 //Pretvara bajtove u cms
-func BytesToCountMinSketch(CmsBytes []byte) *CountMinSketch {
+func BytesToCountMinSketch(CmsBytes []byte) (*CountMinSketch, error) {
 	cms := new(CountMinSketch)
 	reader := bytes.NewReader(CmsBytes)
 	bytes := make([]byte, 4)
 
 	//Ucitavamo podatke tipa uint32
-	_, err := reader.Read(bytes)
+	_, err := io.ReadFull(reader, bytes)
 	if err != nil {
-		log.Fatal(err)
+		return nil, errors.New("neispravan CountMinSketch: nedostaje broj hash funkcija")
 	}
 	cms.K = binary.BigEndian.Uint32(bytes)
 
 	bytes = make([]byte, 4)
-	_, err = reader.Read(bytes)
+	_, err = io.ReadFull(reader, bytes)
 	if err != nil {
-		log.Fatal(err)
+		return nil, errors.New("neispravan CountMinSketch: nedostaje broj kolona")
 	}
 	cms.M = binary.BigEndian.Uint32(bytes)
 
 	//ucitavamo podatke tipa float64
 	bytes = make([]byte, 8)
-	_, err = reader.Read(bytes)
+	_, err = io.ReadFull(reader, bytes)
 	if err != nil {
-		log.Fatal(err)
+		return nil, errors.New("neispravan CountMinSketch: nedostaje preciznost")
 	}
 	bitsEpsilon := binary.BigEndian.Uint64(bytes)
 	floatEpsilon := math.Float64frombits(bitsEpsilon)
 	cms.Epsilon = floatEpsilon
 
 	bytes = make([]byte, 8)
-	_, err = reader.Read(bytes)
+	_, err = io.ReadFull(reader, bytes)
 	if err != nil {
-		log.Fatal(err)
+		return nil, errors.New("neispravan CountMinSketch: nedostaje sigurnost")
 	}
 	bitsDelta := binary.BigEndian.Uint64(bytes)
 	floatDelta := math.Float64frombits(bitsDelta)
 	cms.Delta = floatDelta
 
+	//ValueTable i duzine hash funkcija moraju stati u preostale bajtove (pre alociranja tabele)
+	if uint64(cms.K)*(uint64(cms.M)+1)*4 > uint64(reader.Len()) {
+		return nil, fmt.Errorf("neispravan CountMinSketch: %d x %d tabela ne staje u %d bajtova", cms.K, cms.M, reader.Len())
+	}
+
 	//kreiramo ValueTable
 	cms.ValueTable = make([][]uint32, cms.K)
 	for i := range cms.ValueTable {
@@ -147,9 +154,9 @@ func BytesToCountMinSketch(CmsBytes []byte) *CountMinSketch {
 	for i:= 0; i < int(cms.K); i++ {
 		for j:= 0; j < int(cms.M); j++ {
 			bytes := make([]byte, 4)
-			_, err = reader.Read(bytes)
+			_, err = io.ReadFull(reader, bytes)
 			if err != nil {
-				log.Fatal(err)
+				return nil, errors.New("neispravan CountMinSketch: nedostaju vrednosti tabele")
 			}
 			cms.ValueTable[i][j] = binary.BigEndian.Uint32(bytes)
 		}
@@ -161,20 +168,23 @@ func BytesToCountMinSketch(CmsBytes []byte) *CountMinSketch {
 	for i := uint32(0); i < cms.K; i++ {
 		//Ucitavamo duzinu trenutne hf
 		bytes = make([]byte, 4)
-		_, err = reader.Read(bytes)
+		_, err = io.ReadFull(reader, bytes)
 		if err != nil {
-			log.Fatal(err)
+			return nil, errors.New("neispravan CountMinSketch: nedostaje duzina hash funkcije")
 		}
 		hashFuncLen := binary.BigEndian.Uint32(bytes)
+		if uint64(hashFuncLen) > uint64(reader.Len()) {
+			return nil, errors.New("neispravan CountMinSketch: nedostaje hash funkcija")
+		}
 
 		//citamo hf
 		bytes = make([]byte, hashFuncLen)
-		_, err = reader.Read(bytes)
+		_, err = io.ReadFull(reader, bytes)
 		if err != nil {
-			log.Fatal(err)
+			return nil, errors.New("neispravan CountMinSketch: nedostaje hash funkcija")
 		}
 		hashWithSeed.Seed = bytes
 		cms.HashFuncs = append(cms.HashFuncs, *hashWithSeed)
 	}
-	return cms
+	return cms, nil
 }
@@ -2,13 +2,22 @@ package dataType
 
 import (
 	"fmt"
+	"math"
 	"time"
 )
 
+// Redni broj kojim se citaju najnoviji podaci (vidi sve upise)
+const LATEST_SEQ = uint64(math.MaxUint64)
+
 type Data struct {
-	Value     []byte
-	Tombstone bool
-	Timestamp uint64
+	Value       []byte
+	Tombstone   bool
+	Timestamp   uint64 //Vreme upisa, cuva se samo kao informacija
+	Seq         uint64 //Redni broj upisa u bazi, na osnovu njega se odredjuje koja verzija je novija
+	Expiry      uint64 //Vreme isteka u Unix nanosekundama, nakon njega se podatak smatra obrisanim (0 - nikad ne istice)
+	Operand     bool   //Vrednost je operand merge operatora koji se spaja sa prethodnom verzijom kljuca
+	RangeDelete bool   //Brisanje opsega od kljuca do vrednosti (vidi rangeTombstone.go), ne cuva se kao verzija kljuca
+	Older       *Data  //Starija verzija istog kljuca koja se cuva dok je potrebna nekom snapshot-u ili operandu (ne zapisuje se)
 }
 
 func NewData(val []byte, tombstone bool, timestamp uint64) *Data {
@@ -19,8 +28,30 @@ func NewData(val []byte, tombstone bool, timestamp uint64) *Data {
 	return data
 }
 
+// Vraca najnoviju verziju iz lanca koja je upisana najkasnije sa datim rednim brojem
+// Ukoliko takva verzija ne postoji vraca nil
+func (data *Data) Visible(seq uint64) *Data {
+	for data != nil && data.Seq > seq {
+		data = data.Older
+	}
+	return data
+}
+
+// Da li je podatku isteklo vreme trajanja
+func (data *Data) Expired() bool {
+	return data.Expiry != 0 && uint64(time.Now().UnixNano()) >= data.Expiry
+}
+
+// Da li se podatak smatra obrisanim (logicki obrisan ili mu je isteklo vreme trajanja)
+func (data *Data) Deleted() bool {
+	return data.Tombstone || data.Expired()
+}
+
 func (data *Data) Print() {
 	fmt.Println("------------ DATA ------------")
 	fmt.Println("Vrednost: " , string(data.Value))
 	fmt.Println("Vreme dodavanja: " , time.Unix(int64(data.Timestamp), 0))
-}
\ No newline at end of file
+	if data.Expiry != 0 {
+		fmt.Println("Vreme isteka: " , time.Unix(0, int64(data.Expiry)))
+	}
+}
@@ -0,0 +1,69 @@
+package dataType
+
+//Brisanje opsega kljuceva (range tombstone)
+//Jednim zapisom brise sve kljuceve k za koje je Start <= k < End
+//Sakriva samo verzije upisane pre njega (sa manjim rednim brojem upisa), pa kasniji upisi u opseg ostaju vidljivi
+//U WAL-u i sstabeli se zapisuje kao podatak sa RangeDelete=true ciji je kljuc Start, a vrednost End
+
+type RangeTombstone struct {
+	Start     string
+	End       string
+	Seq       uint64
+	Timestamp uint64
+}
+
+// Pravi brisanje opsega od podatka sa RangeDelete=true i kljuca pod kojim je zapisan
+func NewRangeTombstone(start string, data *Data) *RangeTombstone {
+	tombstone := new(RangeTombstone)
+	tombstone.Start = start
+	tombstone.End = string(data.Value)
+	tombstone.Seq = data.Seq
+	tombstone.Timestamp = data.Timestamp
+	return tombstone
+}
+
+// Pretvara brisanje opsega u podatak za zapis (kljuc zapisa je Start)
+func (tombstone *RangeTombstone) ToData() *Data {
+	data := NewData([]byte(tombstone.End), false, tombstone.Timestamp)
+	data.Seq = tombstone.Seq
+	data.RangeDelete = true
+	return data
+}
+
+// Da li opseg sadrzi kljuc
+func (tombstone *RangeTombstone) Contains(key string) bool {
+	return key >= tombstone.Start && key < tombstone.End
+}
+
+// Da li se opseg preklapa sa opsegom kljuceva [min, max]
+func (tombstone *RangeTombstone) Overlaps(min string, max string) bool {
+	return tombstone.Start <= max && min < tombstone.End
+}
+
+// Vraca deo opsega koji pada u [min, max), prazna granica znaci da opseg s te strane nije ogranicen
+// Ukoliko takav deo ne postoji vraca nil
+func (tombstone *RangeTombstone) Clip(min string, max string) *RangeTombstone {
+	clipped := *tombstone
+	if min != "" && clipped.Start < min {
+		clipped.Start = min
+	}
+	if max != "" && clipped.End > max {
+		clipped.End = max
+	}
+	if clipped.Start >= clipped.End {
+		return nil
+	}
+	return &clipped
+}
+
+// Vraca najveci redni broj upisa medju brisanjima opsega koja sadrze kljuc i vidljiva su za dati redni broj upisa
+// Verzije kljuca sa manjim rednim brojem su obrisane (0 ukoliko kljuc nije obrisan nijednim brisanjem opsega)
+func CoveringSeq(tombstones []*RangeTombstone, key string, seq uint64) uint64 {
+	covering := uint64(0)
+	for _, tombstone := range tombstones {
+		if tombstone.Seq <= seq && tombstone.Seq > covering && tombstone.Contains(key) {
+			covering = tombstone.Seq
+		}
+	}
+	return covering
+}
@@ -4,8 +4,8 @@ import (
 	"encoding/binary"
 	"hash/crc32"
 	"io"
-	"log"
 	"os"
+	. "project/keyvalue/errs"
 	. "project/keyvalue/structures/dataType"
 )
 
@@ -13,6 +13,8 @@ import (
 type Entry struct {
 	Crc        []byte
 	Timestamp  []byte
+	Seq        []byte
+	Expiry     []byte
 	Tombstone  []byte
 	Key_size   []byte
 	Value_size []byte
@@ -23,16 +25,30 @@ type Entry struct {
 const (
 	CRC_SIZE        = 4
 	TIMESTAMP_SIZE  = 8
+	SEQ_SIZE        = 8
+	EXPIRY_SIZE     = 8
 	TOMBSTONE_SIZE  = 1
 	KEY_SIZE_SIZE   = 8
 	VALUE_SIZE_SIZE = 8
 
 	CRC_START        = 0
 	TIMESTAMP_START  = CRC_START + CRC_SIZE //4
-	TOMBSTONE_START  = TIMESTAMP_START + TIMESTAMP_SIZE //12
-	KEY_SIZE_START   = TOMBSTONE_START + TOMBSTONE_SIZE //13
-	VALUE_SIZE_START = KEY_SIZE_START + KEY_SIZE_SIZE //21
-	KEY_START        = VALUE_SIZE_START + VALUE_SIZE_SIZE //29
+	SEQ_START        = TIMESTAMP_START + TIMESTAMP_SIZE //12
+	EXPIRY_START     = SEQ_START + SEQ_SIZE //20
+	TOMBSTONE_START  = EXPIRY_START + EXPIRY_SIZE //28
+	KEY_SIZE_START   = TOMBSTONE_START + TOMBSTONE_SIZE //29
+	VALUE_SIZE_START = KEY_SIZE_START + KEY_SIZE_SIZE //37
+	KEY_START        = VALUE_SIZE_START + VALUE_SIZE_SIZE //45
+)
+
+// Vrste zapisa, cuvaju se u Tombstone bajtu
+const (
+	TYPE_VALUE     = uint8(0) //obican upis
+	TYPE_TOMBSTONE = uint8(1) //logicki obrisan podatak
+	TYPE_BATCH     = uint8(2) //WAL zapis koji u vrednosti sadrzi vise zapisa (WriteBatch)
+	TYPE_MERGE     = uint8(3) //operand koji se merge operatorom spaja sa prethodnom vrednoscu kljuca
+	TYPE_FAMILY    = uint8(4) //WAL zapis koji u vrednosti sadrzi jedan zapis familije kolona ciji je naziv kljuc
+	TYPE_RANGE     = uint8(5) //brisanje opsega od kljuca (ukljucen) do vrednosti (iskljucena)
 )
 
 func CRC32(data []byte) uint32 {
@@ -55,33 +71,166 @@ func NewEntry(key string, data *Data) *Entry {
 	e.Value = data.Value
 	e.Timestamp = make([]byte, 8)
 	binary.BigEndian.PutUint64(e.Timestamp, data.Timestamp)
+	e.Seq = make([]byte, 8)
+	binary.BigEndian.PutUint64(e.Seq, data.Seq)
+	e.Expiry = make([]byte, 8)
+	binary.BigEndian.PutUint64(e.Expiry, data.Expiry)
 
 	tombstoneBytes := make([]byte, 0)
 	if data.Tombstone {
-		tombstoneBytes = append(tombstoneBytes, uint8(1))
+		tombstoneBytes = append(tombstoneBytes, TYPE_TOMBSTONE)
+	} else if data.RangeDelete {
+		tombstoneBytes = append(tombstoneBytes, TYPE_RANGE)
+	} else if data.Operand {
+		tombstoneBytes = append(tombstoneBytes, TYPE_MERGE)
 	} else {
-		tombstoneBytes = append(tombstoneBytes, uint8(0))
+		tombstoneBytes = append(tombstoneBytes, TYPE_VALUE)
 	}
 	e.Tombstone = tombstoneBytes
 
+	e.Crc = make([]byte, 4)
+	binary.BigEndian.PutUint32(e.Crc, e.computeCrc())
+	return e
+}
+
+// Pravi jedan WAL zapis od vise zapisa
+// Zapisi se smestaju jedan za drugim u vrednost, a CRC spoljnog zapisa pokriva sve njih
+// tako da se pri oporavku batch primenjuje ceo ili se odbacuje ceo
+// Redni broj batch-a je redni broj njegovog poslednjeg zapisa
+func NewBatchEntry(entries []*Entry, timestamp uint64) *Entry {
+	value := make([]byte, 0)
+	for _, entry := range entries {
+		value = append(value, EntryToBytes(entry)...)
+	}
+
+	e := new(Entry)
+	e.Key = make([]byte, 0)
+	e.Value = value
+	e.Key_size = make([]byte, 8)
+	e.Value_size = make([]byte, 8)
+	binary.BigEndian.PutUint64(e.Value_size, uint64(len(value)))
+	e.Timestamp = make([]byte, 8)
+	binary.BigEndian.PutUint64(e.Timestamp, timestamp)
+	e.Seq = make([]byte, 8)
+	if len(entries) > 0 {
+		e.Seq = entries[len(entries)-1].Seq
+	}
+	e.Expiry = make([]byte, 8)
+	e.Tombstone = []byte{TYPE_BATCH}
+
+	e.Crc = make([]byte, 4)
+	binary.BigEndian.PutUint32(e.Crc, e.computeCrc())
+	return e
+}
+
+// Racuna CRC nad svim poljima osim samog CRC-a
+func (e *Entry) computeCrc() uint32 {
 	//ubaci sve u niz bajtova da bi napravio Crc
 	bytes := make([]byte, 0)
 	bytes = append(bytes, e.Timestamp...)
+	bytes = append(bytes, e.Seq...)
+	bytes = append(bytes, e.Expiry...)
 	bytes = append(bytes, e.Tombstone...)
 	bytes = append(bytes, e.Key_size...)
 	bytes = append(bytes, e.Value_size...)
 	bytes = append(bytes, e.Key...)
 	bytes = append(bytes, e.Value...)
+	return CRC32(bytes)
+}
+
+// Proverava da li se zapisani CRC poklapa sa sadrzajem
+func (e *Entry) CheckCrc() bool {
+	return binary.BigEndian.Uint32(e.Crc) == e.computeCrc()
+}
+
+// Vraca da li je zapis batch vise zapisa
+func (e *Entry) IsBatch() bool {
+	return e.Tombstone[0] == TYPE_BATCH
+}
+
+// Vraca zapise koji se nalaze unutar batch zapisa
+func (e *Entry) BatchEntries() ([]*Entry, error) {
+	return splitEntries(e.Value, "batch")
+}
+
+// Pravi WAL zapis koji pripada zadatoj familiji kolona
+// Zapis se smesta u vrednost, a naziv familije u kljuc spoljnog zapisa
+// Redni broj i vreme su isti kao kod unutrasnjeg zapisa
+func NewFamilyEntry(family string, entry *Entry) *Entry {
+	value := EntryToBytes(entry)
+
+	e := new(Entry)
+	e.Key = []byte(family)
+	e.Value = value
+	e.Key_size = make([]byte, 8)
+	binary.BigEndian.PutUint64(e.Key_size, uint64(len(e.Key)))
+	e.Value_size = make([]byte, 8)
+	binary.BigEndian.PutUint64(e.Value_size, uint64(len(value)))
+	e.Timestamp = entry.Timestamp
+	e.Seq = entry.Seq
+	e.Expiry = make([]byte, 8)
+	e.Tombstone = []byte{TYPE_FAMILY}
+
 	e.Crc = make([]byte, 4)
-	binary.BigEndian.PutUint32(e.Crc, uint32(CRC32(bytes)))
+	binary.BigEndian.PutUint32(e.Crc, e.computeCrc())
 	return e
 }
 
+// Vraca da li zapis pripada familiji kolona
+func (e *Entry) IsFamily() bool {
+	return e.Tombstone[0] == TYPE_FAMILY
+}
+
+// Vraca naziv familije i zapis koji joj pripada
+func (e *Entry) FamilyEntry() (string, *Entry, error) {
+	entries, err := splitEntries(e.Value, "familija")
+	if err != nil {
+		return "", nil, err
+	}
+	if len(entries) != 1 {
+		return "", nil, NewCorruptionError("zapis familije %s sadrzi %d zapisa", string(e.Key), len(entries))
+	}
+	return string(e.Key), entries[0], nil
+}
+
+// Deli niz bajtova na zapise koji su zapisani jedan za drugim
+func splitEntries(bytes []byte, kind string) ([]*Entry, error) {
+	entries := make([]*Entry, 0)
+	for len(bytes) > 0 {
+		if len(bytes) < KEY_START {
+			return nil, NewCorruptionError("%s zapis je nepotpun", kind)
+		}
+		keySize := binary.BigEndian.Uint64(bytes[KEY_SIZE_START:VALUE_SIZE_START])
+		valueSize := binary.BigEndian.Uint64(bytes[VALUE_SIZE_START:KEY_START])
+		length := uint64(KEY_START) + keySize + valueSize
+		if keySize > uint64(len(bytes)) || valueSize > uint64(len(bytes)) || length > uint64(len(bytes)) {
+			return nil, NewCorruptionError("%s zapis je nepotpun", kind)
+		}
+		entries = append(entries, BytesToEntry(bytes[:length]))
+		bytes = bytes[length:]
+	}
+	return entries, nil
+}
+
+// Pretvara zapis u kljuc i podatak koji se smesta u memtabelu
+func (e *Entry) ToData() (string, *Data) {
+	tombstone := e.Tombstone[0] == TYPE_TOMBSTONE
+	timestamp := binary.BigEndian.Uint64(e.Timestamp)
+	data := NewData(e.Value, tombstone, timestamp)
+	data.Seq = binary.BigEndian.Uint64(e.Seq)
+	data.Expiry = binary.BigEndian.Uint64(e.Expiry)
+	data.Operand = e.Tombstone[0] == TYPE_MERGE
+	data.RangeDelete = e.Tombstone[0] == TYPE_RANGE
+	return string(e.Key), data
+}
+
 // pretvara iz Entry u niz bitova da bi mogli da zapisemo u fajlu
 func EntryToBytes(e *Entry) []byte {
 	bytes := make([]byte, 0)
 	bytes = append(bytes, e.Crc...)
 	bytes = append(bytes, e.Timestamp...)
+	bytes = append(bytes, e.Seq...)
+	bytes = append(bytes, e.Expiry...)
 	bytes = append(bytes, e.Tombstone...)
 	bytes = append(bytes, e.Key_size...)
 	bytes = append(bytes, e.Value_size...)
@@ -94,7 +243,9 @@ func EntryToBytes(e *Entry) []byte {
 func BytesToEntry(bytes []byte) *Entry {
 	e := new(Entry)
 	e.Crc = bytes[CRC_START:TIMESTAMP_START]
-	e.Timestamp = bytes[TIMESTAMP_START:TOMBSTONE_START]
+	e.Timestamp = bytes[TIMESTAMP_START:SEQ_START]
+	e.Seq = bytes[SEQ_START:EXPIRY_START]
+	e.Expiry = bytes[EXPIRY_START:TOMBSTONE_START]
 	e.Tombstone = bytes[TOMBSTONE_START:KEY_SIZE_START]
 	e.Key_size = bytes[KEY_SIZE_START:VALUE_SIZE_START]
 	e.Value_size = bytes[VALUE_SIZE_START:KEY_START]
@@ -104,31 +255,32 @@ func BytesToEntry(bytes []byte) *Entry {
 }
 
 // cita niz bitova i pretvara ih u klasu entity za dalju obradu
-func ReadEntry(file *os.File) *Entry {
+// Na kraju fajla vraca nil, nil
+func ReadEntry(file *os.File) (*Entry, error) {
 	//prvo procitamo do kljuca da bi videli koje su  velicine kljuc i vrednost
 	bytes := make([]byte, KEY_START)
-	_, err := file.Read(bytes)
+	_, err := io.ReadFull(file, bytes)
 	if err != nil {
 		if err == io.EOF {
-			return nil
+			return nil, nil
 		}
-		log.Fatal(err)
+		return nil, readError(file, err)
 	}
 	//procitamo velicine kljuca i vrednosti
 	Key_size := bytes[KEY_SIZE_START:VALUE_SIZE_START]
 	Value_size := bytes[VALUE_SIZE_START:]
 	//procitamo kljuc
 	Key := make([]byte, int(binary.BigEndian.Uint64(Key_size)))
-	_, err = file.Read(Key)
+	_, err = io.ReadFull(file, Key)
 	if err != nil {
-		log.Fatal(err)
+		return nil, readError(file, err)
 	}
 
 	//procitamo vrednost
 	Value := make([]byte, int(binary.BigEndian.Uint64(Value_size)))
-	_, err = file.Read(Value)
+	_, err = io.ReadFull(file, Value)
 	if err != nil {
-		log.Fatal(err)
+		return nil, readError(file, err)
 	}
 
 	bytes = append(bytes, Key...)
@@ -136,12 +288,22 @@ func ReadEntry(file *os.File) *Entry {
 
 	entry := BytesToEntry(bytes)
 
-	return entry
+	return entry, nil
+}
+
+// Kraj fajla usred zapisa znaci da je zapis osecen
+func readError(file *os.File, err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return NewCorruptionError("zapis u %s je nepotpun", file.Name())
+	}
+	return NewIOError(err)
 }
 
 // ispis pojedinacnog unosa
 func (entry *Entry) Print() {
 	Timestamp := binary.BigEndian.Uint64(entry.Timestamp)
+	Seq := binary.BigEndian.Uint64(entry.Seq)
+	Expiry := binary.BigEndian.Uint64(entry.Expiry)
 	Key_size := binary.BigEndian.Uint64(entry.Key_size)
 	Value_size := binary.BigEndian.Uint64(entry.Value_size)
 	//Tombstone
@@ -152,6 +314,8 @@ func (entry *Entry) Print() {
 	println("Entry: ")
 	println("CRC: ", entry.Crc)
 	println("Timestamp: ", Timestamp)
+	println("Seq: ", Seq)
+	println("Expiry: ", Expiry)
 	println("Tombstone: ", tombstone)
 	println("Key size: ", Key_size)
 	println("Value size: ", Value_size)
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"hash/fnv"
+	"io"
 	"log"
 	"math"
 	"strconv"
@@ -40,7 +41,7 @@ func Hash(data string) string {
 // Konstruktor
 func NewHLL(precision uint8) (*HLL, error) {
 	hll := new(HLL)
-	if precision < HLL_MIN_PRECISION && precision > HLL_MAX_PRECISION {
+	if precision < HLL_MIN_PRECISION || precision > HLL_MAX_PRECISION {
 		return nil, errors.New("Preciznost mora biti izmedju 4 i 16")
 	}
 	hll.P = precision
@@ -126,35 +127,38 @@ func HyperLogLogToBytes(hll *HLL) []byte {
 }
 
 //Pretvara niz bajtova u hll
-func BytesToHyperLogLog(HllBytes []byte) *HLL {
+func BytesToHyperLogLog(HllBytes []byte) (*HLL, error) {
 	hll := new(HLL)
 	reader := bytes.NewReader(HllBytes)
 	bytes := make([]byte, 8)
 
 	//ucitavamo podatke
-	_, err := reader.Read(bytes)
+	_, err := io.ReadFull(reader, bytes)
 	if err != nil {
-		log.Fatal(err)
+		return nil, errors.New("neispravan HyperLogLog: nedostaje velicina")
 	}
 	hll.M = binary.BigEndian.Uint64(bytes)
 
 	bytes = make([]byte, 1)
-	_, err = reader.Read(bytes)
+	_, err = io.ReadFull(reader, bytes)
 	if err != nil {
-		log.Fatal(err)
+		return nil, errors.New("neispravan HyperLogLog: nedostaje preciznost")
 	}
 	hll.P = uint8(bytes[0])
 
-	hll.Reg = make([]uint8, 0)
-	for i:= uint64(0); i < hll.M; i++ {
-		bytes = make([]byte, 1)
-		_, err := reader.Read(bytes)
-		if err != nil {
-			log.Fatal(err)
-		}
-		hll.Reg = append(hll.Reg, bytes...)
+	//velicina mora odgovarati preciznosti, a registri moraju postojati
+	if hll.P < HLL_MIN_PRECISION || hll.P > HLL_MAX_PRECISION || hll.M != uint64(1)<<hll.P {
+		return nil, fmt.Errorf("neispravan HyperLogLog: preciznost %d i velicina %d", hll.P, hll.M)
+	}
+	if uint64(reader.Len()) != hll.M {
+		return nil, fmt.Errorf("neispravan HyperLogLog: ocekivano %d registara, pronadjeno %d", hll.M, reader.Len())
+	}
+	hll.Reg = make([]uint8, hll.M)
+	_, err = io.ReadFull(reader, hll.Reg)
+	if err != nil {
+		return nil, err
 	}
 
-	return hll
+	return hll, nil
 }
 
@@ -0,0 +1,21 @@
+package iterator
+
+import (
+	. "project/keyvalue/structures/dataType"
+)
+
+// Zajednicki nacin prolaska kroz sortirane podatke (memtabela, sstabele, cela baza)
+// Kljucevi se obilaze rastuce, a ukoliko struktura cuva vise verzija istog kljuca
+// one se obilaze od najnovije ka najstarijoj
+type Iterator interface {
+	Seek(key string) //Postavlja se na prvi kljuc koji je veci ili jednak zadatom
+	SeekToFirst()
+	SeekToLast()
+	Next()
+	Prev()
+	Valid() bool //Da li je iterator postavljen na neki zapis
+	Key() string
+	Value() *Data
+	Err() error //Greska pri citanju, nakon nje iterator vise nije validan
+	Close() error
+}
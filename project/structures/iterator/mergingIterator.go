@@ -0,0 +1,257 @@
+package iterator
+
+import (
+	"container/heap"
+	. "project/keyvalue/structures/dataType"
+	. "project/keyvalue/structures/merge_operator"
+	"sort"
+)
+
+// Spaja vise iteratora (memtabelu i sve sstabele) u jedan
+// Za svaki kljuc vraca samo verziju koja je vidljiva za zadati redni broj upisa,
+// starije verzije istog kljuca se preskacu, a obrisani i istekli kljucevi se ne vracaju
+// Iteratori se drze u heap-u po trenutnom kljucu (min-heap unapred, max-heap unazad)
+// Posto iteratori zajedno sadrze sve verzije kljuca, operandi se spajaju datim operatorom
+// Verzije koje sakrivaju data brisanja opsega (iz memtabela i sstabela) se preskacu
+type MergingIterator struct {
+	children   []Iterator
+	heap       *iteratorHeap
+	seq        uint64
+	operator   MergeOperator
+	tombstones []*RangeTombstone
+	key        string
+	value      *Data
+	valid      bool
+	err        error
+}
+
+func NewMergingIterator(children []Iterator, seq uint64, operator MergeOperator, tombstones []*RangeTombstone) *MergingIterator {
+	it := new(MergingIterator)
+	it.children = children
+	it.heap = new(iteratorHeap)
+	it.seq = seq
+	it.operator = operator
+	it.tombstones = tombstones
+	return it
+}
+
+// Postavlja se na prvi kljuc koji je veci ili jednak zadatom
+func (it *MergingIterator) Seek(key string) {
+	for _, child := range it.children {
+		child.Seek(key)
+	}
+	it.initHeap(true)
+	it.findForward()
+}
+
+func (it *MergingIterator) SeekToFirst() {
+	for _, child := range it.children {
+		child.SeekToFirst()
+	}
+	it.initHeap(true)
+	it.findForward()
+}
+
+func (it *MergingIterator) SeekToLast() {
+	for _, child := range it.children {
+		child.SeekToLast()
+	}
+	it.initHeap(false)
+	it.findBackward()
+}
+
+func (it *MergingIterator) Next() {
+	if !it.valid {
+		return
+	}
+	//Ukoliko smo isli unazad svi iteratori se postavljaju iza trenutnog kljuca
+	if !it.heap.forward {
+		for _, child := range it.children {
+			child.Seek(it.key)
+			for child.Valid() && child.Key() == it.key {
+				child.Next()
+			}
+		}
+		it.initHeap(true)
+	}
+	it.findForward()
+}
+
+func (it *MergingIterator) Prev() {
+	if !it.valid {
+		return
+	}
+	//Ukoliko smo isli unapred svi iteratori se postavljaju ispred trenutnog kljuca
+	if it.heap.forward {
+		for _, child := range it.children {
+			child.Seek(it.key)
+			if child.Valid() {
+				for child.Valid() && child.Key() >= it.key {
+					child.Prev()
+				}
+			} else if child.Err() == nil {
+				child.SeekToLast()
+			}
+		}
+		it.initHeap(false)
+	}
+	it.findBackward()
+}
+
+func (it *MergingIterator) Valid() bool {
+	return it.valid
+}
+
+func (it *MergingIterator) Key() string {
+	return it.key
+}
+
+func (it *MergingIterator) Value() *Data {
+	return it.value
+}
+
+func (it *MergingIterator) Err() error {
+	return it.err
+}
+
+// Zatvara sve iteratore (sstabele drze otvorene fajlove)
+func (it *MergingIterator) Close() error {
+	var firstErr error
+	for _, child := range it.children {
+		err := child.Close()
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	it.valid = false
+	return firstErr
+}
+
+// Puni heap validnim iteratorima u zadatom smeru
+func (it *MergingIterator) initHeap(forward bool) {
+	it.heap.forward = forward
+	it.heap.items = it.heap.items[:0]
+	for _, child := range it.children {
+		if child.Valid() {
+			it.heap.items = append(it.heap.items, child)
+		} else if child.Err() != nil {
+			it.fail(child.Err())
+			return
+		}
+	}
+	heap.Init(it.heap)
+}
+
+// Trazi sledeci kljuc koji ima vidljivu verziju koja nije obrisana ni istekla
+func (it *MergingIterator) findForward() {
+	for it.err == nil && it.heap.Len() > 0 {
+		key := it.heap.items[0].Key()
+		newest := it.collect(key, func(child Iterator) { child.Next() })
+		if newest != nil && !newest.Deleted() {
+			it.key, it.value, it.valid = key, newest, true
+			return
+		}
+	}
+	it.valid = false
+}
+
+// Trazi prethodni kljuc koji ima vidljivu verziju koja nije obrisana ni istekla
+func (it *MergingIterator) findBackward() {
+	for it.err == nil && it.heap.Len() > 0 {
+		key := it.heap.items[0].Key()
+		newest := it.collect(key, func(child Iterator) { child.Prev() })
+		if newest != nil && !newest.Deleted() {
+			it.key, it.value, it.valid = key, newest, true
+			return
+		}
+	}
+	it.valid = false
+}
+
+// Prolazi kroz sve verzije datog kljuca u svim iteratorima i pomera ih iza njega
+// Vraca verziju sa najvecim rednim brojem koja je vidljiva (nil ukoliko je nema)
+// a ukoliko je ona operand vraca vrednost izracunatu od svih vidljivih verzija
+func (it *MergingIterator) collect(key string, step func(child Iterator)) *Data {
+	covering := CoveringSeq(it.tombstones, key, it.seq)
+	versions := make([]*Data, 0, 1)
+	for it.heap.Len() > 0 && it.heap.items[0].Key() == key {
+		child := heap.Pop(it.heap).(Iterator)
+		for child.Valid() && child.Key() == key {
+			//Memtabela cuva starije verzije u lancu, a sstabela kao zasebne zapise
+			for visible := child.Value().Visible(it.seq); visible != nil && visible.Seq > covering; visible = visible.Older {
+				versions = append(versions, visible)
+			}
+			step(child)
+		}
+		if child.Valid() {
+			heap.Push(it.heap, child)
+		} else if child.Err() != nil {
+			it.fail(child.Err())
+			return nil
+		}
+	}
+	if len(versions) == 0 {
+		return nil
+	}
+
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Seq > versions[j].Seq })
+	versions = uniqueVersions(versions)
+	if !versions[0].Operand {
+		return versions[0]
+	}
+	resolved, err := Resolve(it.operator, key, versions, true)
+	if err != nil {
+		it.fail(err)
+		return nil
+	}
+	return resolved
+}
+
+// Izbacuje ponovljene verzije (isti redni broj upisa) iz sortiranog niza
+// Ukoliko se memtabela flush-uje dok se iterator kreira ista verzija moze stici
+// i iz memtabele i iz nove sstabele, a operand se ne sme primeniti dva puta
+func uniqueVersions(versions []*Data) []*Data {
+	unique := versions[:1]
+	for _, version := range versions[1:] {
+		if version.Seq != unique[len(unique)-1].Seq {
+			unique = append(unique, version)
+		}
+	}
+	return unique
+}
+
+func (it *MergingIterator) fail(err error) {
+	it.err = err
+	it.valid = false
+}
+
+// Heap iteratora uredjen po trenutnom kljucu
+type iteratorHeap struct {
+	items   []Iterator
+	forward bool
+}
+
+func (h *iteratorHeap) Len() int {
+	return len(h.items)
+}
+
+func (h *iteratorHeap) Less(i, j int) bool {
+	if h.forward {
+		return h.items[i].Key() < h.items[j].Key()
+	}
+	return h.items[i].Key() > h.items[j].Key()
+}
+
+func (h *iteratorHeap) Swap(i, j int) {
+	h.items[i], h.items[j] = h.items[j], h.items[i]
+}
+
+func (h *iteratorHeap) Push(x interface{}) {
+	h.items = append(h.items, x.(Iterator))
+}
+
+func (h *iteratorHeap) Pop() interface{} {
+	last := h.items[len(h.items)-1]
+	h.items = h.items[:len(h.items)-1]
+	return last
+}
@@ -0,0 +1,67 @@
+package iterator
+
+import (
+	. "project/keyvalue/structures/dataType"
+	"sort"
+)
+
+// Iterator kroz vec sortirane nizove kljuceva i vrednosti
+// Koristi se kada se sadrzaj strukture kopira pri kreiranju iteratora,
+// pa iterator ne zavisi od kasnijih izmena strukture
+type SliceIterator struct {
+	keys     []string
+	values   []*Data
+	position int
+}
+
+func NewSliceIterator(keys []string, values []*Data) *SliceIterator {
+	it := new(SliceIterator)
+	it.keys = keys
+	it.values = values
+	it.position = len(keys)
+	return it
+}
+
+func (it *SliceIterator) Seek(key string) {
+	it.position = sort.SearchStrings(it.keys, key)
+}
+
+func (it *SliceIterator) SeekToFirst() {
+	it.position = 0
+}
+
+func (it *SliceIterator) SeekToLast() {
+	it.position = len(it.keys) - 1
+}
+
+func (it *SliceIterator) Next() {
+	if it.Valid() {
+		it.position++
+	}
+}
+
+func (it *SliceIterator) Prev() {
+	if it.Valid() {
+		it.position--
+	}
+}
+
+func (it *SliceIterator) Valid() bool {
+	return it.position >= 0 && it.position < len(it.keys)
+}
+
+func (it *SliceIterator) Key() string {
+	return it.keys[it.position]
+}
+
+func (it *SliceIterator) Value() *Data {
+	return it.values[it.position]
+}
+
+func (it *SliceIterator) Err() error {
+	return nil
+}
+
+func (it *SliceIterator) Close() error {
+	return nil
+}
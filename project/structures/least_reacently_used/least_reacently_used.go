@@ -2,21 +2,25 @@ package least_reacently_used
 
 import (
 	"container/list"
-	"encoding/binary"
-	"log"
 	"os"
 	"path/filepath"
 	"project/keyvalue/config"
+	. "project/keyvalue/errs"
 	. "project/keyvalue/structures/dataType"
 	. "project/keyvalue/structures/entry"
+	"sync"
 )
 
 // Koristicemo mapu i linked listu za LRU
+// Sve metode se mogu pozivati iz vise gorutina istovremeno (i Get menja redosled elemenata)
 
 type LRUCache struct {
+	lock       sync.Mutex
 	elementMap map[string]*cacheMapElement
 	cap        int
 	keyList    list.List
+	path       string //Putanja do cache fajla
+	generation uint64 //Broj poziva Delete, sluzi da se zastarela vrednost ne vrati u cache
 }
 
 type cacheMapElement struct {
@@ -25,49 +29,70 @@ type cacheMapElement struct {
 }
 
 //Brise element iz cache-a
-func (lru *LRUCache) Delete(key string) {
-	found, _ := lru.Get(key)
-	if found {
-		lru.keyList.Remove(lru.elementMap[key].el)
+//Poziva se pri svakom upisu kljuca, cak i kada kljuc nije u cache-u (vidi SetIfCurrent)
+func (lru *LRUCache) Delete(key string) error {
+	lru.lock.Lock()
+	defer lru.lock.Unlock()
+	lru.generation++
+	elem, ok := lru.elementMap[key]
+	if ok {
+		lru.keyList.Remove(elem.el)
 		delete(lru.elementMap, key)
-		lru.Write()
+		return lru.write()
 	}
+	return nil
 }
 
-//Konstruktor
-func NewLRU() *LRUCache {
-	c := config.GetConfig()
+//Brise iz cache-a sve kljuceve k za koje je start <= k < end
+//Poziva se pri svakom brisanju opsega
+func (lru *LRUCache) DeleteRange(start string, end string) error {
+	lru.lock.Lock()
+	defer lru.lock.Unlock()
+	lru.generation++
+	removed := false
+	for key, elem := range lru.elementMap {
+		if key >= start && key < end {
+			lru.keyList.Remove(elem.el)
+			delete(lru.elementMap, key)
+			removed = true
+		}
+	}
+	if removed {
+		return lru.write()
+	}
+	return nil
+}
 
+//Konstruktor
+func NewLRU(path string, c *config.Config) *LRUCache {
 	return &LRUCache{
 		elementMap: map[string]*cacheMapElement{},
 		cap:        c.LruCap,
 		keyList:    list.List{},
+		path:       path,
 	}
 }
 
 //Zapisuje LRU iz operativne memorije u cache file 
-func (lru *LRUCache) Write() {
+func (lru *LRUCache) Write() error {
+	lru.lock.Lock()
+	defer lru.lock.Unlock()
+	return lru.write()
+}
+
+func (lru *LRUCache) write() error {
 	//Trazimo lokaciju fajla
-	path, err1 := filepath.Abs("files/cache/cache.bin")
-	if err1 != nil {
-		log.Fatal(err1)
+	path, err := filepath.Abs(lru.path)
+	if err != nil {
+		return NewIOError(err)
 	}
 
-	file, err := os.OpenFile(path, os.O_RDWR, 0777)
+	//Kreira fajl ukoliko ne postoji i brise prethodni sadrzaj
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0777)
 	if err != nil {
-		if os.IsNotExist(err) {
-			file, err1 = os.Create(path)
-			if err1 != nil {
-				log.Fatal(err1)
-			}
-		} else {
-			log.Fatal(err)
-		}
+		return NewIOError(err)
 	}
-	err = file.Truncate(0)
-	if err != nil {
-		return
-	} //Brise ga
+
 	// Prolazak kroz dvostruko spregnutu listu
 	for e := lru.keyList.Front(); e != nil; e = e.Next() {
 		//zapisujemo entry kao niz bytova
@@ -76,49 +101,42 @@ func (lru *LRUCache) Write() {
 
 		_, err = file.Write(EntryToBytes(entry))
 		if err != nil {
-			log.Fatal(err)
+			file.Close()
+			return NewIOError(err)
 		}
 	}
-	err = file.Close()
-	if err != nil {
-		log.Fatal(err)
-	}
+	return NewIOError(file.Close())
 }
 
-//Cita LRU iz cache file-a
-func ReadLru() *LRUCache {
-	lru := NewLRU()
+//Cita LRU iz cache file-a na zadatoj putanji
+func ReadLru(path string, c *config.Config) (*LRUCache, error) {
+	lru := NewLRU(path, c)
 	// Otvaramo fajl
-	file, err := os.OpenFile("files/cache/cache.bin", os.O_RDONLY, 0777)
+	file, err := os.OpenFile(path, os.O_RDONLY, 0777)
 	if err != nil {
 		if os.IsNotExist(err) {
-			path, err1 := filepath.Abs("files/cache/cache.bin")
-			if err1 != nil {
-				log.Fatal(err1)
+			err = os.MkdirAll(filepath.Dir(path), os.ModePerm)
+			if err != nil {
+				return nil, NewIOError(err)
 			}
-
-			file, err1 = os.Create(path)
-			if err1 != nil {
-				log.Fatal(err1)
-			}
-			return lru
-		} else {
-			log.Fatal(err)
+			return lru, lru.write()
 		}
+		return nil, NewIOError(err)
 	}
+	defer file.Close()
 
 	// Citamo slogove
 	for i := 0; i < lru.cap; i++ {
-		entry := ReadEntry(file)
+		entry, err := ReadEntry(file)
+		if err != nil {
+			return nil, err
+		}
 		if entry == nil {
 			break
 		}
 
 		lru.keyList.PushBack(string(entry.Key))
-		timestamp := binary.BigEndian.Uint64(entry.Timestamp)
-		tombstone := entry.Tombstone[0] == uint8(1)
-
-		data := NewData(entry.Value, tombstone, timestamp)
+		_, data := entry.ToData()
 
 		cache := new(cacheMapElement)
 		cache.el = lru.keyList.Back()
@@ -127,27 +145,58 @@ func ReadLru() *LRUCache {
 		lru.elementMap[string(entry.Key)] = cache
 	}
 
-	err = file.Close()
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	return lru
+	return lru, nil
 }
 
 //Dobavlja element iz lru-a
-func (lru *LRUCache) Get(key string) (bool, *Data) {
+func (lru *LRUCache) Get(key string) (bool, *Data, error) {
+	lru.lock.Lock()
+	defer lru.lock.Unlock()
 	elem, ok := lru.elementMap[key]
 	if !ok {
-		return false, nil
+		return false, nil, nil
 	}
 	lru.keyList.MoveToFront(elem.el)
-	lru.Write()
-	return true, elem.value
+	return true, elem.value, lru.write()
 }
 
 //Ubacuje element u lru na prvu poziciju
-func (lru *LRUCache) Set(key string, value *Data) {
+func (lru *LRUCache) Set(key string, value *Data) error {
+	lru.lock.Lock()
+	defer lru.lock.Unlock()
+	return lru.set(key, value)
+}
+
+//Brise sve elemente iz cache-a
+func (lru *LRUCache) Clear() error {
+	lru.lock.Lock()
+	defer lru.lock.Unlock()
+	lru.generation++
+	lru.elementMap = map[string]*cacheMapElement{}
+	lru.keyList.Init()
+	return lru.write()
+}
+
+//Trenutna generacija cache-a, uzima se pre citanja podatka koji ce se smestiti sa SetIfCurrent
+func (lru *LRUCache) Generation() uint64 {
+	lru.lock.Lock()
+	defer lru.lock.Unlock()
+	return lru.generation
+}
+
+//Ubacuje element samo ukoliko od date generacije nije bilo brisanja
+//Citalac koji je procitao vrednost pre nego sto je upis zamenio ne sme da je vrati u cache
+//posle brisanja koje je upis uradio, a posto se ne zna koji je kljuc obrisan preskace se svako ubacivanje
+func (lru *LRUCache) SetIfCurrent(key string, value *Data, generation uint64) error {
+	lru.lock.Lock()
+	defer lru.lock.Unlock()
+	if lru.generation != generation {
+		return nil
+	}
+	return lru.set(key, value)
+}
+
+func (lru *LRUCache) set(key string, value *Data) error {
 	v, ok := lru.elementMap[key]
 	if !ok {
 		el := lru.keyList.PushFront(key)
@@ -167,5 +216,5 @@ func (lru *LRUCache) Set(key string, value *Data) {
 		v.value = value
 		lru.keyList.MoveToFront(v.el)
 	}
-	lru.Write()
+	return lru.write()
 }
@@ -0,0 +1,193 @@
+package lsm
+
+import (
+	. "project/keyvalue/structures/sstable"
+)
+
+//Rucna kompakcija opsega kljuceva
+//Sstabele ciji opseg (GetRange) preklapa zadati opseg se nivo po nivo spustaju do poslednjeg nivoa,
+//zajedno sa sstabelama narednog nivoa koje preklapaju njihov opseg, pa se sve verzije kljuceva iz opsega
+//spajaju u poslednjem nivou (izbacuju se tombstone-ovi, istekle verzije i verzije koje sakrivaju brisanja opsega)
+//Da bi nivo uvek sadrzao novije verzije kljuca od nivoa ispod njega:
+//size_tiered -> spustaju se sve sstabele nivoa do poslednje koja preklapa opseg (starije su pre novijih),
+//               a spajaju se sa svim sstabelama narednog nivoa od prve koja preklapa njihov opseg (novije su iza starijih)
+//leveled     -> spustaju se sstabele koje preklapaju opseg kao pri leveled kompakciji
+//               (u prvom nivou, gde se sstabele preklapaju, i sve starije od njih)
+//Ukoliko u poslednji nivo nije nista spusteno, prepisuju se njegove sstabele koje preklapaju opseg
+//Fifo i time_window kompakcije drze sve sstabele u prvom nivou, pa se svaka sstabela koja preklapa opseg
+//prepisuje sama na svom mestu (redosled i vremenski prozori sstabela se ne menjaju)
+//Tada se izbacuju istekle verzije i verzije koje sakrivaju brisanja opsega, a verzije koje sakriva tombstone
+//samo ukoliko su u istoj sstabeli sa njim
+
+// Kompaktuje sstabele koje preklapaju opseg [minKey, maxKey] do poslednjeg nivoa
+// Ceka kompakcije u pozadini koje koriste iste nivoe
+func (lsm *Lsm) CompactRange(minKey string, maxKey string) error {
+	if lsm.config.CompactionType == "fifo" || lsm.config.CompactionType == "time_window" {
+		lsm.ReserveLevel(1)
+		defer lsm.ReleaseLevel(1)
+		return lsm.rewriteRange(minKey, maxKey)
+	}
+
+	moved := false
+	for level := uint32(1); level < lsm.MaxLevel; level++ {
+		lsm.ReserveLevel(level)
+		var err error
+		moved, err = lsm.moveRange(level, minKey, maxKey)
+		lsm.ReleaseLevel(level)
+		if err != nil {
+			return err
+		}
+	}
+	if moved {
+		return nil
+	}
+
+	//U poslednji nivo nije nista spusteno pa se prepisuju njegove sstabele iz opsega
+	lsm.ReserveLevel(lsm.MaxLevel)
+	defer lsm.ReleaseLevel(lsm.MaxLevel)
+	current, first, last, err := lsm.overlappingTables(lsm.MaxLevel, minKey, maxKey)
+	if err != nil || first == 0 {
+		return err
+	}
+	_, err = lsm.rewriteTables(lsm.MaxLevel, first, last, current, first < last)
+	return err
+}
+
+// Vraca opsege sstabela nivoa i indekse prve i poslednje koja preklapa opseg [minKey, maxKey] (0 ukoliko nijedna ne preklapa)
+func (lsm *Lsm) overlappingTables(level uint32, minKey string, maxKey string) ([]keyRange, uint32, uint32, error) {
+	lsm.lock.RLock()
+	current, err := lsm.levelRanges(level)
+	lsm.lock.RUnlock()
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	first, last := uint32(0), uint32(0)
+	for i, r := range current {
+		if r.min <= maxKey && minKey <= r.max {
+			if first == 0 {
+				first = uint32(i + 1)
+			}
+			last = uint32(i + 1)
+		}
+	}
+	return current, first, last, nil
+}
+
+// Spusta sstabele nivoa koje preklapaju opseg u naredni nivo
+// Vraca false ukoliko nijedna sstabela nivoa ne preklapa opseg
+func (lsm *Lsm) moveRange(level uint32, minKey string, maxKey string) (bool, error) {
+	_, first, last, err := lsm.overlappingTables(level, minKey, maxKey)
+	if err != nil || first == 0 {
+		return false, err
+	}
+	if lsm.config.CompactionType == "size_tiered" {
+		return true, lsm.sizeTieredMerge(level, last)
+	}
+
+	//Sstabele nizih nivoa se ne preklapaju pa su one koje preklapaju opseg uzastopne,
+	//a u prvom nivou se spustaju i sve starije od njih
+	if level == 1 {
+		first = 1
+	}
+	chosen := make([]uint32, 0)
+	for index := first; index <= last; index++ {
+		chosen = append(chosen, index)
+	}
+	return true, lsm.leveledMerge(level, chosen)
+}
+
+// Spaja prvih count sstabela nivoa sa svim sstabelama narednog nivoa od prve koja preklapa njihov opseg
+// Spojena sstabela zauzima mesto prve spojene u narednom nivou (size_tiered)
+func (lsm *Lsm) sizeTieredMerge(currentLevel uint32, count uint32) error {
+	current, next, deeper, err := lsm.compactionRanges(currentLevel)
+	if err != nil {
+		return err
+	}
+	minKey, maxKey := current[0].min, current[0].max
+	for _, r := range current[1:count] {
+		if r.min < minKey {
+			minKey = r.min
+		}
+		if r.max > maxKey {
+			maxKey = r.max
+		}
+	}
+	nextSize := uint32(len(next))
+	first := nextSize + 1
+	for i, r := range next {
+		if r.min <= maxKey && minKey <= r.max {
+			first = uint32(i + 1)
+			break
+		}
+	}
+
+	sstables := make([]SST, 0)
+	for index := uint32(1); index <= count; index++ {
+		sstable, err := NewSSTable(lsm.getSSTableSize(currentLevel), lsm.GenerateSSTableName(currentLevel, index), lsm.config)
+		if err != nil {
+			return err
+		}
+		sstables = append(sstables, sstable)
+	}
+	for index := first; index <= nextSize; index++ {
+		sstable, err := NewSSTable(lsm.getSSTableSize(currentLevel+1), lsm.GenerateSSTableName(currentLevel+1, index), lsm.config)
+		if err != nil {
+			return err
+		}
+		sstables = append(sstables, sstable)
+	}
+
+	//Kljuc jos moze postojati samo u starijim sstabelama narednog nivoa i u nizim nivoima
+	filter := lsm.newTombstoneFilter(append(append([]keyRange{}, next[:first-1]...), deeper...))
+	keys, data, tombstones, err := MergeSSTablesInMemory(sstables, lsm.snapshots, lsm.operator, filter)
+	if err != nil {
+		return err
+	}
+	lsm.droppedTombstones.Add(filter.dropped + filter.droppedRanges)
+	written := len(keys) > 0 || len(tombstones) > 0
+	if written {
+		//Nova sstabela se do install-a nalazi iza poslednje u narednom nivou
+		err = lsm.flushMerged(currentLevel+1, nextSize+1, keys, data, tombstones)
+		if err != nil {
+			return err
+		}
+	}
+
+	//Spojena sstabela postaje vidljiva istovremeno sa brisanjem starih
+	lsm.lock.Lock()
+	defer lsm.lock.Unlock()
+	plan := newInstallPlan()
+	for index := uint32(1); index <= count; index++ {
+		plan.delete(currentLevel, index)
+	}
+	for index := first; index <= nextSize; index++ {
+		plan.delete(currentLevel+1, index)
+	}
+	lsm.LevelSizes[currentLevel] = first - 1
+	if written {
+		plan.rename(currentLevel+1, nextSize+1, first)
+		lsm.LevelSizes[currentLevel]++
+	}
+	lsm.UpdateCurrentLevelNames(currentLevel, count, plan)
+	return lsm.install(plan)
+}
+
+// Prepisuje svaku sstabelu prvog nivoa koja preklapa opseg (fifo i time_window)
+// Prepisuju se od najnovije, pa brisanje prazne sstabele ne menja indekse onih koje tek treba prepisati
+func (lsm *Lsm) rewriteRange(minKey string, maxKey string) error {
+	current, first, last, err := lsm.overlappingTables(1, minKey, maxKey)
+	if err != nil || first == 0 {
+		return err
+	}
+	for index := last; index >= first; index-- {
+		r := current[index-1]
+		if r.min > maxKey || minKey > r.max {
+			continue
+		}
+		_, err = lsm.rewriteTables(1, index, index, current, false)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,307 @@
+package lsm
+
+import (
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	. "project/keyvalue/errs"
+	"sort"
+	"strconv"
+)
+
+//Ubacivanje rezultata kompakcije u nivoe
+//Kompakcija brise ulazne sstabele i preimenuje preostale, pa bi prekid programa na pola
+//ostavio nivoe na disku koji ne odgovaraju lsm.bin (i izgubio podatke ulaznih sstabela)
+//Zato se sve izmene prvo zapisuju u dnevnik install.bin, pa se tek onda izvrsavaju:
+//faza 1 -> brisanje ulaznih sstabela i premestanje svih sstabela koje menjaju ime pod privremena imena
+//faza 2 -> premestanje sa privremenih imena na nova
+//Nakon faze 2 se zapisuje lsm.bin i brise dnevnik
+//Ukoliko dnevnik postoji pri otvaranju, izvrsava se ponovo od faze u kojoj je prekinut
+//Svaki korak se moze ponoviti, pa se dnevnik moze izvrsiti vise puta
+
+const INSTALL_FILE = "install.bin"
+
+// Sstabela odredjena nivoom i indeksom
+type sstableRef struct {
+	level uint32
+	index uint32
+}
+
+// Izmene nivoa koje se izvrsavaju zajedno
+type installPlan struct {
+	phase      byte
+	levelSizes []uint32
+	deletes    []sstableRef
+	moves      map[sstableRef]sstableRef //Novo ime -> sstabela koja ga dobija (pod imenom pre izmena)
+}
+
+func newInstallPlan() *installPlan {
+	plan := new(installPlan)
+	plan.phase = 1
+	plan.moves = make(map[sstableRef]sstableRef)
+	return plan
+}
+
+// Dodaje brisanje sstabele
+func (plan *installPlan) delete(level uint32, index uint32) {
+	plan.deletes = append(plan.deletes, sstableRef{level, index})
+}
+
+// Dodaje preimenovanje sstabele
+// Preimenovanja se zadaju redom kojim bi se izvrsavala, a plan pamti samo konacno ime svake sstabele
+func (plan *installPlan) rename(level uint32, from uint32, to uint32) {
+	plan.move(sstableRef{level, from}, sstableRef{level, to})
+}
+
+// Dodaje premestanje sstabele (i u drugi nivo)
+func (plan *installPlan) move(from sstableRef, to sstableRef) {
+	source, found := plan.moves[from]
+	if !found {
+		source = from
+	}
+	delete(plan.moves, from)
+	plan.moves[to] = source
+}
+
+// Preimenovanja sortirana po novom imenu (da bi dnevnik uvek bio isti)
+func (plan *installPlan) sortedMoves() ([]sstableRef, []sstableRef) {
+	targets := make([]sstableRef, 0, len(plan.moves))
+	for target, source := range plan.moves {
+		if target != source {
+			targets = append(targets, target)
+		}
+	}
+	sort.Slice(targets, func(i, j int) bool {
+		if targets[i].level != targets[j].level {
+			return targets[i].level < targets[j].level
+		}
+		return targets[i].index < targets[j].index
+	})
+	sources := make([]sstableRef, len(targets))
+	for i, target := range targets {
+		sources[i] = plan.moves[target]
+	}
+	return sources, targets
+}
+
+// Privremeno ime sstabele izmedju dve faze
+func (lsm *Lsm) installName(ref sstableRef) string {
+	return lsm.Directory + "/level" + strconv.FormatUint(uint64(ref.level), 10) + "/install" + strconv.FormatUint(uint64(ref.index), 10)
+}
+
+// Zapisuje plan u dnevnik, izvrsava ga i zapisuje lsm.bin sa novim velicinama nivoa
+// Pozivalac drzi lock i vec je izmenio LevelSizes
+func (lsm *Lsm) install(plan *installPlan) error {
+	plan.levelSizes = append([]uint32{}, lsm.LevelSizes...)
+	err := lsm.writeInstallPlan(plan)
+	if err != nil {
+		return err
+	}
+	return lsm.applyInstallPlan(plan)
+}
+
+func (lsm *Lsm) applyInstallPlan(plan *installPlan) error {
+	sources, targets := plan.sortedMoves()
+	if plan.phase == 1 {
+		for _, ref := range plan.deletes {
+			err := deleteSSTable(lsm.GenerateSSTableName(ref.level, ref.index))
+			if err != nil {
+				return err
+			}
+		}
+		for _, source := range sources {
+			//Ukoliko je privremeno ime zauzeto premestanje je vec izvrseno
+			_, err := os.Stat(lsm.installName(source))
+			if err == nil {
+				continue
+			}
+			err = os.Rename(lsm.GenerateSSTableName(source.level, source.index), lsm.installName(source))
+			if err != nil {
+				return NewIOError(err)
+			}
+		}
+		plan.phase = 2
+		err := lsm.writeInstallPlan(plan)
+		if err != nil {
+			return err
+		}
+	}
+
+	for i, source := range sources {
+		_, err := os.Stat(lsm.installName(source))
+		if os.IsNotExist(err) {
+			continue
+		}
+		err = os.Rename(lsm.installName(source), lsm.GenerateSSTableName(targets[i].level, targets[i].index))
+		if err != nil {
+			return NewIOError(err)
+		}
+	}
+
+	copy(lsm.LevelSizes, plan.levelSizes)
+	err := lsm.Write()
+	if err != nil {
+		return err
+	}
+	err = os.Remove(filepath.Join(lsm.Directory, INSTALL_FILE))
+	if err != nil {
+		return NewIOError(err)
+	}
+	return lsm.loadRangeTombstones(plan)
+}
+
+// Zapisuje dnevnik tako da se uvek procita ili stari ili novi sadrzaj
+func (lsm *Lsm) writeInstallPlan(plan *installPlan) error {
+	sources, targets := plan.sortedMoves()
+	bytes := []byte{plan.phase}
+	bytes = binary.BigEndian.AppendUint32(bytes, uint32(len(plan.levelSizes)))
+	for _, size := range plan.levelSizes {
+		bytes = binary.BigEndian.AppendUint32(bytes, size)
+	}
+	bytes = binary.BigEndian.AppendUint32(bytes, uint32(len(plan.deletes)))
+	for _, ref := range plan.deletes {
+		bytes = appendRef(bytes, ref)
+	}
+	bytes = binary.BigEndian.AppendUint32(bytes, uint32(len(targets)))
+	for i := range targets {
+		bytes = appendRef(bytes, sources[i])
+		bytes = appendRef(bytes, targets[i])
+	}
+	return writeFileAtomic(filepath.Join(lsm.Directory, INSTALL_FILE), bytes)
+}
+
+func appendRef(bytes []byte, ref sstableRef) []byte {
+	bytes = binary.BigEndian.AppendUint32(bytes, ref.level)
+	return binary.BigEndian.AppendUint32(bytes, ref.index)
+}
+
+// Ucitava dnevnik, vraca nil ukoliko ne postoji
+func (lsm *Lsm) readInstallPlan() (*installPlan, error) {
+	filePath := filepath.Join(lsm.Directory, INSTALL_FILE)
+	file, err := os.Open(filePath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, NewIOError(err)
+	}
+	defer file.Close()
+
+	plan := newInstallPlan()
+	readUint32 := func() (uint32, error) {
+		bytes := make([]byte, 4)
+		_, err := io.ReadFull(file, bytes)
+		return binary.BigEndian.Uint32(bytes), err
+	}
+	readRef := func() (sstableRef, error) {
+		level, err := readUint32()
+		if err != nil {
+			return sstableRef{}, err
+		}
+		index, err := readUint32()
+		return sstableRef{level, index}, err
+	}
+	corrupted := func(err error) error {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return NewCorruptionError("fajl %s je nepotpun", filePath)
+		}
+		return NewIOError(err)
+	}
+
+	phase := make([]byte, 1)
+	_, err = io.ReadFull(file, phase)
+	if err != nil {
+		return nil, corrupted(err)
+	}
+	plan.phase = phase[0]
+
+	count, err := readUint32()
+	if err != nil {
+		return nil, corrupted(err)
+	}
+	for i := uint32(0); i < count; i++ {
+		size, err := readUint32()
+		if err != nil {
+			return nil, corrupted(err)
+		}
+		plan.levelSizes = append(plan.levelSizes, size)
+	}
+	if len(plan.levelSizes) != len(lsm.LevelSizes) {
+		return nil, NewCorruptionError("fajl %s ne odgovara broju nivoa", filePath)
+	}
+
+	count, err = readUint32()
+	if err != nil {
+		return nil, corrupted(err)
+	}
+	for i := uint32(0); i < count; i++ {
+		ref, err := readRef()
+		if err != nil {
+			return nil, corrupted(err)
+		}
+		plan.deletes = append(plan.deletes, ref)
+	}
+
+	count, err = readUint32()
+	if err != nil {
+		return nil, corrupted(err)
+	}
+	for i := uint32(0); i < count; i++ {
+		source, err := readRef()
+		if err != nil {
+			return nil, corrupted(err)
+		}
+		target, err := readRef()
+		if err != nil {
+			return nil, corrupted(err)
+		}
+		plan.moves[target] = source
+	}
+	return plan, nil
+}
+
+// Dovrsava izmene nivoa prekinute pri prethodnom radu
+// Brise sstabele koje su zapisane, a nisu ubacene u nivo (kompakcija ili flush prekinuti pre zapisa lsm.bin)
+// i ucitava brisanja opsega iz sstabela koje su ostale u nivoima
+func (lsm *Lsm) recoverInstall() error {
+	plan, err := lsm.readInstallPlan()
+	if err != nil {
+		return err
+	}
+	if plan != nil {
+		err = lsm.applyInstallPlan(plan)
+		if err != nil {
+			return err
+		}
+	}
+
+	for level := uint32(1); level <= lsm.MaxLevel; level++ {
+		for index := lsm.LevelSizes[level-1] + 1; true; index++ {
+			name := lsm.GenerateSSTableName(level, index)
+			_, err := os.Stat(name)
+			if os.IsNotExist(err) {
+				break
+			}
+			err = deleteSSTable(name)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	err = deleteSSTable(lsm.GenerateFlushName())
+	if err != nil {
+		return err
+	}
+	return lsm.loadRangeTombstones(nil)
+}
+
+// Zapisuje fajl pod privremenim imenom i zamenjuje stari
+func writeFileAtomic(path string, bytes []byte) error {
+	tempPath := path + ".tmp"
+	err := os.WriteFile(tempPath, bytes, 0777)
+	if err != nil {
+		return NewIOError(err)
+	}
+	return NewIOError(os.Rename(tempPath, path))
+}
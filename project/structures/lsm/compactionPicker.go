@@ -0,0 +1,187 @@
+package lsm
+
+import (
+	"io/fs"
+	"path/filepath"
+	. "project/keyvalue/errs"
+	"sync"
+)
+
+//Izbor nivoa za kompakciju
+//Kompakcija nivoa cita njegove sstabele i upisuje nove u naredni nivo, pa zauzima oba nivoa
+//Dve kompakcije se mogu izvrsavati istovremeno samo ukoliko ne zauzimaju nijedan zajednicki nivo
+//Svaki nivo dobija ocenu (score), a kompakcija je potrebna kada je ocena bar 1:
+//size_tiered -> broj sstabela / 2 (spajaju se parovi sstabela)
+//leveled     -> broj sstabela / (dozvoljen broj sstabela + 1)
+//fifo        -> velicina prvog nivoa / FifoMaxBytes (vidi fifoCompaction.go), ostali nivoi 0
+//time_window -> najveca ocena medju prozorima prvog nivoa (vidi timeWindowCompaction.go), ostali nivoi 0
+//Poslednji nivo se ne kompaktuje po velicini i ima ocenu 0
+//Kod size_tiered i leveled kompakcije nivo koji sadrzi sstabelu sa udelom tombstone-ova bar TombstoneCompactionRatio dobija ocenu bar
+//udeo / TombstoneCompactionRatio (>= 1), pa se kompaktuje i kada nije pun (poslednji nivo se tada prepisuje, vidi tombstones.go)
+//Bajtovi koji cekaju kompakciju su velicina sstabela koje bi kompakcija nivoa sa ocenom bar 1 procitala iz tog nivoa
+//(racuna se samo po velicini nivoa, pa kompakcija zbog tombstone-ova ne usporava upise)
+
+func (lsm *Lsm) initReservations() {
+	lsm.reserved = make([]bool, lsm.MaxLevel)
+	lsm.levelsFree = sync.NewCond(&lsm.levelsLock)
+}
+
+// Zauzima nivo i naredni nivo ukoliko su slobodni
+// Vraca false ukoliko je neki od njih zauzela druga kompakcija
+func (lsm *Lsm) TryReserveLevel(level uint32) bool {
+	lsm.levelsLock.Lock()
+	defer lsm.levelsLock.Unlock()
+	if !lsm.levelsAvailable(level) {
+		return false
+	}
+	lsm.markLevel(level, true)
+	return true
+}
+
+// Ceka da nivo i naredni nivo budu slobodni i zauzima ih
+func (lsm *Lsm) ReserveLevel(level uint32) {
+	lsm.levelsLock.Lock()
+	defer lsm.levelsLock.Unlock()
+	for !lsm.levelsAvailable(level) {
+		lsm.levelsFree.Wait()
+	}
+	lsm.markLevel(level, true)
+}
+
+// Oslobadja nivoe zauzete sa ReserveLevel ili TryReserveLevel
+func (lsm *Lsm) ReleaseLevel(level uint32) {
+	lsm.levelsLock.Lock()
+	lsm.markLevel(level, false)
+	lsm.levelsFree.Broadcast()
+	lsm.levelsLock.Unlock()
+}
+
+func (lsm *Lsm) levelsAvailable(level uint32) bool {
+	return !lsm.reserved[level-1] && (level >= lsm.MaxLevel || !lsm.reserved[level])
+}
+
+func (lsm *Lsm) markLevel(level uint32, reserved bool) {
+	lsm.reserved[level-1] = reserved
+	if level < lsm.MaxLevel {
+		lsm.reserved[level] = reserved
+	}
+}
+
+// Racuna ocenu nivoa, kompakcija je potrebna kada je ocena bar 1
+func (lsm *Lsm) CompactionScore(level uint32) float64 {
+	//Ukoliko se sstabele ne mogu procitati nivo se ne kompaktuje do sledeceg izbora
+	if lsm.config.CompactionType == "fifo" || lsm.config.CompactionType == "time_window" {
+		if level > 1 {
+			return 0
+		}
+		var score float64
+		var err error
+		if lsm.config.CompactionType == "fifo" {
+			score, err = lsm.fifoScore()
+		} else {
+			score, err = lsm.timeWindowScore()
+		}
+		if err != nil {
+			return 0
+		}
+		return score
+	}
+	score := float64(0)
+	if level < lsm.MaxLevel {
+		size := float64(lsm.LevelSize(level))
+		if lsm.config.CompactionType == "leveled" {
+			score = size / float64(lsm.maxLevelSSTables(level)+1)
+		} else {
+			score = size / 2
+		}
+	}
+
+	//Ukoliko se metadata ne moze procitati nivo se ocenjuje samo po velicini
+	_, ratio, err := lsm.tombstoneTables(level)
+	if err == nil && ratio > 0 {
+		tombstoneScore := ratio / lsm.config.TombstoneCompactionRatio
+		if tombstoneScore > score {
+			score = tombstoneScore
+		}
+	}
+	return score
+}
+
+// Vraca nivo sa najvecom ocenom medju nivoima koje nijedna kompakcija ne zauzima
+// Ukoliko nijednom slobodnom nivou nije potrebna kompakcija vraca 0 kao nivo
+func (lsm *Lsm) PickCompaction() (uint32, float64) {
+	lsm.levelsLock.Lock()
+	defer lsm.levelsLock.Unlock()
+	bestLevel := uint32(0)
+	bestScore := float64(0)
+	for level := uint32(1); level <= lsm.MaxLevel; level++ {
+		if !lsm.levelsAvailable(level) {
+			continue
+		}
+		score := lsm.CompactionScore(level)
+		if score >= 1 && score > bestScore {
+			bestLevel = level
+			bestScore = score
+		}
+	}
+	return bestLevel, bestScore
+}
+
+// Procenjuje koliko bajtova sstabela ceka kompakciju u svim nivoima
+func (lsm *Lsm) PendingCompactionBytes() (uint64, error) {
+	switch lsm.config.CompactionType {
+	case "fifo":
+		//Fifo kompakcija samo brise sstabele i nista ne cita
+		return 0, nil
+	case "time_window":
+		return lsm.timeWindowPendingBytes()
+	}
+	lsm.lock.RLock()
+	defer lsm.lock.RUnlock()
+	pending := uint64(0)
+	for level := uint32(1); level < lsm.MaxLevel; level++ {
+		size := lsm.LevelSizes[level-1]
+		//Broj sstabela koje bi kompakcija nivoa procitala
+		count := size - size%2
+		if lsm.config.CompactionType == "leveled" {
+			count = 0
+			if size > lsm.maxLevelSSTables(level) {
+				count = size - lsm.maxLevelSSTables(level)
+			}
+		}
+		if count == 0 {
+			continue
+		}
+		for index := uint32(1); index <= count; index++ {
+			bytes, err := sstableBytes(lsm.GenerateSSTableName(level, index))
+			if err != nil {
+				return 0, err
+			}
+			pending += bytes
+		}
+	}
+	return pending, nil
+}
+
+// Velicina svih fajlova sstabele na disku
+func sstableBytes(directory string) (uint64, error) {
+	bytes := uint64(0)
+	err := filepath.WalkDir(directory, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		bytes += uint64(info.Size())
+		return nil
+	})
+	if err != nil {
+		return 0, NewIOError(err)
+	}
+	return bytes, nil
+}
@@ -0,0 +1,83 @@
+package lsm
+
+import (
+	. "project/keyvalue/structures/sstable"
+)
+
+//Fifo kompakcija
+//Sve sstabele ostaju u prvom nivou redom kojim su flush-ovane (najstarija ima indeks 1) i nikad se ne spajaju
+//Kada ukupna velicina sstabela prvog nivoa predje FifoMaxBytes brisu se najstarije dok ne bude ispod granice,
+//a najnovija sstabela se nikad ne brise
+//Sstabela koju vidi neki snapshot (ili pretraga sa tokenom) se ne brise dok se on ne oslobodi, a ni sstabele posle nje,
+//pa se brisanje tada ponovo proverava. Baza posle kompakcije izbacuje obrisane vrednosti iz cache-a
+//Sstabele u nizim nivoima (ostale od druge kompakcije) se samo citaju
+
+// Vraca broj najstarijih sstabela prvog nivoa koje treba obrisati i ukupnu velicinu prvog nivoa
+// Snapshot vidi sstabelu ukoliko nije stariji od svih njenih upisa (MinSeq iz metadata fajla)
+// Pozivalac drzi lock
+func (lsm *Lsm) fifoExpired() (uint32, uint64, error) {
+	levelSize := lsm.LevelSizes[0]
+	sizes := make([]uint64, 0, levelSize)
+	total := uint64(0)
+	for index := uint32(1); index <= levelSize; index++ {
+		bytes, err := sstableBytes(lsm.GenerateSSTableName(1, index))
+		if err != nil {
+			return 0, 0, err
+		}
+		sizes = append(sizes, bytes)
+		total += bytes
+	}
+
+	newest, pinned := lsm.snapshots.Newest()
+	expired := uint32(0)
+	remaining := total
+	for expired+1 < levelSize && remaining > lsm.config.FifoMaxBytes {
+		if pinned {
+			metadata, err := ReadMetadata(lsm.GenerateSSTableName(1, expired+1))
+			if err != nil {
+				return 0, 0, err
+			}
+			if metadata.MinSeq <= newest {
+				break
+			}
+		}
+		remaining -= sizes[expired]
+		expired++
+	}
+	return expired, total, nil
+}
+
+// Ocena prvog nivoa, ukupna velicina / FifoMaxBytes ukoliko ima sstabela za brisanje
+func (lsm *Lsm) fifoScore() (float64, error) {
+	lsm.lock.RLock()
+	defer lsm.lock.RUnlock()
+	expired, total, err := lsm.fifoExpired()
+	if err != nil || expired == 0 {
+		return 0, err
+	}
+	return float64(total) / float64(lsm.config.FifoMaxBytes), nil
+}
+
+// Brise najstarije sstabele prvog nivoa dok ukupna velicina ne bude ispod FifoMaxBytes
+// Snapshot-ovi se proveravaju pod lock-om, pa snapshot kreiran u medjuvremenu cita sstabele tek posle brisanja
+func (lsm *Lsm) FifoCompaction() error {
+	lsm.lock.Lock()
+	defer lsm.lock.Unlock()
+	expired, _, err := lsm.fifoExpired()
+	if err != nil || expired == 0 {
+		return err
+	}
+
+	plan := newInstallPlan()
+	for index := uint32(1); index <= expired; index++ {
+		plan.delete(1, index)
+	}
+	lsm.UpdateCurrentLevelNames(1, expired, plan)
+	lsm.discardedTables.Add(uint64(expired))
+	return lsm.install(plan)
+}
+
+// Broj sstabela sa podacima koje je fifo kompakcija obrisala od otvaranja baze
+func (lsm *Lsm) DiscardedTables() uint64 {
+	return lsm.discardedTables.Load()
+}
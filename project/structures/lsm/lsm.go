@@ -4,177 +4,266 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
-	"log"
 	"math"
 	"os"
 	"path/filepath"
 	. "project/keyvalue/config"
+	. "project/keyvalue/errs"
 	. "project/keyvalue/structures/dataType"
-	. "project/keyvalue/structures/scan"
+	. "project/keyvalue/structures/iterator"
+	. "project/keyvalue/structures/merge_operator"
+	. "project/keyvalue/structures/snapshot"
 	. "project/keyvalue/structures/sstable"
+	"sort"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 //Ovde organizujemo fajlove pri upisu
+//Citanja (Find, iteratori) drze lock za citanje dok otvaraju sstabele, a flush i kompakcija
+//zapisuju nove sstabele pod imenima koja citaoci ne vide i lock za upis uzimaju samo
+//dok ih ubacuju u nivoe (brisanje starih, preimenovanje i izmena LevelSizes)
+//Flush se moze izvrsavati istovremeno sa kompakcijama, a kompakcije istovremeno samo nad razlicitim nivoima
+//(kompakcija nivoa zauzima i naredni nivo, vidi compactionPicker.go)
+
+//lsm.bin pocinje oznakom LSM_MAGIC i verzijom formata (4B), pa slede MaxLevel (4B), Level (4B), LastSeq (8B)
+//i broj sstabela svakog nivoa (po 4B)
+//Verzija obuhvata i format sstabela, fajlovi bez oznake su zapisani pre uvodjenja rednih brojeva upisa
+//i ne mogu se procitati
+const (
+	LSM_MAGIC          = "KVLS"
+	LSM_FORMAT_VERSION = 2
+)
 
 type Lsm struct {
 	MaxLevel   uint32
-	Level      uint32   //Trenutna visina
-	LevelSizes []uint32 //cuva broj sstabela u svakom nivou
+	Level      uint32        //Trenutna visina
+	LastSeq    uint64        //Najveci redni broj upisa koji je flush-ovan u sstabele
+	LevelSizes []uint32      //cuva broj sstabela u svakom nivou
+	Directory  string        //Direktorijum u kom se nalaze nivoi i lsm.bin (ne zapisuje se)
+	config     *Config       //Konfiguracija baze (ne zapisuje se)
+	snapshots  *SnapshotList //Snapshot-ovi cije verzije kompakcija mora sacuvati (ne zapisuje se)
+	operator   MergeOperator //Merge operator kojim kompakcija spaja operande, moze biti nil (ne zapisuje se)
+	lock       sync.RWMutex
+	reserved   []bool     //Nivoi nad kojima je kompakcija u toku (ne zapisuje se)
+	levelsLock sync.Mutex //Stiti reserved
+	levelsFree *sync.Cond //Signalizira oslobadjanje nivoa
+
+	droppedTombstones atomic.Uint64           //Broj tombstone-ova koje su kompakcije izbacile (ne zapisuje se)
+	cleaned           map[string]cleanedTable //Sstabele poslednjeg nivoa ciji prepis nije izbacio tombstone-ove (ne zapisuje se, vidi tombstones.go)
+	discardedTables   atomic.Uint64           //Broj sstabela koje je fifo kompakcija obrisala (ne zapisuje se)
+
+	rangeTombstones map[sstableRef][]*RangeTombstone //Brisanja opsega svake sstabele u nivoima (ne zapisuje se, vidi rangeTombstones.go)
 }
 
 // Kreira foldere i lsm fajl ako ne postoji
-func InitializeLsm() {
-	_, err := os.Stat("files/sstable/lsm.bin")
+// Vraca ucitano lsm stablo iz zadatog direktorijuma
+func InitializeLsm(directory string, config *Config, snapshots *SnapshotList, operator MergeOperator) (*Lsm, error) {
+	_, err := os.Stat(directory + "/lsm.bin")
 	if os.IsNotExist(err) {
-		config := GetConfig()
 		lsm := new(Lsm)
 		lsm.MaxLevel = uint32(config.LsmMaxLevel)
 		lsm.Level = 1
 		lsm.LevelSizes = make([]uint32, lsm.MaxLevel)
-
-		path, err := filepath.Abs("files/sstable")
+		lsm.Directory = directory
+		lsm.config = config
+		lsm.snapshots = snapshots
+		lsm.operator = operator
+		lsm.rangeTombstones = make(map[sstableRef][]*RangeTombstone)
+		lsm.initReservations()
+
+		err = os.MkdirAll(directory, os.ModePerm)
 		if err != nil {
-			log.Fatal(err)
+			return nil, NewIOError(err)
 		}
-		file, err := os.Create(path + "/lsm.bin")
+		file, err := os.Create(directory + "/lsm.bin")
 		if err != nil {
-			log.Fatal(err)
+			return nil, NewIOError(err)
 		}
 		err = file.Close()
 		if err != nil {
-			log.Fatal(err)
+			return nil, NewIOError(err)
 		}
 
-		lsm.Write()
-		lsm.GenerateLevelFolders()
-	} else {
-		//Ukoliko je maxlevel veci od broja trenutnih foldera kreirace se novi
-		ReadLsm().GenerateLevelFolders()
+		err = lsm.Write()
+		if err != nil {
+			return nil, err
+		}
+		err = lsm.GenerateLevelFolders()
+		if err != nil {
+			return nil, err
+		}
+		return lsm, nil
+	}
+	//Ukoliko je maxlevel veci od broja trenutnih foldera kreirace se novi
+	lsm, err := ReadLsm(directory, config, snapshots, operator)
+	if err != nil {
+		return nil, err
+	}
+	err = lsm.GenerateLevelFolders()
+	if err != nil {
+		return nil, err
 	}
+	//Dovrsavamo izmene nivoa prekinute pri prethodnom radu
+	err = lsm.recoverInstall()
+	if err != nil {
+		return nil, err
+	}
+	return lsm, nil
 }
 
 // Zapisuje lsm u fajl
-func (lsm *Lsm) Write() {
-	filePath, err1 := filepath.Abs("files/sstable/lsm.bin")
-	if err1 != nil {
-		log.Fatal(err1)
-	}
-	file, err := os.OpenFile(filePath, os.O_RDWR, 0777)
+// Novi sadrzaj se zapisuje pod privremenim imenom, pa prekid upisa ne ostecuje stari
+func (lsm *Lsm) Write() error {
+	filePath, err := filepath.Abs(lsm.Directory + "/lsm.bin")
 	if err != nil {
-		log.Fatal(err)
+		return NewIOError(err)
 	}
 
-	bytes := make([]byte, 4)
-	binary.BigEndian.PutUint32(bytes, lsm.MaxLevel)
-
+	bytes := []byte(LSM_MAGIC)
 	tempBytes := make([]byte, 4)
+	binary.BigEndian.PutUint32(tempBytes, LSM_FORMAT_VERSION)
+	bytes = append(bytes, tempBytes...)
+
+	tempBytes = make([]byte, 4)
+	binary.BigEndian.PutUint32(tempBytes, lsm.MaxLevel)
+	bytes = append(bytes, tempBytes...)
+
+	tempBytes = make([]byte, 4)
 	binary.BigEndian.PutUint32(tempBytes, lsm.Level)
 	bytes = append(bytes, tempBytes...)
 
+	seqBytes := make([]byte, 8)
+	binary.BigEndian.PutUint64(seqBytes, lsm.LastSeq)
+	bytes = append(bytes, seqBytes...)
+
 	for i := 0; i < len(lsm.LevelSizes); i++ {
 		tempBytes = make([]byte, 4)
 		binary.BigEndian.PutUint32(tempBytes, lsm.LevelSizes[i])
 		bytes = append(bytes, tempBytes...)
 	}
 
-	_, err = file.Write(bytes)
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	err = file.Close()
-	if err != nil {
-		log.Fatal(err)
-	}
+	return writeFileAtomic(filePath, bytes)
 }
 
 // Ucitava LSM sa diska
-func ReadLsm() *Lsm {
-	filePath, err1 := filepath.Abs("files/sstable/lsm.bin")
-	if err1 != nil {
-		log.Fatal(err1)
+func ReadLsm(directory string, config *Config, snapshots *SnapshotList, operator MergeOperator) (*Lsm, error) {
+	filePath, err := filepath.Abs(directory + "/lsm.bin")
+	if err != nil {
+		return nil, NewIOError(err)
 	}
 	file, err := os.Open(filePath)
 	if err != nil {
-		log.Fatal(err)
+		return nil, NewIOError(err)
 	}
+	defer file.Close()
 
 	lsm := new(Lsm)
-
-	bytes := make([]byte, 4)
-	_, err = file.Read(bytes)
-	if err != nil {
-		log.Fatal(err)
+	lsm.Directory = directory
+	lsm.config = config
+	lsm.snapshots = snapshots
+	lsm.operator = operator
+
+	bytes := make([]byte, 24)
+	_, err = io.ReadFull(file, bytes)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, NewIOError(err)
+	}
+	if string(bytes[:4]) != LSM_MAGIC {
+		return nil, NewFormatError("%s nema oznaku verzije formata (zapisan je pre uvodjenja rednih brojeva upisa), "+
+			"podaci se moraju ponovo upisati u novu bazu", filePath)
+	}
+	version := binary.BigEndian.Uint32(bytes[4:8])
+	if version != LSM_FORMAT_VERSION {
+		return nil, NewFormatError("%s je zapisan u verziji formata %d, podrzana je verzija %d", filePath, version, LSM_FORMAT_VERSION)
 	}
-	lsm.MaxLevel = binary.BigEndian.Uint32(bytes)
-
-	bytes = make([]byte, 4)
-	_, err = file.Read(bytes)
 	if err != nil {
-		log.Fatal(err)
+		return nil, NewCorruptionError("fajl %s je nepotpun", filePath)
 	}
-	lsm.Level = binary.BigEndian.Uint32(bytes)
+	bytes = bytes[8:]
+	lsm.MaxLevel = binary.BigEndian.Uint32(bytes[0:4])
+	lsm.Level = binary.BigEndian.Uint32(bytes[4:8])
+	lsm.LastSeq = binary.BigEndian.Uint64(bytes[8:16])
 
 	for true {
 		bytes = make([]byte, 4)
-		_, err = file.Read(bytes)
+		_, err = io.ReadFull(file, bytes)
 		if err != nil {
 			if err == io.EOF {
 				break
 			}
-			log.Fatal(err)
+			if err == io.ErrUnexpectedEOF {
+				return nil, NewCorruptionError("fajl %s je nepotpun", filePath)
+			}
+			return nil, NewIOError(err)
 		}
 		lsm.LevelSizes = append(lsm.LevelSizes, binary.BigEndian.Uint32(bytes))
 	}
 
-	err = file.Close()
-	if err != nil {
-		log.Fatal(err)
+	if uint32(len(lsm.LevelSizes)) < lsm.MaxLevel {
+		return nil, NewCorruptionError("fajl %s nema velicine svih nivoa", filePath)
 	}
-	return lsm
+	lsm.initReservations()
+	return lsm, nil
 }
 
-// Imenuje sstabelu nakon flusha
-func GenerateFlushName() string {
-	lsm := ReadLsm()
-	currentMax := lsm.LevelSizes[0]
-	return "level1/sstable" + strconv.FormatUint(uint64(currentMax+1), 10)
+// Imenuje sstabelu u koju se zapisuje flush
+// Citaoci je ne vide dok je AddFlushedSSTable ne ubaci na kraj prvog nivoa
+func (lsm *Lsm) GenerateFlushName() string {
+	return lsm.Directory + "/level1/flush"
 }
 
-//Vraca ime za sstabelu za zadati nivo i indeks
+//Vraca putanju do sstabele za zadati nivo i indeks
 func (lsm *Lsm) GenerateSSTableName(currentLevel uint32, index uint32) string {
-	return "level" + strconv.FormatUint(uint64(currentLevel), 10) + "/sstable" + strconv.FormatUint(uint64(index), 10)
-}
-
-// Pokrece se pri upisu nove sstabele
-// Povecava trenutni broj za 1 u levelu
-func IncreaseLsmLevel(level uint32) {
-	lsm := ReadLsm()
-	lsm.LevelSizes[level-1]++
-	lsm.Write()
+	return lsm.Directory + "/level" + strconv.FormatUint(uint64(currentLevel), 10) + "/sstable" + strconv.FormatUint(uint64(index), 10)
 }
 
-// Menja imena fajlova tako da krecu od 1
-// Update-a velicinu levela
-func (lsm *Lsm) RenameLevelSizeTiered(level uint32) {
-	if lsm.LevelSizes[level-1]%2 != 0 {
-
-		err := os.Rename("files/sstable/level"+strconv.FormatUint(uint64(level), 10)+"/sstable"+strconv.FormatUint(uint64(lsm.LevelSizes[level-1]), 10),
-			"files/sstable/level"+strconv.FormatUint(uint64(level), 10)+"/sstable1")
-		if err != nil {
-			log.Fatal(err)
+// Pokrece se nakon upisa nove sstabele pri flush-u
+// Sstabela dobija ime poslednje u prvom nivou i povecava se broj sstabela u njemu
+// (kompakcija prvog nivoa moze u medjuvremenu promeniti broj sstabela, pa se ime odredjuje tek sada)
+// Najveci redni broj upisa iz flush-ovanih podataka i brisanja opsega se zapisuje zajedno sa sstabelom
+func (lsm *Lsm) AddFlushedSSTable(name string, data []*Data, tombstones []*RangeTombstone) error {
+	lsm.lock.Lock()
+	defer lsm.lock.Unlock()
+	target := lsm.GenerateSSTableName(1, lsm.LevelSizes[0]+1)
+
+	//Ostatak flush-a prekinutog pre upisa lsm.bin
+	err := deleteSSTable(target)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(name, target)
+	if err != nil {
+		return NewIOError(err)
+	}
+	lsm.LevelSizes[0]++
+	lsm.rangeTombstones[sstableRef{1, lsm.LevelSizes[0]}] = tombstones
+	for _, d := range data {
+		if d.Seq > lsm.LastSeq {
+			lsm.LastSeq = d.Seq
+		}
+	}
+	for _, tombstone := range tombstones {
+		if tombstone.Seq > lsm.LastSeq {
+			lsm.LastSeq = tombstone.Seq
 		}
-		lsm.LevelSizes[level-1] = 1
-	} else {
-		lsm.LevelSizes[level-1] = 0
 	}
+	return lsm.Write()
+}
+
+// Broj sstabela u nivou
+func (lsm *Lsm) LevelSize(level uint32) uint32 {
+	lsm.lock.RLock()
+	defer lsm.lock.RUnlock()
+	return lsm.LevelSizes[level-1]
 }
 
 // Menja imena fajlova tako da krecu od 1
-func (lsm *Lsm) RenameLevelLeveled(currentLevel uint32, numOfCreatedFiles uint32, chosenIndexes []uint32) {
-	config := GetConfig()
+// Preimenovanja se dodaju u plan i izvrsavaju tek pri install
+func (lsm *Lsm) RenameLevelLeveled(currentLevel uint32, numOfCreatedFiles uint32, chosenIndexes []uint32, plan *installPlan) error {
+	config := lsm.config
 
 	//Ovaj slucaj gledamo ako postoje preklapanja sa narednim nivoom
 	if len(chosenIndexes) > 0 {
@@ -184,37 +273,41 @@ func (lsm *Lsm) RenameLevelLeveled(currentLevel uint32, numOfCreatedFiles uint32
 		//Pomeramo middle skroz desno iza novododatih(preimenujemo ih)
 		renameCnt := uint32(1)
 		for i := chosenIndexes[len(chosenIndexes)-1] + 1; i <= lsm.LevelSizes[currentLevel-1]-numOfCreatedFiles; i++ {
-			err := os.Rename("files/sstable/level"+strconv.FormatUint(uint64(currentLevel), 10)+"/sstable"+strconv.FormatUint(uint64(i), 10),
-				"files/sstable/level"+strconv.FormatUint(uint64(currentLevel), 10)+"/sstable"+strconv.FormatUint(uint64(lsm.LevelSizes[currentLevel-1]+renameCnt), 10)) //Najkraca linija koda u Novom Sadu
-			if err != nil {
-				log.Fatal(err)
-			}
+			plan.rename(currentLevel, i, lsm.LevelSizes[currentLevel-1]+renameCnt) //Najkraca linija koda u Novom Sadu
 			renameCnt++
 		}
 
 		//Pomeramo sve pocev od novododatih u levo preko onih koje smo obrisali(koji su se koristili u kompakciji)
 		for i := chosenIndexes[len(chosenIndexes)-1] + middle + 1; i <= lsm.LevelSizes[currentLevel-1]+middle; i++ {
-			err := os.Rename("files/sstable/level"+strconv.FormatUint(uint64(currentLevel), 10)+"/sstable"+strconv.FormatUint(uint64(i), 10),
-				"files/sstable/level"+strconv.FormatUint(uint64(currentLevel), 10)+"/sstable"+strconv.FormatUint(uint64(i-uint32(len(chosenIndexes))-middle), 10))
-			if err != nil {
-				log.Fatal(err)
-			}
+			plan.rename(currentLevel, i, i-uint32(len(chosenIndexes))-middle)
 		}
 		lsm.LevelSizes[currentLevel-1] -= uint32(len(chosenIndexes))
 
-	} else { //Ukoliko nema preklapanja
+	} else if numOfCreatedFiles > 0 { //Ukoliko nema preklapanja
 		indexOfFirstCreated := lsm.LevelSizes[currentLevel-1] - numOfCreatedFiles + 1
-		lastCreatedSSTable := NewSSTable(uint32(config.MemtableSize), lsm.GenerateSSTableName(currentLevel, lsm.LevelSizes[currentLevel-1]))
+		lastCreatedSSTable, err := NewSSTable(uint32(config.MemtableSize), lsm.GenerateSSTableName(currentLevel, lsm.LevelSizes[currentLevel-1]), config)
+		if err != nil {
+			return err
+		}
 
-		_, maxCreated := lastCreatedSSTable.GetRange()
+		_, maxCreated, err := lastCreatedSSTable.GetRange()
+		if err != nil {
+			return err
+		}
 
 		swapIndex := uint32(0) //Predstavlja indeks gde treba da zamenimo tabele
 
 		//Poredimo opseg ostalih sstabela sa dodatim tabelama
 		//da bi znali na kojoj poziciji treba da stavimo dodate sstabele da bi sve bile sortirane
 		for i := uint32(1); i < indexOfFirstCreated; i++ {
-			currentSSTable := NewSSTable(uint32(config.MemtableSize), lsm.GenerateSSTableName(currentLevel, i))
-			minCurrent, _ := currentSSTable.GetRange()
+			currentSSTable, err := NewSSTable(uint32(config.MemtableSize), lsm.GenerateSSTableName(currentLevel, i), config)
+			if err != nil {
+				return err
+			}
+			minCurrent, _, err := currentSSTable.GetRange()
+			if err != nil {
+				return err
+			}
 
 			if maxCreated < minCurrent {
 				swapIndex = i
@@ -224,53 +317,58 @@ func (lsm *Lsm) RenameLevelLeveled(currentLevel uint32, numOfCreatedFiles uint32
 
 		//Ovo znaci da nije nasao nigde mesto tj. treba da stoji na kraju i nista ne pomeramo
 		if swapIndex == 0 {
-			return
+			return nil
 		}
 
 		middleCounter := uint32(0) //Broji koliko tabela ima izmedju prvog dodatog i mesta gde treba da ubacimo
 
 		//Pomeramo na kraj sve tabele koje se nalaze izmedju
 		for i := swapIndex; i < indexOfFirstCreated; i++ {
-			err := os.Rename("files/sstable/level"+strconv.FormatUint(uint64(currentLevel), 10)+"/sstable"+strconv.FormatUint(uint64(i), 10),
-				"files/sstable/level"+strconv.FormatUint(uint64(currentLevel), 10)+"/sstable"+strconv.FormatUint(uint64(lsm.LevelSizes[currentLevel-1]+middleCounter+1), 10))
-			if err != nil {
-				log.Fatal(err)
-			}
+			plan.rename(currentLevel, i, lsm.LevelSizes[currentLevel-1]+middleCounter+1)
 			middleCounter++
 		}
 
 		//Pomeramo sve u levo na trazeno mesto pocev od prvog dodatog tako da sada sve bude sortirano
 		for i := indexOfFirstCreated; i <= lsm.LevelSizes[currentLevel-1]+middleCounter; i++ {
-			err := os.Rename("files/sstable/level"+strconv.FormatUint(uint64(currentLevel), 10)+"/sstable"+strconv.FormatUint(uint64(i), 10),
-				"files/sstable/level"+strconv.FormatUint(uint64(currentLevel), 10)+"/sstable"+strconv.FormatUint(uint64(i-middleCounter), 10))
-			if err != nil {
-				log.Fatal(err)
-			}
+			plan.rename(currentLevel, i, i-middleCounter)
 		}
 
 	}
-
+	return nil
 }
 
 // Preostale fajlove nakon kompakcije preimenuje da pocinju od 1
-func (lsm *Lsm) UpdateCurrentLevelNames(currentLevel uint32, numOfCompacted uint32) {
+// Preimenovanja se dodaju u plan i izvrsavaju tek pri install
+func (lsm *Lsm) UpdateCurrentLevelNames(currentLevel uint32, numOfCompacted uint32, plan *installPlan) {
 
 	//Pomeramo sve u levo na pocetak
 	for i := numOfCompacted + 1; i <= lsm.LevelSizes[currentLevel-1]; i++ {
-		err := os.Rename("files/sstable/level"+strconv.FormatUint(uint64(currentLevel), 10)+"/sstable"+strconv.FormatUint(uint64(i), 10),
-			"files/sstable/level"+strconv.FormatUint(uint64(currentLevel), 10)+"/sstable"+strconv.FormatUint(uint64(i-numOfCompacted), 10))
-		if err != nil {
-			log.Fatal(err)
-		}
+		plan.rename(currentLevel, i, i-numOfCompacted)
 	}
 	lsm.LevelSizes[currentLevel-1] -= numOfCompacted
 }
 
+// Preostale fajlove nakon brisanja zadatih (rastuce sortiranih) indeksa pomera ulevo da popune praznine
+// Preimenovanja se dodaju u plan i izvrsavaju tek pri install
+func (lsm *Lsm) removeFromLevel(currentLevel uint32, removed []uint32, plan *installPlan) {
+	shift := uint32(0)
+	for i := uint32(1); i <= lsm.LevelSizes[currentLevel-1]; i++ {
+		if shift < uint32(len(removed)) && removed[shift] == i {
+			shift++
+			continue
+		}
+		if shift > 0 {
+			plan.rename(currentLevel, i, i-shift)
+		}
+	}
+	lsm.LevelSizes[currentLevel-1] -= uint32(len(removed))
+}
+
 // Funkcija koja generise foldere do max nivoa
-func (lsm *Lsm) GenerateLevelFolders() {
-	path, err := filepath.Abs("files/sstable")
+func (lsm *Lsm) GenerateLevelFolders() error {
+	path, err := filepath.Abs(lsm.Directory)
 	if err != nil {
-		log.Fatal(err)
+		return NewIOError(err)
 	}
 
 	for i := uint32(1); i < lsm.MaxLevel+1; i++ {
@@ -278,61 +376,140 @@ func (lsm *Lsm) GenerateLevelFolders() {
 		if os.IsNotExist(err) {
 			err = os.Mkdir(path+"/level"+strconv.FormatUint(uint64(i), 10), os.ModePerm)
 			if err != nil {
-				log.Fatal(err)
+				return NewIOError(err)
 			}
 		}
 	}
+	return nil
 }
 
-// Poziva se u mainu i pokrece izabranu kompakciju
-func RunCompact() {
-	lsm := ReadLsm()
-	config := GetConfig()
-
+// Poziva se iz baze i pokrece izabranu kompakciju nad svim nivoima redom
+// Nivo koji koristi kompakcija u pozadini se kompaktuje tek kada ona zavrsi
+func (lsm *Lsm) RunCompact() error {
 	//Iteriramo po levelima
-	//Preskacemo poslednji level jer se tu ne radi kompakcija
+	//U poslednjem nivou se samo prepisuju sstabele sa puno tombstone-ova
+	for currentLevel := uint32(1); currentLevel <= lsm.MaxLevel; currentLevel++ {
+		lsm.ReserveLevel(currentLevel)
+		err := lsm.CompactLevel(currentLevel)
+		lsm.ReleaseLevel(currentLevel)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Pokrece izabranu kompakciju nad jednim nivoom
+// Pozivalac je prethodno zauzeo nivo sa ReserveLevel ili TryReserveLevel
+func (lsm *Lsm) CompactLevel(currentLevel uint32) error {
+	config := lsm.config
+	//Fifo i time_window kompakcije drze sve sstabele u prvom nivou
+	if config.CompactionType == "fifo" || config.CompactionType == "time_window" {
+		if currentLevel > 1 {
+			return nil
+		}
+		if config.CompactionType == "fifo" {
+			return lsm.FifoCompaction()
+		}
+		return lsm.TimeWindowCompaction()
+	}
+	if currentLevel == lsm.MaxLevel {
+		return lsm.TombstoneCompaction(currentLevel)
+	}
 	if config.CompactionType == "size_tiered" {
-		for currentLevel := uint32(1); currentLevel < lsm.MaxLevel; currentLevel++ {
-			//Ukoliko ima bar 2 elementa u nivou pokrecemo
-			if lsm.LevelSizes[currentLevel-1] >= 2 {
-				lsm.SizeTieredCompaction(currentLevel)
-			}
+		//Ukoliko ima bar 1 element u nivou pokrecemo (sstabela sa puno tombstone-ova se spusta i bez para)
+		if lsm.LevelSize(currentLevel) >= 1 {
+			return lsm.SizeTieredCompaction(currentLevel)
 		}
 	} else if config.CompactionType == "leveled" {
-		for currentLevel := uint32(1); currentLevel < lsm.MaxLevel; currentLevel++ {
-			//Ukoliko ima bar 1 element u nivou pokrecemo
-			if lsm.LevelSizes[currentLevel-1] >= 1 {
-				lsm.LeveledCompaction(currentLevel)
-			}
+		//Ukoliko ima bar 1 element u nivou pokrecemo
+		if lsm.LevelSize(currentLevel) >= 1 {
+			return lsm.LeveledCompaction(currentLevel)
 		}
 	}
+	return nil
 }
 
 // Size_tiered komapkcije
 // spaja po 2 sstabele i prebacuje u naredni nivo
 // ovo radi lancano do poslednjeg nivoa
-func (lsm *Lsm) SizeTieredCompaction(currentLevel uint32) {
-	size := getSSTableSize(currentLevel)
+// Sstabela sa puno tombstone-ova se spusta zajedno sa svim starijim sstabelama nivoa,
+// a ukoliko ostane bez para prepisuje se sama
+func (lsm *Lsm) SizeTieredCompaction(currentLevel uint32) error {
+	//Sstabele sa puno tombstone-ova se citaju pre velicine nivoa, pa su sve medju procitanim
+	heavy, _, err := lsm.tombstoneTables(currentLevel)
+	if err != nil {
+		return err
+	}
+	size := lsm.getSSTableSize(currentLevel)
+	levelSize := lsm.LevelSize(currentLevel)    //Flush moze u medjuvremenu dodati nove sstabele u prvi nivo
+	nextSize := lsm.LevelSize(currentLevel + 1) //Nove sstabele se do kraja kompakcije nalaze iza poslednje u narednom nivou
+	compacted := uint32(0)                      //Broj spojenih sstabela iz trenutnog nivoa
+	created := uint32(0)
+
+	//Broj sstabela koje se spustaju
+	count := levelSize - levelSize%2
+	if len(heavy) > 0 && heavy[len(heavy)-1] > count {
+		count = heavy[len(heavy)-1]
+	}
+	if count == 0 {
+		return nil
+	}
+
+	//Starije od para su prethodne sstabele trenutnog nivoa i sve sstabele nizih nivoa
+	current, next, deeper, err := lsm.compactionRanges(currentLevel)
+	if err != nil {
+		return err
+	}
+	deeper = append(next, deeper...)
 
 	//Uzimamo po 2 sstabele i radimo kompakciju nad njima
-	for index := uint32(1); index < lsm.LevelSizes[currentLevel-1]; index += 2 {
+	for index := uint32(1); index <= count; index += 2 {
 
-		firstSStable := NewSSTable(size, lsm.GenerateSSTableName(currentLevel, index))
-		secondSStable := NewSSTable(size, lsm.GenerateSSTableName(currentLevel, index+1))
+		sstables := make([]SST, 0, 2)
+		for i := index; i <= index+1 && i <= count; i++ {
+			sstable, err := NewSSTable(size, lsm.GenerateSSTableName(currentLevel, i), lsm.config)
+			if err != nil {
+				return err
+			}
+			sstables = append(sstables, sstable)
+		}
 
-		mergedKeys, mergedData := Merge2SSTables(firstSStable, secondSStable)
+		filter := lsm.newTombstoneFilter(append(append([]keyRange{}, current[:index-1]...), deeper...))
+		mergedKeys, mergedData, mergedTombstones, err := MergeSSTablesInMemory(sstables, lsm.snapshots, lsm.operator, filter)
+		if err != nil {
+			return err
+		}
+		lsm.droppedTombstones.Add(filter.dropped + filter.droppedRanges)
+		compacted += uint32(len(sstables))
 
-		lsm.LevelSizes[currentLevel]++
-		mergedSSTable := NewSSTable(size*2, lsm.GenerateSSTableName(currentLevel+1, lsm.LevelSizes[currentLevel]))
-		mergedSSTable.Flush(mergedKeys, mergedData)
+		//Ukoliko su izbaceni svi zapisi nova sstabela se ne pravi
+		if len(mergedKeys) == 0 && len(mergedTombstones) == 0 {
+			continue
+		}
+		mergedSSTable, err := NewSSTable(size*2, lsm.GenerateSSTableName(currentLevel+1, nextSize+created+1), lsm.config)
+		if err != nil {
+			return err
+		}
+		err = mergedSSTable.Flush(mergedKeys, mergedData, mergedTombstones)
+		if err != nil {
+			return err
+		}
+		created++
+	}
 
-		//Brisemo stare sstabele
-		deleteSSTable(lsm.GenerateSSTableName(currentLevel, index))
-		deleteSSTable(lsm.GenerateSSTableName(currentLevel, index+1))
+	//Nove sstabele postaju vidljive istovremeno sa brisanjem starih
+	lsm.lock.Lock()
+	defer lsm.lock.Unlock()
+	plan := newInstallPlan()
+	lsm.LevelSizes[currentLevel] += created
 
+	//Brisemo stare sstabele
+	for index := uint32(1); index <= compacted; index++ {
+		plan.delete(currentLevel, index)
 	}
-	lsm.RenameLevelSizeTiered(currentLevel) //Preimenujemo fajlove u trenutnom nivou
-	lsm.Write()
+	lsm.UpdateCurrentLevelNames(currentLevel, compacted, plan) //Preimenujemo fajlove u trenutnom nivou
+	return lsm.install(plan)
 }
 
 // Leveled kompakcija
@@ -340,379 +517,444 @@ func (lsm *Lsm) SizeTieredCompaction(currentLevel uint32) {
 // Svaki naredni put proveravamo koliko njih treba da podignemo kako bi uslov za taj nivo bio ispunjen.
 // Ukoliko ima preklapanja sa narednim nivoom svi zajedno tabele se spajaju i ubacuju na odgovarajuce mesto.
 // Ukoliko nema preklapanja trazimo gde treba da se ubace nove tabele i tu ih smestamo.
-func (lsm *Lsm) LeveledCompaction(currentLevel uint32) {
-	config := GetConfig()
+// Sstabele sa puno tombstone-ova se podizu i kada nivo nije pun
+func (lsm *Lsm) LeveledCompaction(currentLevel uint32) error {
 	//Racuna broj sstabela koji je dozvoljen u trenutnom nivou
-	maxSSTables := uint32(0) //U prvoj ne sme da ostane nijedna sstabela
-	if currentLevel > 1 {
-		maxSSTables = uint32(math.Pow(float64(config.LeveledCompactionMultiplier), float64(currentLevel)-1))
+	maxSSTables := lsm.maxLevelSSTables(currentLevel)
+
+	heavy, _, err := lsm.tombstoneTables(currentLevel)
+	if err != nil {
+		return err
 	}
 
 	//Proveravamo da li je uopste potrebno raditi kompakciju na ovom nivou
-	if lsm.LevelSizes[currentLevel-1] > maxSSTables {
-		sstableArr := make([]SST, 0) //Niz sstabela koje ce se spajati
-		if currentLevel == 1 {
-
-			//Citamo prvog zbog minimalne i maksimalne vrednosti
-			firstSSTable := NewSSTable(uint32(config.MemtableSize), lsm.GenerateSSTableName(currentLevel, 1))
-			sstableArr = append(sstableArr, firstSSTable)
-			minKey, maxKey := firstSSTable.GetRange()
-
-			//Prolazimo kroz ceo prvi nivo (bez prve tabele jer je vec procitana)
-			for index := uint32(2); index <= lsm.LevelSizes[currentLevel-1]; index++ {
-
-				currentSSTable := NewSSTable(uint32(config.MemtableSize), lsm.GenerateSSTableName(currentLevel, index))
-
-				//Obelezimo sve sstabele iz prvog nivoa
-				sstableArr = append(sstableArr, currentSSTable)
-
-				//Proveravamo range
-				min, max := currentSSTable.GetRange()
-				if min < minKey {
-					minKey = min
-				}
-				if max > maxKey {
-					maxKey = max
-				}
-			}
-
-			//Cuva indekse od izabranih tabela iz narednog nivoa koje ulaze u kompakciju
-			chosenIndexes := make([]uint32, 0)
-
-			//Prolazimo kroz naredni nivo
-			for index := uint32(1); index <= lsm.LevelSizes[currentLevel]; index++ {
-				currentSSTable := NewSSTable(uint32(config.MemtableSize), lsm.GenerateSSTableName(currentLevel+1, index))
-
-				//Biramo samo one koji upadaju u opseg
-				firstKey, lastKey := currentSSTable.GetRange()
-				if !(lastKey < minKey || firstKey > maxKey) {
-					sstableArr = append(sstableArr, currentSSTable)
-					chosenIndexes = append(chosenIndexes, index)
-				}
+	//(flush moze u medjuvremenu dodati nove sstabele u prvi nivo, one ostaju za sledecu kompakciju)
+	levelSize := lsm.LevelSize(currentLevel)
+	if levelSize <= maxSSTables && len(heavy) == 0 {
+		return nil
+	}
 
-			}
+	//U prvom nivou se sve tabele podizu na visi nivo
+	//a u ostalim samo toliko tabela koliko je potrebno da bi isli ispod ogranicenja nivoa
+	//i sve sstabele sa puno tombstone-ova (u visim nivoima se sstabele ne preklapaju pa se mogu podici bilo koje)
+	sstablesToCompactNum := uint32(0)
+	if levelSize > maxSSTables {
+		sstablesToCompactNum = levelSize - maxSSTables
+	}
+	chosenCurrent := make([]uint32, 0) //Indeksi izabranih sstabela iz trenutnog nivoa (rastuce)
+	for index := uint32(1); index <= sstablesToCompactNum; index++ {
+		chosenCurrent = append(chosenCurrent, index)
+	}
+	for _, index := range heavy {
+		if index > sstablesToCompactNum {
+			chosenCurrent = append(chosenCurrent, index)
+		}
+	}
+	return lsm.leveledMerge(currentLevel, chosenCurrent)
+}
 
-			//MERGE
-			numOfCreatedFiles := lsm.MergeSSTables(sstableArr, currentLevel)
+// Spaja izabrane sstabele nivoa (indeksi rastuce) sa sstabelama narednog nivoa koje preklapaju njihov opseg
+// Nove sstabele se upisuju u naredni nivo tako da ostane sortiran, a izabrane se brisu iz oba nivoa
+func (lsm *Lsm) leveledMerge(currentLevel uint32, chosenCurrent []uint32) error {
+	config := lsm.config
+	sstableArr := make([]SST, 0) //Niz sstabela koje ce se spajati
 
-			//Brisemo sve fajlove iz prvog nivoa
-			for i := uint32(1); i <= lsm.LevelSizes[currentLevel-1]; i++ {
-				deleteSSTable(lsm.GenerateSSTableName(currentLevel, i))
-			}
+	//Citamo prvog zbog minimalne i maksimalne vrednosti
+	firstSSTable, err := NewSSTable(uint32(config.MemtableSize), lsm.GenerateSSTableName(currentLevel, chosenCurrent[0]), config)
+	if err != nil {
+		return err
+	}
+	sstableArr = append(sstableArr, firstSSTable)
+	minKey, maxKey, err := firstSSTable.GetRange()
+	if err != nil {
+		return err
+	}
 
-			//Brisemo sve izabrane fajlove iz drugog dela
-			for i := 0; i < len(chosenIndexes); i++ {
-				deleteSSTable(lsm.GenerateSSTableName(currentLevel+1, chosenIndexes[i]))
-			}
+	//Prolazimo kroz izabrane iz trenutnog nivoa (bez prve tabele jer je vec procitana)
+	for _, index := range chosenCurrent[1:] {
 
-			//Rename fajlova
-			lsm.RenameLevelLeveled(currentLevel+1, numOfCreatedFiles, chosenIndexes)
-			lsm.LevelSizes[0] = 0 //Posto smo sve prebacili u naredni nivo
-			lsm.Write()
+		currentSSTable, err := NewSSTable(uint32(config.MemtableSize), lsm.GenerateSSTableName(currentLevel, index), config)
+		if err != nil {
+			return err
+		}
 
-		} else {
-			sstablesToCompactNum := lsm.LevelSizes[currentLevel-1] - maxSSTables
+		//Obelezimo sve sstabele iz prvog nivoa
+		sstableArr = append(sstableArr, currentSSTable)
 
-			//Citamo prvog zbog minimalne i maksimalne vrednosti
-			firstSSTable := NewSSTable(uint32(config.MemtableSize), lsm.GenerateSSTableName(currentLevel, 1))
-			sstableArr = append(sstableArr, firstSSTable)
-			minKey, maxKey := firstSSTable.GetRange()
+		//Proveravamo range
+		min, max, err := currentSSTable.GetRange()
+		if err != nil {
+			return err
+		}
+		if min < minKey {
+			minKey = min
+		}
+		if max > maxKey {
+			maxKey = max
+		}
+	}
 
-			//Prolazimo kroz trenutan nivo (bez prve tabele jer je vec procitana)
-			//dodajemo samo toliko tabela koliko je potrebno da bi isli ispod ogranicenja nivoa
-			for index := uint32(2); index <= sstablesToCompactNum; index++ {
+	//Cuva indekse od izabranih tabela iz narednog nivoa koje ulaze u kompakciju
+	chosenIndexes := make([]uint32, 0)
 
-				currentSSTable := NewSSTable(uint32(config.MemtableSize), lsm.GenerateSSTableName(currentLevel, index))
+	//Prolazimo kroz naredni nivo
+	for index := uint32(1); index <= lsm.LevelSize(currentLevel+1); index++ {
+		currentSSTable, err := NewSSTable(uint32(config.MemtableSize), lsm.GenerateSSTableName(currentLevel+1, index), config)
+		if err != nil {
+			return err
+		}
 
-				//Obelezimo sve sstabele iz prvog nivoa
-				sstableArr = append(sstableArr, currentSSTable)
+		//Biramo samo one koji upadaju u opseg
+		firstKey, lastKey, err := currentSSTable.GetRange()
+		if err != nil {
+			return err
+		}
+		if !(lastKey < minKey || firstKey > maxKey) {
+			sstableArr = append(sstableArr, currentSSTable)
+			chosenIndexes = append(chosenIndexes, index)
+		}
 
-				//Proveravamo range
-				min, max := currentSSTable.GetRange()
-				if min < minKey {
-					minKey = min
-				}
-				if max > maxKey {
-					maxKey = max
-				}
-			}
+	}
 
-			//Cuva indekse od izabranih tabela iz narednog nivoa koje ulaze u kompakciju
-			chosenIndexes := make([]uint32, 0)
+	//Kljuc moze postojati jos samo u sstabelama oba nivoa koje ne ulaze u kompakciju i u nizim nivoima
+	current, next, older, err := lsm.compactionRanges(currentLevel)
+	if err != nil {
+		return err
+	}
+	chosen := 0
+	for i := range current {
+		if chosen < len(chosenCurrent) && chosenCurrent[chosen] == uint32(i+1) {
+			chosen++
+			continue
+		}
+		older = append(older, current[i])
+	}
+	chosen = 0
+	for i := range next {
+		if chosen < len(chosenIndexes) && chosenIndexes[chosen] == uint32(i+1) {
+			chosen++
+			continue
+		}
+		older = append(older, next[i])
+	}
+	filter := lsm.newTombstoneFilter(older)
 
-			//Prolazimo kroz naredni nivo
-			for index := uint32(1); index <= lsm.LevelSizes[currentLevel]; index++ {
-				currentSSTable := NewSSTable(uint32(config.MemtableSize), lsm.GenerateSSTableName(currentLevel+1, index))
+	//MERGE
+	numOfCreatedFiles, err := lsm.MergeSSTables(sstableArr, currentLevel, filter)
+	if err != nil {
+		return err
+	}
+	lsm.droppedTombstones.Add(filter.dropped + filter.droppedRanges)
 
-				//Biramo samo one koji upadaju u opseg
-				firstKey, lastKey := currentSSTable.GetRange()
-				if !(lastKey < minKey || firstKey > maxKey) {
-					sstableArr = append(sstableArr, currentSSTable)
-					chosenIndexes = append(chosenIndexes, index)
-				}
+	//Nove sstabele postaju vidljive istovremeno sa brisanjem starih
+	lsm.lock.Lock()
+	defer lsm.lock.Unlock()
+	plan := newInstallPlan()
+	lsm.LevelSizes[currentLevel] += numOfCreatedFiles
 
-			}
+	//Brisemo odabrane fajlove iz trenutnog nivoa
+	for _, index := range chosenCurrent {
+		plan.delete(currentLevel, index)
+	}
 
-			//MERGE
-			numOfCreatedFiles := lsm.MergeSSTables(sstableArr, currentLevel)
+	//Brisemo sve izabrane fajlove iz drugog dela
+	for i := 0; i < len(chosenIndexes); i++ {
+		plan.delete(currentLevel+1, chosenIndexes[i])
+	}
 
-			//Brisemo odabrane fajlove iz prvog nivoa
-			for i := uint32(1); i <= sstablesToCompactNum; i++ {
-				deleteSSTable(lsm.GenerateSSTableName(currentLevel, i))
-			}
+	//Rename fajlova
+	err = lsm.RenameLevelLeveled(currentLevel+1, numOfCreatedFiles, chosenIndexes, plan)
+	if err != nil {
+		return err
+	}
+	lsm.removeFromLevel(currentLevel, chosenCurrent, plan) //Menja imena od preostalih fajlova u trenutnom nivou
+	return lsm.install(plan)
+}
 
-			//Brisemo sve izabrane fajlove iz drugog dela
-			for i := 0; i < len(chosenIndexes); i++ {
-				deleteSSTable(lsm.GenerateSSTableName(currentLevel+1, chosenIndexes[i]))
-			}
+// Spaja sstabele u memoriji (par sstabela ili jednu sstabelu koja se prepisuje)
+// Cuva najnoviju verziju svakog kljuca i starije verzije koje su potrebne nekom snapshot-u
+// Operandi se spajaju datim operatorom ukoliko se vrednost na koju se primenjuju nalazi u ovim sstabelama
+// Tombstone-ovi i brisanja opsega koje filter dozvoli se izbacuju (filter moze biti nil)
+// Vraca i brisanja opsega koja ostaju u spojenoj sstabeli
+func MergeSSTablesInMemory(sstables []SST, snapshots *SnapshotList, operator MergeOperator, filter *tombstoneFilter) ([]string, []*Data, []*RangeTombstone, error) {
+	mergedKeys := make([]string, 0)
+	mergedData := make([]*Data, 0)
 
-			//Rename fajlova
-			lsm.RenameLevelLeveled(currentLevel+1, numOfCreatedFiles, chosenIndexes)
-			lsm.UpdateCurrentLevelNames(currentLevel, sstablesToCompactNum) //Menja imena od preostalih fajlova u trenutnom nivou
-			lsm.Write()
+	tombstones, err := readCompactionTombstones(sstables)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	err = mergeVersions(sstables, tombstones, snapshots, operator, filter, func(key string, versions []*Data) error {
+		for _, version := range versions {
+			mergedKeys = append(mergedKeys, key)
+			mergedData = append(mergedData, version)
 		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, nil, err
 	}
+	return mergedKeys, mergedData, filter.keepRanges(tombstones, snapshots), nil
 }
 
-// Spaja 2 sstabele
-func Merge2SSTables(firstSStable SST, secondSStable SST) ([]string, []*Data) {
-	file1, data1End := firstSStable.GoToData()
-	file2, data2End := secondSStable.GoToData()
+// Vraca broj koliko je kreirano novih sstabela u narednom nivou
+// Nove sstabele se zapisuju iza poslednje u narednom nivou, a pozivalac ih dodaje u LevelSizes
+// Tombstone-ovi i brisanja opsega koje filter dozvoli se izbacuju (filter moze biti nil)
+// Nova sstabela pokriva kljuceve od svog prvog do prvog kljuca naredne, pa brisanja opsega koja ostaju
+// dobija isecena na taj opseg (da se sstabele u nivou ne bi preklapale)
+func (lsm *Lsm) MergeSSTables(sstables []SST, currentLevel uint32, filter *tombstoneFilter) (uint32, error) {
+	config := lsm.config
+	nextSize := lsm.LevelSize(currentLevel + 1)
+	numOfCreatedFiles := uint32(0)
 
 	mergedKeys := make([]string, 0)
 	mergedData := make([]*Data, 0)
 
-	key1, data1 := "", new(Data)
-	key2, data2 := "", new(Data)
-
-	//Pomocne promenljive koje nam govore da li treba ici na sledeci element
-	toRead1 := true
-	toRead2 := true
-	for true {
-		//Kraj prve tabele
-		if isEndOfData(file1, data1End) {
-			if isEndOfData(file2, data2End) {
-				break
-			}
-
-			if key1 == key2 {
-				key2, data2 = ByteToData(file2)
-			}
-
-			//Prolazimo samo kroz drugu tabelu da prebacimo ostatak
-			for true {
-				mergedKeys = append(mergedKeys, key2)
-				mergedData = append(mergedData, data2)
-				if isEndOfData(file2, data2End) {
-					break
-				}
-				key2, data2 = ByteToData(file2)
-			}
-			break
+	tombstones, err := readCompactionTombstones(sstables)
+	if err != nil {
+		return 0, err
+	}
+	keptTombstones := filter.keepRanges(tombstones, lsm.snapshots)
+	firstKey := "" //Pocetak opsega sstabele koja se puni (prva nije ogranicena)
+
+	//Zapisuje sstabelu koja se puni, ukoliko ima sta da se zapise
+	flushChunk := func(nextKey string) error {
+		chunkTombstones := clipRangeTombstones(keptTombstones, firstKey, nextKey)
+		if len(mergedKeys) == 0 && len(chunkTombstones) == 0 {
+			return nil
+		}
+		err := lsm.flushMerged(currentLevel+1, nextSize+numOfCreatedFiles+1, mergedKeys, mergedData, chunkTombstones)
+		if err != nil {
+			return err
 		}
 
-		//Kraj druge tabele
-		if isEndOfData(file2, data2End) {
-			//Ukoliko su bili jednaki moramo preskociti trenutan
-			if key1 == key2 {
-				key1, data1 = ByteToData(file1)
-			}
+		//Resetujemo nizove
+		mergedKeys = make([]string, 0)
+		mergedData = make([]*Data, 0)
+		firstKey = nextKey
 
-			//Prolazimo samo kroz prvu tabelu da prebacimo ostatak
-			for true {
-				mergedKeys = append(mergedKeys, key1)
-				mergedData = append(mergedData, data1)
-				if isEndOfData(file1, data1End) {
-					break
-				}
-				key1, data1 = ByteToData(file1)
-			}
-			break
+		//Povecavamo counter
+		numOfCreatedFiles++
+		return nil
+	}
 
+	err = mergeVersions(sstables, tombstones, lsm.snapshots, lsm.operator, filter, func(key string, versions []*Data) error {
+		//Proveravamo da li smo napunili sstabelu
+		//Ukoliko jesmo flushujemo u visi nivo
+		//(sve verzije jednog kljuca uvek zavrsavaju u istoj sstabeli)
+		if len(mergedKeys) >= int(config.MemtableSize) {
+			err := flushChunk(key)
+			if err != nil {
+				return err
+			}
 		}
 
-		if toRead1 {
-			key1, data1 = ByteToData(file1)
-		}
-		if toRead2 {
-			key2, data2 = ByteToData(file2)
+		//Dodajemo u red za upis u novu sstabelu
+		for _, version := range versions {
+			mergedKeys = append(mergedKeys, key)
+			mergedData = append(mergedData, version)
 		}
-
-		if key1 == key2 {
-			if data2.Timestamp >= data1.Timestamp {
-				mergedKeys = append(mergedKeys, key2)
-				mergedData = append(mergedData, data2)
-			} else {
-				mergedKeys = append(mergedKeys, key1)
-				mergedData = append(mergedData, data1)
-			}
-			toRead1 = true
-			toRead2 = true
-		} else if key1 < key2 {
-			mergedKeys = append(mergedKeys, key1)
-			mergedData = append(mergedData, data1)
-			toRead1 = true
-			toRead2 = false
-		} else if key2 < key1 {
-			mergedKeys = append(mergedKeys, key2)
-			mergedData = append(mergedData, data2)
-			toRead1 = false
-			toRead2 = true
-		}
-
-	}
-	err := file1.Close()
+		return nil
+	})
 	if err != nil {
-		log.Fatal(err)
+		return 0, err
 	}
-	err = file2.Close()
+
+	//Ukoliko se nije flush sam izazvao a ima jos fajlova moramo ih zapisati
+	err = flushChunk("")
 	if err != nil {
-		log.Fatal(err)
+		return 0, err
 	}
-	return mergedKeys, mergedData
-}
 
-// Vraca broj koliko je kreirano novih sstabela u narednom nivou
-func (lsm *Lsm) MergeSSTables(sstables []SST, currentLevel uint32) uint32 {
-	config := GetConfig()
-	numOfCreatedFiles := uint32(0)
+	return numOfCreatedFiles, nil
+}
 
-	files := make([]*os.File, 0)    //Ovde cuvamo otvorene fajlove od svih sstabela
-	dataEnds := make([]uint64, 0)   //Ovde cuvamo krajeve data zona za svaku sstabelu
-	isEndOfFiles := make([]bool, 0) //Ovde cuvamo bool vrednost da li je cela sstabela predjena
+// Prolazi istovremeno kroz data zone svih datih sstabela po redosledu kljuceva
+// Za svaki kljuc skuplja sve njegove verzije iz svih sstabela, sortira ih od najnovije
+// i prosledjuje emit-u samo one koje moraju ostati (najnoviju i one koje vide snapshot-ovi)
+// Istekle verzije se prosledjuju bez vrednosti kao obrisane
+// Sacuvani operandi se zamenjuju vrednoscu izracunatom datim operatorom kada je to moguce
+// Tombstone-ovi koji nisu potrebni se izbacuju ukoliko je zadat filter
+// Verzije koje sakrivaju data brisanja opsega (i brisanja opsega iz filtera) se izbacuju ukoliko ih ne vidi nijedan snapshot
+func mergeVersions(sstables []SST, tombstones []*RangeTombstone, snapshots *SnapshotList, operator MergeOperator, filter *tombstoneFilter, emit func(key string, versions []*Data) error) error {
+	files := make([]*os.File, 0)  //Ovde cuvamo otvorene fajlove od svih sstabela
+	dataEnds := make([]uint64, 0) //Ovde cuvamo krajeve data zona za svaku sstabelu
 
 	keys := make([]string, len(sstables)) //Ovde cuvamo trenutne kljuceve
-	data := make([]*Data, len(sstables))  //Ovde cuvamo trenutan podatak
-	toRead := make([]bool, 0)             //Flag da li je potrebno citanje sledeceg elementa
+	data := make([]*Data, len(sstables))  //Ovde cuvamo trenutan podatak (nil ukoliko je sstabela predjena)
 
-	//Identifikacija sstabela i dodavanje u niz
-	for i := 0; i < len(sstables); i++ {
-		currentSSTable := sstables[i]
-
-		//otvaramo fajl i pozicioniramo se na data zonu
-		file, dataEnd := currentSSTable.GoToData()
-		files = append(files, file)
-		dataEnds = append(dataEnds, dataEnd)
+	//Verzije sakrivaju i brisanja opsega iz sstabela van kompakcije
+	if filter != nil {
+		tombstones = append(append([]*RangeTombstone{}, tombstones...), filter.covering...)
+	}
 
-		isEndOfFiles = append(isEndOfFiles, false) //na pocetku inicijalizujemo na false
+	//Zatvaramo sve fajlove na kraju
+	defer func() {
+		for _, file := range files {
+			file.Close()
+		}
+	}()
 
-		toRead = append(toRead, true) //Uvek prve elemente citamo
+	//Cita sledeci zapis iz i-te sstabele
+	readNext := func(i int) error {
+		end, err := isEndOfData(files[i], dataEnds[i])
+		if err != nil {
+			return err
+		}
+		if end {
+			data[i] = nil
+			return nil
+		}
+		keys[i], data[i], err = ByteToData(files[i])
+		return err
 	}
 
-	mergedKeys := make([]string, 0)
-	mergedData := make([]*Data, 0)
+	//otvaramo fajlove, pozicioniramo se na data zone i citamo prve zapise
+	for i := 0; i < len(sstables); i++ {
+		file, dataEnd, err := sstables[i].GoToData()
+		if err != nil {
+			return err
+		}
+		files = append(files, file)
+		dataEnds = append(dataEnds, dataEnd)
+		err = readNext(i)
+		if err != nil {
+			return err
+		}
+	}
 
 	for true {
-		tempKeys := make([]string, 0) //Cuvamo kljuceve koje uporedjujemo (necemo cuvati kljuceve od fajlova koji su predjeni)
-		tempData := make([]*Data, 0)  //Cuvamo podatke koje uporedjujemo
-
-		//Prolazimo kroz sve fajlove
+		//Trazimo najmanji kljuc medju sstabelama koje nisu predjene
+		minKey := ""
+		found := false
 		for i := 0; i < len(files); i++ {
-			if !isEndOfData(files[i], dataEnds[i]) {
-				if toRead[i] {
-					keys[i], data[i] = ByteToData(files[i])
-				}
-				tempKeys = append(tempKeys, keys[i])
-				tempData = append(tempData, data[i])
-			} else {
-				isEndOfFiles[i] = true
+			if data[i] != nil && (!found || keys[i] < minKey) {
+				minKey = keys[i]
+				found = true
 			}
 		}
 
-		//Svi su ubaceni i kraj
-		if len(tempKeys) < 1 {
+		//Sve su predjene i kraj
+		if !found {
 			break
 		}
 
-		//Trazimo koji je element sa najmanjom vrednoscu
-		minKey := tempKeys[0]
-		for i := 1; i < len(tempKeys); i++ {
-			if tempKeys[i] < minKey {
-				minKey = tempKeys[i]
-			}
-		}
-
-		//Trazimo koji element treba da procitamo po najvecem timestampu
-		newestData := new(Data)
-		newestData.Timestamp = 0
-		for i := 0; i < len(tempData); i++ {
-			if tempKeys[i] == minKey {
-				if tempData[i].Timestamp > newestData.Timestamp {
-					newestData = tempData[i]
+		//Skupljamo sve verzije najmanjeg kljuca
+		versions := make([]*Data, 0)
+		for i := 0; i < len(files); i++ {
+			for data[i] != nil && keys[i] == minKey {
+				versions = append(versions, data[i])
+				err := readNext(i)
+				if err != nil {
+					return err
 				}
 			}
 		}
 
-		//Obelezavamo sve koji su jednaki izabranom kljucu da se citaju
-		//Ostali zadrzavaju vrednost
-		for i := 0; i < len(toRead); i++ {
-			toRead[i] = keys[i] == minKey //Ovo neces videti u Novom Sadu :)
-		}
+		//Brisanja opsega koja sakrivaju verzije kljuca se dodaju kao privremeni tombstone-ovi
+		versions, covering := coverVersions(minKey, dropExpired(versions), tombstones)
 
-		//Dodajemo u red za upis u novu sstabelu
-		mergedKeys = append(mergedKeys, minKey)
-		mergedData = append(mergedData, newestData)
+		//Novija verzija je ona sa vecim rednim brojem upisa
+		sort.Slice(versions, func(i, j int) bool { return versions[i].Seq > versions[j].Seq })
 
-		//Proveravamo da li smo napunili sstabelu
-		//Ukoliko jesmo flushujemo u visi nivo
-		if len(mergedKeys) >= int(config.MemtableSize) {
-			lsm.LevelSizes[currentLevel]++ //Povecavamo broj fajlova u visem nivou
-			mergedSSTable := NewSSTable(uint32(config.MemtableSize), lsm.GenerateSSTableName(currentLevel+1, lsm.LevelSizes[currentLevel]))
-			mergedSSTable.Flush(mergedKeys, mergedData)
-
-			//Resetujemo nizove
-			mergedKeys = make([]string, 0)
-			mergedData = make([]*Data, 0)
-
-			//Povecavamo counter
-			numOfCreatedFiles++
+		kept := filter.uncover(versions, snapshots.KeepResolved(versions, foldOperands(operator, minKey, filter.allVersions(minKey))), covering)
+		if len(kept) == 0 {
+			continue
+		}
+		err := emit(minKey, filter.apply(minKey, kept))
+		if err != nil {
+			return err
 		}
-	}
-
-	//Ukoliko se nije flush sam izazvao a ima jos fajlova moramo ih zapisati
-	if len(mergedKeys) > 0 {
-		lsm.LevelSizes[currentLevel]++ //Povecavamo broj fajlova u visem nivou
-		mergedSSTable := NewSSTable(uint32(config.MemtableSize), lsm.GenerateSSTableName(currentLevel+1, lsm.LevelSizes[currentLevel]))
-		mergedSSTable.Flush(mergedKeys, mergedData)
-
-		//Povecavamo counter
-		numOfCreatedFiles++
 	}
 
 	//Zatvaramo sve fajlove
 	for _, file := range files {
 		err := file.Close()
 		if err != nil {
-			log.Fatal(err)
+			return NewIOError(err)
+		}
+	}
+	files = nil
+	return nil
+}
+
+// Istekle verzije zamenjuje brisanjem sa istim rednim brojem upisa
+// Vrednost se fizicki brise, ali zapis o brisanju ostaje jer nizi nivoi
+// mogu sadrzati starije verzije kljuca koje bi inace ponovo postale vidljive
+func dropExpired(versions []*Data) []*Data {
+	for i, version := range versions {
+		if version.Tombstone || !version.Expired() {
+			continue
+		}
+		deleted := NewData(make([]byte, 0), true, version.Timestamp)
+		deleted.Seq = version.Seq
+		versions[i] = deleted
+	}
+	return versions
+}
+
+// Vraca funkciju koja spaja lanac operanada sa vrednoscu na koju se primenjuju
+// Ukoliko vrednost nije u sstabelama koje se spajaju (nalazi se u nizim nivoima) ili spajanje ne uspe
+// operandi ostaju nepromenjeni, a greska ce se prijaviti pri citanju
+// Ukoliko je complete true (kompakcija sadrzi sve verzije kljuca) lanac bez vrednosti se primenjuje na nil
+func foldOperands(operator MergeOperator, key string, complete bool) func(versions []*Data) *Data {
+	if operator == nil {
+		return nil
+	}
+	return func(versions []*Data) *Data {
+		resolved, err := Resolve(operator, key, versions, complete)
+		if err != nil {
+			return nil
 		}
+		return resolved
 	}
+}
 
-	return numOfCreatedFiles
+// Zapisuje spojene podatke i brisanja opsega kao novu sstabelu sa zadatim indeksom u zadatom nivou
+// Bloomfilter se pravi za broj zapisa jer spojena sstabela moze biti veca od memtabele
+// (a za bar jedan, jer sstabela moze imati samo brisanja opsega)
+func (lsm *Lsm) flushMerged(level uint32, index uint32, keys []string, data []*Data, tombstones []*RangeTombstone) error {
+	config := lsm.config
+	size := uint32(len(keys))
+	if size == 0 {
+		size = 1
+	}
+	mergedSSTable, err := NewSSTable(size, lsm.GenerateSSTableName(level, index), config)
+	if err != nil {
+		return err
+	}
+	return mergedSSTable.Flush(keys, data, tombstones)
 }
 
 // Proveravamo da li smo prosli data zonu
-func isEndOfData(file *os.File, dataEnd uint64) bool {
+func isEndOfData(file *os.File, dataEnd uint64) (bool, error) {
 	currentOffset, err := file.Seek(0, 1)
 	if err != nil {
-		log.Fatal(err)
+		return false, NewIOError(err)
 	}
 	if uint64(currentOffset) >= dataEnd {
-		return true
+		return true, nil
 	}
-	return false
+	return false, nil
 }
 
 // Brise sstabelu
-func deleteSSTable(directory string) {
-	err := os.RemoveAll("files/sstable/" + directory)
-	if err != nil {
-		log.Fatal(err)
+func deleteSSTable(directory string) error {
+	return NewIOError(os.RemoveAll(directory))
+}
+
+// Broj sstabela koji leveled kompakcija dozvoljava u nivou
+// U prvom ne sme da ostane nijedna, a svaki naredni moze imati multiplier puta vise od prethodnog
+func (lsm *Lsm) maxLevelSSTables(currentLevel uint32) uint32 {
+	if currentLevel == 1 {
+		return 0
 	}
+	return uint32(math.Pow(float64(lsm.config.LeveledCompactionMultiplier), float64(currentLevel)-1))
 }
 
 // Racuna velicinu sstabele za zadati nivo
-func getSSTableSize(currentLevel uint32) uint32 {
-	config := GetConfig()
+func (lsm *Lsm) getSSTableSize(currentLevel uint32) uint32 {
+	config := lsm.config
 	//Racunamo velicinu naredne sstabele kao duplu od prethodne
 	//jer ne znamo kolika ce tacno biti velicina,
 	//mada ona nije ni toliko bitna jer je koristi samo bloomfilter za inicijalizaciju
@@ -720,104 +962,137 @@ func getSSTableSize(currentLevel uint32) uint32 {
 	return uint32(math.Pow(2, float64(currentLevel-1)) * float64(config.MemtableSize))
 }
 
+// Vraca sstabele redosledom kojim treba da se citaju (od najnovije ka najstarijoj)
+func (lsm *Lsm) readOrder(currentLevel uint32) []uint32 {
+	config := lsm.config
+	order := make([]uint32, 0, lsm.LevelSizes[currentLevel-1])
+	//iteriramo po sstabelama kako su dodavane(od najveceg indeksa, noviji ce se prvi citati)
+	if currentLevel == 1 || config.CompactionType == "size_tiered" {
+		for i := lsm.LevelSizes[currentLevel-1]; i > 0; i-- {
+			order = append(order, i)
+		}
+	} else { //Ukoliko je leveled kompakcija u visim nivoima svi podaci ce biti sortirani tako da treba citati sstabele redom
+		for i := uint32(1); i <= lsm.LevelSizes[currentLevel-1]; i++ {
+			order = append(order, i)
+		}
+	}
+	return order
+}
+
 // Trazi kljuc unutar svih sstabela
-func (lsm *Lsm) Find(key string) (bool, *Data) {
-	config := GetConfig()
+func (lsm *Lsm) Find(key string, seq uint64) (bool, *Data, error) {
+	lsm.lock.RLock()
+	defer lsm.lock.RUnlock()
+
 	//iteriramo po nivoima
+	//Vraca se verzija koja je vidljiva za dati redni broj upisa
+	//U jednom nivou kljuc se moze naci u vise sstabela, vraca se verzija sa najvecim rednim brojem upisa
+	//a svaki nivo sadrzi novije podatke od nivoa ispod njega
+	//Ukoliko je pronadjena verzija operand, u njen lanac (Older) se skupljaju starije verzije
+	//iz svih sstabela do prve koja nije operand
+	//Verzije koje sakriva brisanje opsega iz sstabela se preskacu
+	covering := lsm.coveringSeq(key, seq)
+	versions := make([]*Data, 0)
 	for currentLevel := uint32(1); currentLevel <= lsm.MaxLevel; currentLevel++ {
-		size := getSSTableSize(currentLevel)
-		//iteriramo po sstabelama kako su dodavane(od najveceg indeksa, noviji ce se prvi citati)
-		if currentLevel == 1 || config.CompactionType == "size_tiered" {
-			for i := lsm.LevelSizes[currentLevel-1]; i > 0; i-- {
-				currentSSTable := NewSSTable(size, lsm.GenerateSSTableName(currentLevel, i))
-				found, data := currentSSTable.Find(key)
-				if found {
-					return found, data
-				}
+		size := lsm.getSSTableSize(currentLevel)
+		levelVersions := make([]*Data, 0)
+		for _, i := range lsm.readOrder(currentLevel) {
+			currentSSTable, err := NewSSTable(size, lsm.GenerateSSTableName(currentLevel, i), lsm.config)
+			if err != nil {
+				return false, nil, err
 			}
-		} else { //Ukoliko je leveled kompakcija u visim nivoima svi podaci ce biti sortirani tako da treba citati sstabele redom
-			for i := uint32(1); i <= lsm.LevelSizes[currentLevel-1]; i++ {
-				currentSSTable := NewSSTable(size, lsm.GenerateSSTableName(currentLevel, i))
-				found, data := currentSSTable.Find(key)
-				if found {
-					return found, data
-				}
+			found, data, err := currentSSTable.Find(key, seq)
+			if err != nil {
+				return false, nil, err
+			}
+			for current := data; found && current != nil && current.Seq > covering; current = current.Older {
+				levelVersions = append(levelVersions, current)
+			}
+		}
+		sort.Slice(levelVersions, func(i, j int) bool { return levelVersions[i].Seq > levelVersions[j].Seq })
+		versions = append(versions, levelVersions...)
+
+		//Zaustavljamo se na prvoj verziji koja nije operand
+		for i, version := range versions {
+			if !version.Operand {
+				return true, linkVersions(versions[:i+1]), nil
 			}
 		}
 	}
-	return false, nil
+	if len(versions) > 0 {
+		return true, linkVersions(versions), nil
+	}
+	return false, nil, nil
 
 }
 
-// ---------- SKENIRANJE VISE PODATAKA ----------
+// Povezuje verzije (od najnovije ka najstarijoj) u lanac i vraca najnoviju
+func linkVersions(versions []*Data) *Data {
+	for i := 0; i < len(versions)-1; i++ {
+		versions[i].Older = versions[i+1]
+	}
+	versions[len(versions)-1].Older = nil
+	return versions[0]
+}
 
-// iterira po svim sstabelama i prekida ako je napunio trazenu stranicu
-func (lsm *Lsm) RangeScan(minKey string, maxKey string, scan *Scan) {
-	config := GetConfig()
+// ---------- ITERATORI ----------
 
-	//iteriramo po nivoima
-	for currentLevel := uint32(1); currentLevel <= lsm.MaxLevel; currentLevel++ {
-		size := getSSTableSize(currentLevel)
-		//iteriramo po sstabelama kako su dodavane(od najveceg indeksa, noviji ce se prvi citati)
-		if currentLevel == 1 || config.CompactionType == "size_tiered" {
-			for i := lsm.LevelSizes[currentLevel-1]; i > 0; i-- {
-				currentSSTable := NewSSTable(size, lsm.GenerateSSTableName(currentLevel, i))
-				currentSSTable.RangeScan(minKey, maxKey, scan)
-				if scan.FoundResults >= scan.SelectedPageEnd {
-					return
-				}
-			}
-		} else { //Ukoliko je leveled kompakcija u visim nivoima svi podaci ce biti sortirani tako da treba citati sstabele redom
-			for i := uint32(1); i <= lsm.LevelSizes[currentLevel-1]; i++ {
-				currentSSTable := NewSSTable(uint32(config.MemtableSize), lsm.GenerateSSTableName(currentLevel, i))
-				currentSSTable.RangeScan(minKey, maxKey, scan)
-				if scan.FoundResults >= scan.SelectedPageEnd {
-					return
-				}
-			}
+// Otvara iterator za svaku sstabelu u svim nivoima i vraca brisanja opsega iz istih sstabela
+// Pozivalac je duzan da ih zatvori, a ukoliko dodje do greske vec otvoreni se zatvaraju
+func (lsm *Lsm) NewIterators() ([]Iterator, []*RangeTombstone, error) {
+	//Iteratori drze otvorene fajlove pa nastavljaju da rade i kada kompakcija obrise ili preimenuje sstabele
+	lsm.lock.RLock()
+	defer lsm.lock.RUnlock()
+
+	iterators := make([]Iterator, 0)
+	closeAll := func() {
+		for _, it := range iterators {
+			it.Close()
 		}
 	}
-}
 
-// iterira po svim sstabelama i prekida ako je napunio trazenu stranicu
-func (lsm *Lsm) ListScan(prefix string, scan *Scan) {
-	config := GetConfig()
 	//iteriramo po nivoima
 	for currentLevel := uint32(1); currentLevel <= lsm.MaxLevel; currentLevel++ {
-		size := getSSTableSize(currentLevel)
-		//iteriramo po sstabelama kako su dodavane(od najveceg indeksa, noviji ce se prvi citati)
-		if currentLevel == 1 || config.CompactionType == "size_tiered" {
-			for i := lsm.LevelSizes[currentLevel-1]; i > 0; i-- {
-				currentSSTable := NewSSTable(size, lsm.GenerateSSTableName(currentLevel, i))
-				currentSSTable.ListScan(prefix, scan)
-				if scan.FoundResults >= scan.SelectedPageEnd {
-					return
-				}
+		size := lsm.getSSTableSize(currentLevel)
+		for _, i := range lsm.readOrder(currentLevel) {
+			currentSSTable, err := NewSSTable(size, lsm.GenerateSSTableName(currentLevel, i), lsm.config)
+			if err != nil {
+				closeAll()
+				return nil, nil, err
 			}
-		} else { //Ukoliko je leveled kompakcija u visim nivoima svi podaci ce biti sortirani tako da treba citati sstabele redom
-			for i := uint32(1); i <= lsm.LevelSizes[currentLevel-1]; i++ {
-				currentSSTable := NewSSTable(uint32(config.MemtableSize), lsm.GenerateSSTableName(currentLevel, i))
-				currentSSTable.ListScan(prefix, scan)
-				if scan.FoundResults >= scan.SelectedPageEnd {
-					return
-				}
+			it, err := currentSSTable.NewIterator()
+			if err != nil {
+				closeAll()
+				return nil, nil, err
 			}
+			iterators = append(iterators, it)
 		}
 	}
+	return iterators, lsm.allRangeTombstones(), nil
 }
 
 // ---------- PRINT IZ MEMORIJE -----------
 
-func (lsm *Lsm) Print() {
-	config := GetConfig()
+func (lsm *Lsm) Print() error {
+	lsm.lock.RLock()
+	defer lsm.lock.RUnlock()
+	config := lsm.config
 	for currentLevel := uint32(1); currentLevel <= lsm.MaxLevel; currentLevel++ {
 		if lsm.LevelSizes[currentLevel-1] > 0 {
 			fmt.Println("--------------------- LEVEL ", currentLevel, " ---------------------")
 			for i := uint32(1); i <= lsm.LevelSizes[currentLevel-1]; i++ {
 				fmt.Println("--------------------- SSTABLE - ", i, " ---------------------")
-				NewSSTable(uint32(config.MemtableSize), lsm.GenerateSSTableName(currentLevel, i)).ReadData()
+				sstable, err := NewSSTable(uint32(config.MemtableSize), lsm.GenerateSSTableName(currentLevel, i), config)
+				if err != nil {
+					return err
+				}
+				err = sstable.ReadData()
+				if err != nil {
+					return err
+				}
 				time.Sleep(time.Millisecond * 10) //Da ne bi preforsirali sistem u printovanju, u suprotnom se moze desiti da zabode
 			}
 		}
 	}
+	return nil
 }
@@ -0,0 +1,173 @@
+package lsm
+
+import (
+	. "project/keyvalue/structures/dataType"
+	. "project/keyvalue/structures/snapshot"
+	. "project/keyvalue/structures/sstable"
+)
+
+//Brisanja opsega (range tombstone) u sstabelama
+//Lsm drzi brisanja opsega svih sstabela u memoriji, pa ih GET i iteratori ne citaju sa diska
+//Ucitavaju se pri otvaranju, a osvezavaju pri flush-u i pri svakom ubacivanju rezultata kompakcije u nivoe
+//Brisanje opsega sakriva verzije kljuceva iz opsega sa manjim rednim brojem upisa u svim sstabelama
+//Kompakcija za svaki kljuc iz opsega dodaje privremeni tombstone sa rednim brojem brisanja, pa se sakrivene
+//verzije izbacuju isto kao verzije ispod tombstone-a (osim onih koje vidi neki snapshot), a privremeni
+//tombstone-ovi se zatim uklanjaju
+//Samo brisanje opsega se prepisuje u nove sstabele (iseceno na opseg svake od njih) dok god ga preklapa neka starija
+//sstabela van kompakcije ili postoji snapshot koji ga ne vidi
+
+// Ucitava brisanja opsega svih sstabela u nivoima
+// Sstabele koje je plan samo premestio zadrzavaju vec ucitana brisanja, a ostale se citaju sa diska (plan moze biti nil)
+// Pozivalac drzi lock
+func (lsm *Lsm) loadRangeTombstones(plan *installPlan) error {
+	deleted := make(map[sstableRef]bool)
+	moves := make(map[sstableRef]sstableRef)
+	if plan != nil {
+		for _, ref := range plan.deletes {
+			deleted[ref] = true
+		}
+		moves = plan.moves
+	}
+
+	loaded := make(map[sstableRef][]*RangeTombstone)
+	for level := uint32(1); level <= lsm.MaxLevel; level++ {
+		for index := uint32(1); index <= lsm.LevelSizes[level-1]; index++ {
+			ref := sstableRef{level, index}
+			source, moved := moves[ref]
+			if !moved {
+				source = ref
+			}
+			tombstones, found := lsm.rangeTombstones[source]
+			if !found || (!moved && deleted[ref]) {
+				sstable, err := NewSSTable(lsm.getSSTableSize(level), lsm.GenerateSSTableName(level, index), lsm.config)
+				if err != nil {
+					return err
+				}
+				tombstones, err = sstable.RangeTombstones()
+				if err != nil {
+					return err
+				}
+			}
+			loaded[ref] = tombstones
+		}
+	}
+	lsm.rangeTombstones = loaded
+	return nil
+}
+
+// Redni broj najnovijeg brisanja opsega iz sstabela koje sadrzi kljuc i vidljivo je za dati redni broj upisa
+// Pozivalac drzi lock
+func (lsm *Lsm) coveringSeq(key string, seq uint64) uint64 {
+	covering := uint64(0)
+	for _, tombstones := range lsm.rangeTombstones {
+		tableSeq := CoveringSeq(tombstones, key, seq)
+		if tableSeq > covering {
+			covering = tableSeq
+		}
+	}
+	return covering
+}
+
+// Sva brisanja opsega iz sstabela
+// Pozivalac drzi lock
+func (lsm *Lsm) allRangeTombstones() []*RangeTombstone {
+	all := make([]*RangeTombstone, 0)
+	for _, tombstones := range lsm.rangeTombstones {
+		all = append(all, tombstones...)
+	}
+	return all
+}
+
+// Cita brisanja opsega iz sstabela koje se spajaju
+func readCompactionTombstones(sstables []SST) ([]*RangeTombstone, error) {
+	all := make([]*RangeTombstone, 0)
+	for _, sstable := range sstables {
+		tombstones, err := sstable.RangeTombstones()
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, tombstones...)
+	}
+	return all, nil
+}
+
+// Vraca brisanja opsega koja moraju ostati u rezultatu kompakcije
+// Bez filtera se cuvaju sva
+func (filter *tombstoneFilter) keepRanges(tombstones []*RangeTombstone, snapshots *SnapshotList) []*RangeTombstone {
+	if filter == nil {
+		return tombstones
+	}
+	kept := make([]*RangeTombstone, 0)
+	for _, tombstone := range tombstones {
+		if snapshots.HasOlder(tombstone.Seq) || filter.overlapsOlder(tombstone) {
+			kept = append(kept, tombstone)
+			continue
+		}
+		filter.droppedRanges++
+	}
+	return kept
+}
+
+// Proverava da li opseg brisanja preklapa neku stariju sstabelu
+func (filter *tombstoneFilter) overlapsOlder(tombstone *RangeTombstone) bool {
+	for _, r := range filter.older {
+		if tombstone.Overlaps(r.min, r.max) {
+			return true
+		}
+	}
+	return false
+}
+
+// Dodaje privremeni tombstone za svako brisanje opsega koje sadrzi kljuc i sakriva neku od njegovih verzija
+// Vraca verzije sa dodatim tombstone-ovima (nesortirane) i skup dodatih
+func coverVersions(key string, versions []*Data, tombstones []*RangeTombstone) ([]*Data, map[*Data]bool) {
+	covering := make(map[*Data]bool)
+	oldest := versions[0].Seq
+	for _, version := range versions {
+		if version.Seq < oldest {
+			oldest = version.Seq
+		}
+	}
+	for _, tombstone := range tombstones {
+		if tombstone.Seq < oldest || !tombstone.Contains(key) {
+			continue
+		}
+		deleted := NewData(make([]byte, 0), true, tombstone.Timestamp)
+		deleted.Seq = tombstone.Seq
+		versions = append(versions, deleted)
+		covering[deleted] = true
+	}
+	return versions, covering
+}
+
+// Uklanja privremene tombstone-ove iz sacuvanih verzija
+// i broji verzije koje su izbacene iz kompakcije jer ih sakriva brisanje opsega
+func (filter *tombstoneFilter) uncover(versions []*Data, kept []*Data, covering map[*Data]bool) []*Data {
+	if len(covering) == 0 {
+		return kept
+	}
+	result := make([]*Data, 0, len(kept))
+	for _, version := range kept {
+		if !covering[version] {
+			result = append(result, version)
+		}
+	}
+	original := len(versions) - len(covering)
+	if filter != nil && original > len(result) {
+		filter.covered += uint64(original - len(result))
+	}
+	return result
+}
+
+// Vraca delove brisanja opsega koji padaju u opseg nove sstabele [min, max)
+// Prazna granica znaci da opseg s te strane nije ogranicen
+func clipRangeTombstones(tombstones []*RangeTombstone, min string, max string) []*RangeTombstone {
+	clipped := make([]*RangeTombstone, 0)
+	for _, tombstone := range tombstones {
+		part := tombstone.Clip(min, max)
+		if part != nil {
+			clipped = append(clipped, part)
+		}
+	}
+	return clipped
+}
@@ -0,0 +1,168 @@
+package lsm
+
+import (
+	. "project/keyvalue/structures/sstable"
+)
+
+//Time_window kompakcija
+//Sve sstabele ostaju u prvom nivou redom kojim su flush-ovane, a svaka pripada vremenskom prozoru
+//(TimeWindowSeconds) u kom je najkasniji upis u njoj (max_timestamp iz metadata)
+//Susedne sstabele istog prozora se spajaju u jednu, pa se podaci razlicitih prozora nikad ne mesaju:
+//stariji prozori se spajaju cim imaju bar 2 sstabele, a najnoviji tek kada ih ima TIME_WINDOW_ACTIVE_TABLES
+//(u njega jos stizu upisi, pa bi se inace prepisivao nakon svakog flush-a)
+//Spojena sstabela se do install-a zapisuje iza poslednje u drugom nivou, jer flush u medjuvremenu dodaje sstabele u prvi
+//(kompakcija prvog nivoa zauzima i drugi nivo)
+
+// Broj sstabela najnovijeg prozora pri kom se one spajaju
+const TIME_WINDOW_ACTIVE_TABLES = 4
+
+// Niz susednih sstabela prvog nivoa iz istog prozora
+type windowRun struct {
+	first     uint32
+	last      uint32
+	threshold uint32 //Broj sstabela pri kom se niz spaja
+}
+
+// Ocena niza, spaja se kada je bar 1
+func (run windowRun) score() float64 {
+	return float64(run.last-run.first+1) / float64(run.threshold)
+}
+
+// Deli sstabele prvog nivoa na nizove po prozorima (od najstarijeg)
+// Pozivalac drzi lock
+func (lsm *Lsm) windowRuns() ([]windowRun, error) {
+	runs := make([]windowRun, 0)
+	window := uint64(0)
+	for index := uint32(1); index <= lsm.LevelSizes[0]; index++ {
+		metadata, err := ReadMetadata(lsm.GenerateSSTableName(1, index))
+		if err != nil {
+			return nil, err
+		}
+		current := metadata.MaxTimestamp / uint64(lsm.config.TimeWindowSeconds)
+		if len(runs) > 0 && current == window {
+			runs[len(runs)-1].last = index
+			continue
+		}
+		runs = append(runs, windowRun{index, index, 2})
+		window = current
+	}
+	if len(runs) > 0 {
+		runs[len(runs)-1].threshold = TIME_WINDOW_ACTIVE_TABLES
+	}
+	return runs, nil
+}
+
+// Ocena prvog nivoa, najveca ocena medju nizovima
+func (lsm *Lsm) timeWindowScore() (float64, error) {
+	lsm.lock.RLock()
+	defer lsm.lock.RUnlock()
+	runs, err := lsm.windowRuns()
+	if err != nil {
+		return 0, err
+	}
+	score := float64(0)
+	for _, run := range runs {
+		if run.score() > score {
+			score = run.score()
+		}
+	}
+	return score, nil
+}
+
+// Velicina sstabela u nizovima koji cekaju spajanje
+func (lsm *Lsm) timeWindowPendingBytes() (uint64, error) {
+	lsm.lock.RLock()
+	defer lsm.lock.RUnlock()
+	runs, err := lsm.windowRuns()
+	if err != nil {
+		return 0, err
+	}
+	pending := uint64(0)
+	for _, run := range runs {
+		if run.score() < 1 {
+			continue
+		}
+		for index := run.first; index <= run.last; index++ {
+			bytes, err := sstableBytes(lsm.GenerateSSTableName(1, index))
+			if err != nil {
+				return 0, err
+			}
+			pending += bytes
+		}
+	}
+	return pending, nil
+}
+
+// Spaja nizove sstabela prvog nivoa koji su dostigli svoj prag, svaki u jednu sstabelu na mestu najstarije u nizu
+func (lsm *Lsm) TimeWindowCompaction() error {
+	lsm.lock.RLock()
+	runs, err := lsm.windowRuns()
+	lsm.lock.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	//Starije od niza su prethodne sstabele prvog nivoa i sve sstabele nizih nivoa
+	current, next, deeper, err := lsm.compactionRanges(1)
+	if err != nil {
+		return err
+	}
+	deeper = append(next, deeper...)
+	nextSize := lsm.LevelSize(2)
+	compacted := make([]windowRun, 0) //Spojeni nizovi
+	merged := make([]uint32, 0)       //Mesta spojenih sstabela (najstarija u nizu)
+	removed := make([]uint32, 0)      //Sstabele koje se brisu bez zamene
+
+	for _, run := range runs {
+		if run.score() < 1 {
+			continue
+		}
+		sstables := make([]SST, 0)
+		for index := run.first; index <= run.last; index++ {
+			sstable, err := NewSSTable(lsm.getSSTableSize(1), lsm.GenerateSSTableName(1, index), lsm.config)
+			if err != nil {
+				return err
+			}
+			sstables = append(sstables, sstable)
+		}
+
+		filter := lsm.newTombstoneFilter(append(append([]keyRange{}, current[:run.first-1]...), deeper...))
+		keys, data, tombstones, err := MergeSSTablesInMemory(sstables, lsm.snapshots, lsm.operator, filter)
+		if err != nil {
+			return err
+		}
+		lsm.droppedTombstones.Add(filter.dropped + filter.droppedRanges)
+		compacted = append(compacted, run)
+
+		first := run.first
+		if len(keys) > 0 || len(tombstones) > 0 {
+			err = lsm.flushMerged(2, nextSize+uint32(len(merged))+1, keys, data, tombstones)
+			if err != nil {
+				return err
+			}
+			merged = append(merged, run.first)
+			first++
+		}
+		for index := first; index <= run.last; index++ {
+			removed = append(removed, index)
+		}
+	}
+	if len(compacted) == 0 {
+		return nil
+	}
+
+	//Spojene sstabele postaju vidljive istovremeno sa brisanjem starih
+	lsm.lock.Lock()
+	defer lsm.lock.Unlock()
+	plan := newInstallPlan()
+	for _, run := range compacted {
+		for index := run.first; index <= run.last; index++ {
+			plan.delete(1, index)
+		}
+	}
+	for i, index := range merged {
+		plan.move(sstableRef{2, nextSize + uint32(i) + 1}, sstableRef{1, index})
+	}
+	lsm.removeFromLevel(1, removed, plan)
+	return lsm.install(plan)
+}
@@ -0,0 +1,290 @@
+package lsm
+
+import (
+	. "project/keyvalue/structures/dataType"
+	. "project/keyvalue/structures/sstable"
+)
+
+//Brisanje zapisa o brisanju (tombstone-ova) pri kompakciji
+//Tombstone je potreban samo dok postoje starije verzije kljuca koje sakriva
+//Kompakcija ga izbacuje kada nijedna starija sstabela van kompakcije ne moze sadrzati kljuc
+//(nizi nivoi i starije sstabele istog nivoa), a proverava se samo opseg kljuceva sstabela
+//Izbacuju se samo najstarije sacuvane verzije koje su tombstone-ovi: snapshot koji bi ih video
+//bez njih ne vidi nista, sto je isto kao i obrisan kljuc, dok tombstone izmedju dve vrednosti
+//i dalje sakriva stariju vrednost nekom snapshot-u i mora ostati
+//Tombstone ostaje i kada je osnova novijeg lanca operanada
+
+// Opseg kljuceva sstabele
+type keyRange struct {
+	min string
+	max string
+}
+
+// Odlucuje koji tombstone-ovi se mogu izbaciti iz jedne kompakcije i broji izbacene
+type tombstoneFilter struct {
+	older         []keyRange        //Opsezi starijih sstabela koje ne ucestvuju u kompakciji
+	covering      []*RangeTombstone //Brisanja opsega iz svih sstabela u nivoima (i onih van kompakcije)
+	dropped       uint64
+	droppedRanges uint64 //Izbacena brisanja opsega (vidi rangeTombstones.go)
+	covered       uint64 //Izbacene verzije koje su sakrivala brisanja opsega
+}
+
+// Da li je kompakcija izbacila bilo sta sto je bilo obrisano
+func (filter *tombstoneFilter) removedAny() bool {
+	return filter.dropped > 0 || filter.droppedRanges > 0 || filter.covered > 0
+}
+
+// Brisanja opsega iz svih sstabela se uzimaju pri pravljenju filtera
+// Brisanje opsega sakriva starije verzije bez obzira u kojoj se sstabeli nalaze, pa se verzije koje sakriva
+// izbacuju i kada ono ne ucestvuje u kompakciji (inace bi se sakrivene verzije u poslednjem nivou cuvale dok
+// se ne spoje sa sstabelom koja sadrzi brisanje)
+func (lsm *Lsm) newTombstoneFilter(older []keyRange) *tombstoneFilter {
+	filter := new(tombstoneFilter)
+	filter.older = older
+	lsm.lock.RLock()
+	filter.covering = lsm.allRangeTombstones()
+	lsm.lock.RUnlock()
+	return filter
+}
+
+// Proverava da li kljuc moze postojati u nekoj starijoj sstabeli
+func (filter *tombstoneFilter) inOlder(key string) bool {
+	for _, r := range filter.older {
+		if key >= r.min && key <= r.max {
+			return true
+		}
+	}
+	return false
+}
+
+// Da li kompakcija sadrzi sve verzije kljuca, tj. nijedna starija sstabela ga ne moze sadrzati
+// Bez filtera se to ne zna
+func (filter *tombstoneFilter) allVersions(key string) bool {
+	return filter != nil && !filter.inOlder(key)
+}
+
+// Izbacuje tombstone-ove sa kraja sacuvanih verzija (od najnovije ka najstarijoj) ukoliko nisu potrebni
+func (filter *tombstoneFilter) apply(key string, versions []*Data) []*Data {
+	if filter == nil {
+		return versions
+	}
+	end := len(versions)
+	for end > 0 && versions[end-1].Tombstone && (end == 1 || !versions[end-2].Operand) {
+		end--
+	}
+	if end == len(versions) || filter.inOlder(key) {
+		return versions
+	}
+	filter.dropped += uint64(len(versions) - end)
+	return versions[:end]
+}
+
+// Vraca opsege kljuceva sstabela nivoa (element i odgovara sstabeli i+1)
+// Pozivalac drzi lock
+func (lsm *Lsm) levelRanges(level uint32) ([]keyRange, error) {
+	config := lsm.config
+	ranges := make([]keyRange, 0, lsm.LevelSizes[level-1])
+	for index := uint32(1); index <= lsm.LevelSizes[level-1]; index++ {
+		sstable, err := NewSSTable(uint32(config.MemtableSize), lsm.GenerateSSTableName(level, index), config)
+		if err != nil {
+			return nil, err
+		}
+		min, max, err := sstable.GetRange()
+		if err != nil {
+			return nil, err
+		}
+		ranges = append(ranges, keyRange{min, max})
+	}
+	return ranges, nil
+}
+
+// Vraca opsege kljuceva sstabela nivoa koji se kompaktuje, narednog nivoa i svih nizih nivoa zajedno
+// Nivoe ispod kompakcije mogu u medjuvremenu menjati druge kompakcije, ali one samo premestaju postojece kljuceve,
+// a novije verzije dolaze samo odozgo, pa opsezi procitani na pocetku kompakcije vaze do njenog kraja
+func (lsm *Lsm) compactionRanges(level uint32) ([]keyRange, []keyRange, []keyRange, error) {
+	lsm.lock.RLock()
+	defer lsm.lock.RUnlock()
+	current, err := lsm.levelRanges(level)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	next, err := lsm.levelRanges(level + 1)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	deeper := make([]keyRange, 0)
+	for deeperLevel := level + 2; deeperLevel <= lsm.MaxLevel; deeperLevel++ {
+		levelRanges, err := lsm.levelRanges(deeperLevel)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		deeper = append(deeper, levelRanges...)
+	}
+	return current, next, deeper, nil
+}
+
+// Broj tombstone-ova (i brisanja opsega) koje su kompakcije izbacile od otvaranja baze
+func (lsm *Lsm) DroppedTombstones() uint64 {
+	return lsm.droppedTombstones.Load()
+}
+
+// Sstabela poslednjeg nivoa ciji prepis nije izbacio nista i stanje snapshot-ova pre prepisa
+// Prepis moze izbaciti vise tek kada se sstabela promeni ili kada se najstariji snapshot oslobodi
+type cleanedTable struct {
+	metadata Metadata
+	oldest   uint64 //Najstariji snapshot
+	pinned   bool   //Da li je postojao snapshot
+}
+
+// Vraca indekse sstabela nivoa ciji je udeo tombstone-ova bar TombstoneCompactionRatio (rastuce)
+// i najveci udeo tombstone-ova medju njima (0 ukoliko ih nema)
+// Sstabele poslednjeg nivoa ciji prepis nije izbacio nijedan tombstone (ni brisanje opsega) se preskacu
+// dok se ne promene one ili najstariji snapshot
+func (lsm *Lsm) tombstoneTables(level uint32) ([]uint32, float64, error) {
+	oldest, pinned := lsm.snapshots.Oldest()
+	lsm.lock.RLock()
+	defer lsm.lock.RUnlock()
+	indexes := make([]uint32, 0)
+	maxRatio := float64(0)
+	for index := uint32(1); index <= lsm.LevelSizes[level-1]; index++ {
+		name := lsm.GenerateSSTableName(level, index)
+		metadata, err := ReadMetadata(name)
+		if err != nil {
+			return nil, 0, err
+		}
+		ratio := metadata.TombstoneRatio()
+		if ratio < lsm.config.TombstoneCompactionRatio {
+			continue
+		}
+		cleaned, found := lsm.cleaned[name]
+		if found && cleaned.metadata == *metadata && cleaned.oldest == oldest && cleaned.pinned == pinned {
+			continue
+		}
+		indexes = append(indexes, index)
+		if ratio > maxRatio {
+			maxRatio = ratio
+		}
+	}
+	return indexes, maxRatio, nil
+}
+
+// Pamti da prepis sstabele nije izbacio nijedan tombstone (npr. potrebni su snapshot-u),
+// da je izbor kompakcije ne bi birao ponovo dok se ne oslobodi najstariji snapshot (oldest i pinned pre prepisa)
+// Pamti se samo dok je baza otvorena
+func (lsm *Lsm) markCleaned(name string, oldest uint64, pinned bool) error {
+	metadata, err := ReadMetadata(name)
+	if err != nil {
+		return err
+	}
+	lsm.lock.Lock()
+	defer lsm.lock.Unlock()
+	if lsm.cleaned == nil {
+		lsm.cleaned = make(map[string]cleanedTable)
+	}
+	lsm.cleaned[name] = cleanedTable{metadata: *metadata, oldest: oldest, pinned: pinned}
+	return nil
+}
+
+// Prepisuje sstabelu poslednjeg nivoa sa puno tombstone-ova (najstariju takvu)
+// Poslednji nivo nema gde da spusti sstabele, pa se tombstone-ovi mogu izbaciti samo prepisom u istom nivou
+// Starije verzije kljuceva koje tombstone sakriva su u starijim sstabelama istog nivoa (size_tiered),
+// pa se sstabela spaja sa svim sstabelama nivoa od najstarije koja se sa njom preklapa,
+// a kod leveled kompakcije se sstabele poslednjeg nivoa ne preklapaju i prepisuje se samo ona
+// Spojena sstabela zauzima mesto najstarije spojene, a sstabela iz koje su izbaceni svi zapisi se brise
+func (lsm *Lsm) TombstoneCompaction(currentLevel uint32) error {
+	heavy, _, err := lsm.tombstoneTables(currentLevel)
+	if err != nil || len(heavy) == 0 {
+		return err
+	}
+	lsm.lock.RLock()
+	current, err := lsm.levelRanges(currentLevel)
+	lsm.lock.RUnlock()
+	if err != nil {
+		return err
+	}
+	last := heavy[0]
+	first := last
+	if lsm.config.CompactionType == "size_tiered" {
+		for index := uint32(1); index < last; index++ {
+			if current[index-1].max >= current[last-1].min && current[index-1].min <= current[last-1].max {
+				first = index
+				break
+			}
+		}
+	}
+
+	//Snapshot oslobodjen tokom prepisa moze promeniti ishod, pa se pamti stanje pre njega
+	oldest, pinned := lsm.snapshots.Oldest()
+	rewritten, err := lsm.rewriteTables(currentLevel, first, last, current, false)
+	if err != nil || rewritten {
+		return err
+	}
+	return lsm.markCleaned(lsm.GenerateSSTableName(currentLevel, last), oldest, pinned)
+}
+
+// Spaja uzastopne sstabele nivoa od first do last u jednu koja zauzima mesto najstarije (first)
+// current su opsezi sstabela nivoa, a kljuc jos moze postojati samo u sstabelama pre first i u nizim nivoima
+// Ukoliko prepis nije izbacio nista sstabele se ne menjaju, osim kada je zadat force
+// Sstabela iz koje su izbaceni svi zapisi se brise, a vraca se da li je nivo promenjen
+func (lsm *Lsm) rewriteTables(level uint32, first uint32, last uint32, current []keyRange, force bool) (bool, error) {
+	levelSize := uint32(len(current))
+	sstables := make([]SST, 0)
+	for index := first; index <= last; index++ {
+		sstable, err := NewSSTable(lsm.getSSTableSize(level), lsm.GenerateSSTableName(level, index), lsm.config)
+		if err != nil {
+			return false, err
+		}
+		sstables = append(sstables, sstable)
+	}
+
+	older := append([]keyRange{}, current[:first-1]...)
+	lsm.lock.RLock()
+	for deeper := level + 1; deeper <= lsm.MaxLevel; deeper++ {
+		levelRanges, err := lsm.levelRanges(deeper)
+		if err != nil {
+			lsm.lock.RUnlock()
+			return false, err
+		}
+		older = append(older, levelRanges...)
+	}
+	lsm.lock.RUnlock()
+
+	filter := lsm.newTombstoneFilter(older)
+	keys, data, tombstones, err := MergeSSTablesInMemory(sstables, lsm.snapshots, lsm.operator, filter)
+	if err != nil {
+		return false, err
+	}
+	if !filter.removedAny() && !force {
+		return false, nil
+	}
+	lsm.droppedTombstones.Add(filter.dropped + filter.droppedRanges)
+	written := len(keys) > 0 || len(tombstones) > 0
+	//Nova sstabela se do install-a nalazi iza poslednje u nivou
+	//(u prvom nivou iza poslednje u drugom, jer flush dodaje sstabele na kraj prvog nivoa)
+	temp := sstableRef{level, levelSize + 1}
+	if level == 1 {
+		temp = sstableRef{2, lsm.LevelSize(2) + 1}
+	}
+	if written {
+		err = lsm.flushMerged(temp.level, temp.index, keys, data, tombstones)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	//Spojena sstabela postaje vidljiva istovremeno sa brisanjem starih
+	lsm.lock.Lock()
+	defer lsm.lock.Unlock()
+	plan := newInstallPlan()
+	removed := make([]uint32, 0)
+	for index := first; index <= last; index++ {
+		plan.delete(level, index)
+		removed = append(removed, index)
+	}
+	if written {
+		plan.move(temp, sstableRef{level, first})
+		removed = removed[1:]
+	}
+	lsm.removeFromLevel(level, removed, plan)
+	return true, lsm.install(plan)
+}
@@ -3,40 +3,51 @@ package memtable
 import (
 	. "project/keyvalue/config"
 	. "project/keyvalue/structures/dataType"
-	. "project/keyvalue/structures/scan"
+	. "project/keyvalue/structures/lsm"
+	. "project/keyvalue/structures/iterator"
+	. "project/keyvalue/structures/snapshot"
 )
 
 // da bi mogli nad oba tipa napisati funkcije pravimo interface
+// Memtabela se moze citati iz vise gorutina dok jedna upisuje (Put moze pozivati samo jedna gorutina u isto vreme)
 type MemTable interface {
-	Put(key string, data *Data)
-	Find(key string) (bool, *Data)
-	Remove(key string)
-	Flush()
+	Put(key string, data *Data)                //Podatak sa RangeDelete=true se cuva kao brisanje opsega, a ne kao verzija kljuca
+	Find(key string, seq uint64) (bool, *Data) //Ne uzima u obzir brisanja opsega
+	RangeTombstones() []*RangeTombstone
+	Size() uint
+	IsFull() bool
+	Flush() error //Upisuje sadrzaj u novu sstabelu, poziva se nad memtabelom u koju se vise ne upisuje
 	Print()
-	RangeScan(minKey string, maxKey string, scan *Scan)
-	ListScan(prefix string, scan *Scan)
+	NewIterator() Iterator //Iterator kroz kljuceve memtabele u trenutku kreiranja, vrednost sadrzi i lanac starijih verzija
 }
 
 //Konstruktor za memtabelu
-func NewMemTable(s uint) MemTable{
-	config := GetConfig()
+//Struktura i velicina se uzimaju iz date konfiguracije
+//Flush upisuje sstabelu u dato lsm stablo
+//Starije verzije kljuceva se cuvaju dok god su potrebne nekom od datih snapshot-ova
+func NewMemTable(config *Config, lsm *Lsm, snapshots *SnapshotList) MemTable{
 	var memTable MemTable
 	if config.MemtableStructure == "b_tree"{
-		memTable = NewMemTableTree(s)
-	} else if config.MemtableStructure == "skiplist"{
-		memTable = NewMemTableList(s)
+		memTable = NewMemTableTree(config.MemtableSize, config, lsm, snapshots)
+	} else {
+		memTable = NewMemTableList(config.MemtableSize, config, lsm, snapshots)
 	}
 	return memTable
 }
 
-//Poziva se pri ucitavanju iz wal-a
-//Smesta niz kljuceva i vrednosti u memoriju
-func LoadToMemTable(keys []string, data []*Data) MemTable{
-	config := GetConfig()
-	memtable := NewMemTable(config.MemtableSize)
-	for i:=0; i < len(keys); i++{
-		memtable.Put(keys[i], data[i])
+//Povezuje novu verziju sa trenutnom verzijom kljuca u memtabeli
+//Starije verzije ostaju u lancu samo dok su potrebne nekom snapshot-u
+//Brisanje se upisuje kao nova verzija sa tombstone=true pa se i ono razresava na isti nacin
+//current je trenutna verzija kljuca u memtabeli (nil ukoliko je nema)
+//Vraca false ukoliko memtabela vec sadrzi noviju verziju (sa vecim rednim brojem upisa)
+func linkVersion(snapshots *SnapshotList, current *Data, data *Data) bool {
+	if current == nil {
+		return true
 	}
-	return memtable
+	if current.Seq > data.Seq {
+		return false
+	}
+	data.Older = current
+	snapshots.PruneChain(data)
+	return true
 }
-
@@ -1,95 +1,130 @@
 package memtable
 
 import (
-	"log"
 	. "project/keyvalue/config"
 	. "project/keyvalue/structures/dataType"
 	. "project/keyvalue/structures/lsm"
-	. "project/keyvalue/structures/scan"
+	. "project/keyvalue/structures/iterator"
 	. "project/keyvalue/structures/skiplist"
+	. "project/keyvalue/structures/snapshot"
 	. "project/keyvalue/structures/sstable"
-	. "project/keyvalue/structures/wal"
-	"time"
+	"sync"
 )
 
 type MemTableList struct {
-	size  uint
-	slist *SkipList
+	size      uint
+	config    *Config
+	lsm       *Lsm
+	snapshots *SnapshotList
+	lock      sync.RWMutex //Citanja idu paralelno, a upis i praznjenje iskljucivo
+	slist     *SkipList
+	ranges    []*RangeTombstone //Brisanja opsega redom kojim su upisana
 }
 
 // konstuktor za skiplistu
-func NewMemTableList(s uint) *MemTableList {
-	config := GetConfig()
+func NewMemTableList(s uint, config *Config, lsm *Lsm, snapshots *SnapshotList) *MemTableList {
 	m := new(MemTableList)
 	m.slist = NewSkipList(config.SkiplistMaxHeight)
 	m.size = s
+	m.config = config
+	m.lsm = lsm
+	m.snapshots = snapshots
 	return m
 }
 
 func (m *MemTableList) Print() {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
 	m.slist.Print()
 }
 
-//Trazi zadati kljuc u memtabeli
-func (m *MemTableList) Find(key string) (bool, *Data) {
+//Trazi verziju zadatog kljuca koja je vidljiva za dati redni broj upisa
+func (m *MemTableList) Find(key string, seq uint64) (bool, *Data) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
 	node, found := m.slist.Find(key)
 	if !found {
 		return false, nil
 	}
-	return true, node.Data
+	data := node.Data.Visible(seq)
+	return data != nil, data
 }
 
 //Flush na disk -> kreira novu sstabelu
-func (m *MemTableList) Flush() {
+//Memtabela se ne prazni, vec je pozivalac odbacuje kada prestane da je koristi za citanje
+func (m *MemTableList) Flush() error {
+	config := m.config
 	keys := make([]string, 0)
 	values := make([]*Data, 0)
 	//dobavi sve sortirane podatke
+	m.lock.RLock()
 	m.slist.GetAllNodes(&keys, &values)
+	ranges := m.ranges
+	m.lock.RUnlock()
 
-	//praznjenje skipliste
-	newSkiplist := NewSkipList(m.size)
-	m.slist = newSkiplist
+	//Starije verzije koje su potrebne snapshot-ovima se zapisuju odmah iza najnovije
+	keys, values = m.snapshots.ExpandVersions(keys, values)
 
 	//Flush
-	sstable := NewSSTable(uint32(m.size), GenerateFlushName())
-	sstable.Flush(keys, values)
-	IncreaseLsmLevel(1)
-
-	//WAL -> kreiramo novi segment(log)
-	err := NewWriteAheadLog("files/wal").NewWALFile().Close()
+	name := m.lsm.GenerateFlushName()
+	sstable, err := NewSSTable(uint32(m.size), name, config)
+	if err != nil {
+		return err
+	}
+	err = sstable.Flush(keys, values, ranges)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
+	return m.lsm.AddFlushedSSTable(name, values, ranges)
 }
 
 //Ubacuje element u memtabelu
+//Memtabela se ne flush-uje sama, vec onaj ko je koristi proverava IsFull
+//(vise memtabela deli isti WAL pa se flush-uju zajedno)
 func (m *MemTableList) Put(key string, data *Data) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if data.RangeDelete {
+		m.ranges = append(m.ranges, NewRangeTombstone(key, data))
+		return
+	}
+	var current *Data
+	node, found := m.slist.Find(key)
+	if found {
+		current = node.Data
+	}
+	if !linkVersion(m.snapshots, current, data) {
+		return
+	}
 	m.slist.Put(key, data)
+}
 
-	if m.slist.GetSize() == m.size {
-		m.Flush()
-	}
+//Broj kljuceva i brisanja opsega u memtabeli
+func (m *MemTableList) Size() uint {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return m.slist.GetSize() + uint(len(m.ranges))
 }
 
-//Brise element iz memtabele
-func (m *MemTableList) Remove(key string) {
-	//Ukoliko nije nasao trazeni kljuc u Memtable
-	//Dodaje ga kao novi element sa tombstone=true
-	if !m.slist.Remove(key) {
-		data := new(Data)
-		data.Timestamp = uint64(time.Now().Unix())
-		data.Tombstone = true
-		data.Value = make([]byte, 0)
-		m.Put(key, data)
-	}
+//Brisanja opsega upisana u memtabelu
+func (m *MemTableList) RangeTombstones() []*RangeTombstone {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return append([]*RangeTombstone{}, m.ranges...)
 }
 
-// Trazi podatke ciji kljucevi spadaju u dati opseg
-func (m *MemTableList) RangeScan(minKey string, maxKey string, scan *Scan) {
-	m.slist.RangeScan(minKey, maxKey, scan)
+//Da li je memtabela dostigla zadatu velicinu i treba je flush-ovati
+func (m *MemTableList) IsFull() bool {
+	return m.Size() >= m.size
 }
 
-// Trazi podatke ciji kljucevi imaju dati prefix
-func (m *MemTableList) ListScan(prefix string, scan *Scan) {
-	m.slist.ListScan(prefix, scan)
+// Iterator kroz kljuceve memtabele
+// Kljucevi se kopiraju pri kreiranju pa kasniji upisi ne uticu na iterator
+func (m *MemTableList) NewIterator() Iterator {
+	keys := make([]string, 0)
+	values := make([]*Data, 0)
+	m.lock.RLock()
+	m.slist.GetAllNodes(&keys, &values)
+	m.lock.RUnlock()
+	return NewSliceIterator(keys, values)
 }
@@ -1,98 +1,129 @@
 package memtable
 
 import (
-	"log"
 	. "project/keyvalue/config"
 	. "project/keyvalue/structures/b_tree"
 	. "project/keyvalue/structures/dataType"
 	. "project/keyvalue/structures/lsm"
-	. "project/keyvalue/structures/scan"
+	. "project/keyvalue/structures/iterator"
+	. "project/keyvalue/structures/snapshot"
 	. "project/keyvalue/structures/sstable"
-	. "project/keyvalue/structures/wal"
-	"time"
+	"sync"
 )
 
 type MemTableTree struct {
-	size  uint
-	btree *BTree
+	size      uint
+	config    *Config
+	lsm       *Lsm
+	snapshots *SnapshotList
+	lock      sync.RWMutex //Citanja idu paralelno, a upis i praznjenje iskljucivo
+	btree     *BTree
+	ranges    []*RangeTombstone //Brisanja opsega redom kojim su upisana
 }
 
 // konstruktor za b stablo
-func NewMemTableTree(s uint) *MemTableTree {
-	config := GetConfig()
+func NewMemTableTree(s uint, config *Config, lsm *Lsm, snapshots *SnapshotList) *MemTableTree {
 	m := new(MemTableTree)
 	m.size = s
+	m.config = config
+	m.lsm = lsm
+	m.snapshots = snapshots
 	m.btree = NewBTree(config.BTreeNumOfChildren)
 	return m
 
 }
 
 func (m *MemTableTree) Print() {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
 	m.btree.PrintBTree()
 }
 
-//Trazi zadati kljuc u memtabeli
-func (m *MemTableTree) Find(key string) (bool, *Data) {
+//Trazi verziju zadatog kljuca koja je vidljiva za dati redni broj upisa
+func (m *MemTableTree) Find(key string, seq uint64) (bool, *Data) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
 	found, node := m.btree.FindNode(key)
 	if !found {
 		return false, nil
 	}
-	return true, node.Values[key]
+	data := node.Values[key].Visible(seq)
+	return data != nil, data
 }
 
 //Flush na disk -> kreira novu sstabelu
-func (m *MemTableTree) Flush() {
-	config := GetConfig()
+//Memtabela se ne prazni, vec je pozivalac odbacuje kada prestane da je koristi za citanje
+func (m *MemTableTree) Flush() error {
+	config := m.config
 
 	//dobavi sve sortirane podatke
 	keys := make([]string, 0)
 	values := make([]*Data, 0)
+	m.lock.RLock()
 	m.btree.InorderTraverse(m.btree.Root, &keys, &values)
+	ranges := m.ranges
+	m.lock.RUnlock()
 
-	//praznjenje b_stabla i rotacija
-	newBTree := NewBTree(config.BTreeNumOfChildren)
-	m.btree = newBTree
+	//Starije verzije koje su potrebne snapshot-ovima se zapisuju odmah iza najnovije
+	keys, values = m.snapshots.ExpandVersions(keys, values)
 
 	//Flush
-	sstable := NewSSTable(uint32(m.size), GenerateFlushName())
-	sstable.Flush(keys, values)
-	IncreaseLsmLevel(1)
-
-	//WAL -> kreiramo novi segment(log)
-	err := NewWriteAheadLog("files/wal").NewWALFile().Close()
+	name := m.lsm.GenerateFlushName()
+	sstable, err := NewSSTable(uint32(m.size), name, config)
+	if err != nil {
+		return err
+	}
+	err = sstable.Flush(keys, values, ranges)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
+	return m.lsm.AddFlushedSSTable(name, values, ranges)
 }
 
 //Ubacuje element u memtabelu
+//Memtabela se ne flush-uje sama, vec onaj ko je koristi proverava IsFull
+//(vise memtabela deli isti WAL pa se flush-uju zajedno)
 func (m *MemTableTree) Put(key string, data *Data) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if data.RangeDelete {
+		m.ranges = append(m.ranges, NewRangeTombstone(key, data))
+		return
+	}
+	var current *Data
+	found, node := m.btree.FindNode(key)
+	if found {
+		current = node.Values[key]
+	}
+	if !linkVersion(m.snapshots, current, data) {
+		return
+	}
 	m.btree.Put(key, data)
+}
 
-	if m.btree.Size == m.size {
-		m.Flush()
-	}
+//Broj kljuceva i brisanja opsega u memtabeli
+func (m *MemTableTree) Size() uint {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return m.btree.Size + uint(len(m.ranges))
 }
 
-//Brise element iz memtabele
-func (m *MemTableTree) Remove(key string) {
-	//Ukoliko nije nasao trazeni kljuc u Memtable
-	//Dodaje ga kao novi element sa tombstone=true
-	if !m.btree.Remove(key) {
-		data := new(Data)
-		data.Timestamp = uint64(time.Now().Unix())
-		data.Tombstone = true
-		data.Value = make([]byte, 0)
-		m.Put(key, data)
-	}
+//Brisanja opsega upisana u memtabelu
+func (m *MemTableTree) RangeTombstones() []*RangeTombstone {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return append([]*RangeTombstone{}, m.ranges...)
 }
 
-// Trazi podatke ciji kljucevi spadaju u dati opseg
-func (m *MemTableTree) RangeScan(minKey string, maxKey string, scan *Scan) {
-	m.btree.RangeScan(minKey, maxKey, m.btree.Root, scan)
+//Da li je memtabela dostigla zadatu velicinu i treba je flush-ovati
+func (m *MemTableTree) IsFull() bool {
+	return m.Size() >= m.size
 }
 
-// Trazi podatke ciji kljucevi imaju dati prefix
-func (m *MemTableTree) ListScan(prefix string, scan *Scan) {
-	m.btree.ListScan(prefix, m.btree.Root, scan)
+// Iterator kroz kljuceve memtabele
+// Iterator b stabla kopira kljuceve pri kreiranju pa kasniji upisi ne uticu na njega
+func (m *MemTableTree) NewIterator() Iterator {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return m.btree.NewIterator()
 }
@@ -0,0 +1,140 @@
+package merge_operator
+
+import (
+	"encoding/binary"
+	. "project/keyvalue/errs"
+	. "project/keyvalue/structures/cms"
+	. "project/keyvalue/structures/hll"
+)
+
+// ------------ INT64 ------------
+
+// Sabira brojeve, vrednost i operandi su int64 zapisani u 8 bajtova (BigEndian)
+// Kljuc koji ne postoji ima vrednost 0
+type Int64AddOperator struct{}
+
+func Int64ToBytes(number int64) []byte {
+	bytes := make([]byte, 8)
+	binary.BigEndian.PutUint64(bytes, uint64(number))
+	return bytes
+}
+
+func BytesToInt64(bytes []byte) (int64, error) {
+	if len(bytes) != 8 {
+		return 0, NewMergeError("int64 mora imati 8 bajtova, a ima %d", len(bytes))
+	}
+	return int64(binary.BigEndian.Uint64(bytes)), nil
+}
+
+func (operator Int64AddOperator) Name() string {
+	return "int64_add"
+}
+
+func (operator Int64AddOperator) FullMerge(key string, existing []byte, operands [][]byte) ([]byte, error) {
+	sum := int64(0)
+	if existing != nil {
+		number, err := BytesToInt64(existing)
+		if err != nil {
+			return nil, err
+		}
+		sum = number
+	}
+	for _, operand := range operands {
+		number, err := BytesToInt64(operand)
+		if err != nil {
+			return nil, err
+		}
+		sum += number
+	}
+	return Int64ToBytes(sum), nil
+}
+
+// ------------ STRING ------------
+
+// Nadovezuje operande na vrednost, izmedju njih se umece Delimiter
+type StringAppendOperator struct {
+	Delimiter string
+}
+
+func (operator StringAppendOperator) Name() string {
+	return "string_append"
+}
+
+func (operator StringAppendOperator) FullMerge(key string, existing []byte, operands [][]byte) ([]byte, error) {
+	value := make([]byte, 0)
+	first := true
+	if existing != nil {
+		value = append(value, existing...)
+		first = false
+	}
+	for _, operand := range operands {
+		if !first {
+			value = append(value, operator.Delimiter...)
+		}
+		value = append(value, operand...)
+		first = false
+	}
+	return value, nil
+}
+
+// ------------ HYPERLOGLOG ------------
+
+// Dodaje elemente (operande) u HyperLogLog sacuvan pod kljucem
+// Ukoliko kljuc ne postoji pravi se novi HyperLogLog sa zadatom preciznoscu
+type HyperLogLogAddOperator struct {
+	Precision uint8
+}
+
+func (operator HyperLogLogAddOperator) Name() string {
+	return "hyperloglog_add"
+}
+
+func (operator HyperLogLogAddOperator) FullMerge(key string, existing []byte, operands [][]byte) ([]byte, error) {
+	var hll *HLL
+	var err error
+	if existing != nil {
+		hll, err = BytesToHyperLogLog(existing)
+		if err != nil {
+			return nil, NewMergeError("%s", err.Error())
+		}
+	} else {
+		hll, err = NewHLL(operator.Precision)
+		if err != nil {
+			return nil, NewMergeError("%s", err.Error())
+		}
+	}
+	for _, operand := range operands {
+		hll.AddToHLL(string(operand))
+	}
+	return HyperLogLogToBytes(hll), nil
+}
+
+// ------------ COUNT MIN SKETCH ------------
+
+// Dodaje elemente (operande) u CountMinSketch sacuvan pod kljucem
+// Ukoliko kljuc ne postoji pravi se novi CountMinSketch sa zadatom preciznoscu i sigurnoscu
+type CountMinSketchAddOperator struct {
+	Epsilon float64
+	Delta   float64
+}
+
+func (operator CountMinSketchAddOperator) Name() string {
+	return "countminsketch_add"
+}
+
+func (operator CountMinSketchAddOperator) FullMerge(key string, existing []byte, operands [][]byte) ([]byte, error) {
+	var cms *CountMinSketch
+	if existing != nil {
+		var err error
+		cms, err = BytesToCountMinSketch(existing)
+		if err != nil {
+			return nil, NewMergeError("%s", err.Error())
+		}
+	} else {
+		cms = NewCountMinSketch(operator.Epsilon, operator.Delta)
+	}
+	for _, operand := range operands {
+		AddToCms(cms, operand)
+	}
+	return CountMinSkechToBytes(cms), nil
+}
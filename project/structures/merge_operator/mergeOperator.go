@@ -0,0 +1,89 @@
+package merge_operator
+
+import (
+	. "project/keyvalue/errs"
+	. "project/keyvalue/structures/dataType"
+	"strings"
+)
+
+// Operacija citanja-izmene-upisa koja se ne izvrsava pri upisu
+// db.Merge upisuje samo operand, a operandi se spajaju sa prethodnom vrednoscu kljuca
+// tek pri citanju i pri kompakciji
+type MergeOperator interface {
+	Name() string
+	//existing je trenutna vrednost kljuca (nil ukoliko kljuc ne postoji)
+	//operandi su poredjani od najstarijeg ka najnovijem
+	FullMerge(key string, existing []byte, operands [][]byte) ([]byte, error)
+}
+
+// Racuna vrednost kljuca od njegovih verzija (od najnovije ka najstarijoj) kojima je prva operand
+// Operandi se primenjuju na prvu stariju verziju koja nije operand (obrisana ili istekla znaci da kljuc ne postoji)
+// Ukoliko medju verzijama nema takve, a complete je true (date su sve verzije kljuca), operandi se primenjuju na nil
+// a ukoliko complete nije true vrednost se ne moze izracunati i vraca se nil
+// Rezultat ima redni broj najnovijeg operanda i vreme isteka vrednosti na koju su operandi primenjeni
+func Resolve(operator MergeOperator, key string, versions []*Data, complete bool) (*Data, error) {
+	if operator == nil {
+		return nil, ErrNoMergeOperator
+	}
+
+	i := 0
+	for i < len(versions) && versions[i].Operand {
+		i++
+	}
+	if i == len(versions) && !complete {
+		return nil, nil
+	}
+
+	var existing []byte
+	expiry := uint64(0)
+	if i < len(versions) && !versions[i].Deleted() {
+		existing = versions[i].Value
+		expiry = versions[i].Expiry
+	}
+
+	//Operandi od najstarijeg ka najnovijem
+	operands := make([][]byte, i)
+	for j := 0; j < i; j++ {
+		operands[i-1-j] = versions[j].Value
+	}
+
+	value, err := operator.FullMerge(key, existing, operands)
+	if err != nil {
+		return nil, err
+	}
+	data := NewData(value, false, versions[0].Timestamp)
+	data.Seq = versions[0].Seq
+	data.Expiry = expiry
+	return data, nil
+}
+
+// Bira operator po prefiksu kljuca (kada vise vrsta vrednosti deli istu familiju kolona)
+// Ukoliko vise prefiksa odgovara kljucu koristi se najduzi
+type PrefixMergeOperator struct {
+	operators map[string]MergeOperator
+}
+
+func NewPrefixMergeOperator(operators map[string]MergeOperator) *PrefixMergeOperator {
+	operator := new(PrefixMergeOperator)
+	operator.operators = operators
+	return operator
+}
+
+func (operator *PrefixMergeOperator) Name() string {
+	return "prefix"
+}
+
+func (operator *PrefixMergeOperator) FullMerge(key string, existing []byte, operands [][]byte) ([]byte, error) {
+	chosen := ""
+	var chosenOperator MergeOperator
+	for prefix, op := range operator.operators {
+		if strings.HasPrefix(key, prefix) && (chosenOperator == nil || len(prefix) > len(chosen)) {
+			chosen = prefix
+			chosenOperator = op
+		}
+	}
+	if chosenOperator == nil {
+		return nil, NewMergeError("ne postoji merge operator za kljuc %s", key)
+	}
+	return chosenOperator.FullMerge(key, existing, operands)
+}
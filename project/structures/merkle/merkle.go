@@ -51,19 +51,15 @@ func ReadFile(fileName string) []*Node {
 }
 
 //Upisivanje merkle root-a u metadata file
-func WriteFile(file *os.File, rootNode *Node) {
+func WriteFile(file *os.File, rootNode *Node) error {
 	writer := bufio.NewWriter(file)
 
 	_, err := writer.WriteString(rootNode.String())
 	if err != nil {
-		fmt.Println(err)
-		return
+		return err
 	}
 
-	err = writer.Flush()
-	if err != nil {
-		log.Fatal(err)
-	}
+	return writer.Flush()
 }
 
 // Prolazi kroz nodove koristi pomocnu listu
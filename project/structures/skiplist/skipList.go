@@ -5,7 +5,6 @@ import (
 	"math"
 	"math/rand"
 	. "project/keyvalue/structures/dataType"
-	. "project/keyvalue/structures/scan"
 	"strings"
 )
 
@@ -135,12 +134,8 @@ func (s *SkipList) Put(key string, data *Data) {
 
 //Regulise visinu skipliste
 func (s *SkipList) updateHeight() {
-	for currentLevel := s.height - 1; currentLevel >= 0; currentLevel-- {
-		if s.head.next[currentLevel] == nil {
-			s.height--
-		} else {
-			break
-		}
+	for s.height > 0 && s.head.next[s.height-1] == nil {
+		s.height--
 	}
 }
 
@@ -229,69 +224,3 @@ func (s *SkipList) Print() {
 	}
 	fmt.Println(strings.Repeat("_", 100))
 }
-
-
-func (s *SkipList) RangeScan(minKey string, maxKey string, scan *Scan){
-	currentNode := s.head
-	for currentNode.next[0] != nil {
-		if scan.FoundResults >= scan.SelectedPageEnd{
-			return
-		}
-
-		next := currentNode.next[0]
-		data := next.Data
-
-		if next.key >= minKey && next.key <= maxKey{
-			if !next.Data.Tombstone{
-				//Obelezimo dati kljuc da je procitan
-				scan.SelectedKeys[next.key] = true
-
-				scan.FoundResults++
-				if scan.FoundResults >= scan.SelectedPageStart && scan.FoundResults <= scan.SelectedPageEnd{
-					scan.Keys = append(scan.Keys, next.key)
-					scan.Data = append(scan.Data, data)
-				}
-			} else {
-				//Posto je obrisan oznacicemo ga kao obrisanog da se ne uzima u obzir dalje
-				scan.RemovedKeys[next.key] = true
-			}
-		} else if next.key > maxKey{
-			return
-		}
-
-
-		currentNode = next
-	}
-}
-
-func (s *SkipList) ListScan(prefix string, scan *Scan){
-	currentNode := s.head
-	for currentNode.next[0] != nil {
-		if scan.FoundResults >= scan.SelectedPageEnd{
-			return
-		}
-
-		next := currentNode.next[0]
-		data := next.Data
-
-		if strings.HasPrefix(next.key, prefix){
-			if !next.Data.Tombstone{
-				//Obelezimo dati kljuc da je procitan
-				scan.SelectedKeys[next.key] = true
-
-				scan.FoundResults++
-				if scan.FoundResults >= scan.SelectedPageStart && scan.FoundResults <= scan.SelectedPageEnd{
-					scan.Keys = append(scan.Keys, next.key)
-					scan.Data = append(scan.Data, data)
-				}
-			} else {
-				//Posto je obrisan oznacicemo ga kao obrisanog da se ne uzima u obzir dalje
-				scan.RemovedKeys[next.key] = true
-			}
-		} else if next.key > prefix{
-			return
-		}
-
-		currentNode = next
-	}
-}
\ No newline at end of file
@@ -0,0 +1,225 @@
+package snapshot
+
+import (
+	. "project/keyvalue/structures/dataType"
+	"sort"
+	"sync"
+)
+
+// Evidencija snapshot-ova koji su trenutno u upotrebi
+// Za svaki redni broj upisa pamti koliko snapshot-ova je vezano za njega
+// Memtabela i kompakcija na osnovu nje odlucuju koje starije verzije kljuca moraju sacuvati
+// Moze se koristiti iz vise gorutina istovremeno
+type SnapshotList struct {
+	lock    sync.Mutex
+	refs    map[uint64]int
+	visible uint64 //Poslednji objavljeni upis, verzija koju on vidi se u memtabeli cuva kao da je za nju snapshot
+}
+
+func NewSnapshotList() *SnapshotList {
+	list := new(SnapshotList)
+	list.refs = make(map[uint64]int)
+	return list
+}
+
+// Belezi novi snapshot vezan za dati redni broj
+func (list *SnapshotList) Acquire(seq uint64) {
+	list.lock.Lock()
+	defer list.lock.Unlock()
+	list.refs[seq]++
+}
+
+// Oslobadja snapshot, nakon toga verzije koje su bile potrebne samo njemu mogu biti obrisane
+// Vraca true ukoliko je time nestao najstariji ili najnoviji snapshot (vidi Oldest i Newest)
+func (list *SnapshotList) Release(seq uint64) bool {
+	list.lock.Lock()
+	defer list.lock.Unlock()
+	list.refs[seq]--
+	if list.refs[seq] > 0 {
+		return false
+	}
+	delete(list.refs, seq)
+	older, newer := false, false
+	for snapshotSeq := range list.refs {
+		if snapshotSeq < seq {
+			older = true
+		} else {
+			newer = true
+		}
+	}
+	return !older || !newer
+}
+
+// Broj razlicitih rednih brojeva za koje postoje snapshot-ovi
+func (list *SnapshotList) Len() int {
+	list.lock.Lock()
+	defer list.lock.Unlock()
+	return len(list.refs)
+}
+
+// Da li postoji snapshot koji ne vidi upis sa datim rednim brojem (kreiran je pre njega)
+func (list *SnapshotList) HasOlder(seq uint64) bool {
+	list.lock.Lock()
+	defer list.lock.Unlock()
+	for snapshotSeq := range list.refs {
+		if snapshotSeq < seq {
+			return true
+		}
+	}
+	return false
+}
+
+// Redni broj najstarijeg snapshot-a i da li snapshot-ovi postoje
+// Verzije koje kompakcija mora sacuvati se menjaju samo kada se on promeni
+func (list *SnapshotList) Oldest() (uint64, bool) {
+	list.lock.Lock()
+	defer list.lock.Unlock()
+	oldest, found := uint64(0), false
+	for seq := range list.refs {
+		if !found || seq < oldest {
+			oldest, found = seq, true
+		}
+	}
+	return oldest, found
+}
+
+// Redni broj najnovijeg snapshot-a i da li snapshot-ovi postoje
+// Fifo kompakcija ne brise sstabele sa verzijama koje on vidi
+func (list *SnapshotList) Newest() (uint64, bool) {
+	list.lock.Lock()
+	defer list.lock.Unlock()
+	newest, found := uint64(0), false
+	for seq := range list.refs {
+		if !found || seq > newest {
+			newest, found = seq, true
+		}
+	}
+	return newest, found
+}
+
+// Belezi poslednji objavljeni upis
+// Novija verzija kljuca moze biti u memtabeli pre nego sto je objavljena, a citaoci tada vide prethodnu
+func (list *SnapshotList) SetVisible(seq uint64) {
+	list.lock.Lock()
+	defer list.lock.Unlock()
+	list.visible = seq
+}
+
+// Vraca redne brojeve svih snapshot-ova i poslednjeg objavljenog upisa od najveceg ka najmanjem
+// (kompakcija vidi samo objavljene upise, pa na nju poslednji objavljeni upis ne utice)
+func (list *SnapshotList) sequences() []uint64 {
+	list.lock.Lock()
+	defer list.lock.Unlock()
+	seqs := make([]uint64, 0, len(list.refs)+1)
+	for seq := range list.refs {
+		seqs = append(seqs, seq)
+	}
+	seqs = append(seqs, list.visible)
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] > seqs[j] })
+	return seqs
+}
+
+// Od verzija jednog kljuca (sortiranih od najnovije ka najstarijoj) vraca one koje se moraju sacuvati
+// Najnovija se uvek cuva, a starija samo ukoliko je ona najnovija verzija koju neki snapshot vidi
+// (verzija i je vidljiva snapshot-u S ako je versions[i].Seq <= S < versions[i-1].Seq)
+// Ukoliko je sacuvana verzija operand cuvaju se i sve starije do prve koja nije operand,
+// jer se bez njih vrednost kljuca ne moze izracunati
+func (list *SnapshotList) KeepVersions(versions []*Data) []*Data {
+	return list.KeepResolved(versions, nil)
+}
+
+// Isto kao KeepVersions, ali resolve moze zameniti sacuvani operand izracunatom vrednoscu
+// (dobija verzije od operanda ka starijim, a vraca nil ukoliko vrednost ne moze da izracuna)
+// pa starije verzije koje su bile potrebne samo za njega vise ne moraju da se cuvaju
+func (list *SnapshotList) KeepResolved(versions []*Data, resolve func(versions []*Data) *Data) []*Data {
+	kept := make([]*Data, 0, 1)
+	next := 0 //Indeks prve verzije koja jos nije sacuvana kao deo lanca operanada
+	for _, i := range list.visibleIndexes(versions) {
+		if i < next {
+			continue
+		}
+		if !versions[i].Operand {
+			kept = append(kept, versions[i])
+			next = i + 1
+			continue
+		}
+		if resolve != nil {
+			resolved := resolve(versions[i:])
+			if resolved != nil {
+				kept = append(kept, resolved)
+				next = i + 1
+				continue
+			}
+		}
+
+		//Cuvamo ceo lanac operanada zajedno sa verzijom na koju se primenjuju
+		end := i
+		for end < len(versions) && versions[end].Operand {
+			end++
+		}
+		if end < len(versions) {
+			end++
+		}
+		kept = append(kept, versions[i:end]...)
+		next = end
+	}
+	return kept
+}
+
+// Vraca indekse verzija koje neko vidi: najnovije i onih koje su najnovije za neki snapshot
+func (list *SnapshotList) visibleIndexes(versions []*Data) []int {
+	if len(versions) == 0 {
+		return nil
+	}
+	indexes := []int{0}
+	seqs := list.sequences()
+	s := 0 //Indeks prvog snapshot-a koji jos nije pokriven
+	for i := 1; i < len(versions) && s < len(seqs); i++ {
+		//Preskacemo snapshot-ove koji vide neku noviju verziju
+		for s < len(seqs) && seqs[s] >= versions[i-1].Seq {
+			s++
+		}
+		if s < len(seqs) && seqs[s] >= versions[i].Seq {
+			indexes = append(indexes, i)
+		}
+	}
+	return indexes
+}
+
+// Isto kao KeepVersions ali nad lancem verzija iz memtabele (data.Older)
+// Menja se samo data (nova verzija koju jos niko nije procitao), a starije verzije
+// mogu biti kod citalaca (GET, iteratori) pa se u skraceni lanac ubacuju njihove kopije
+func (list *SnapshotList) PruneChain(data *Data) {
+	kept := list.KeepVersions(chainVersions(data))
+	current := kept[0]
+	for _, version := range kept[1:] {
+		older := *version
+		current.Older = &older
+		current = &older
+	}
+	current.Older = nil
+}
+
+// Vraca verzije iz lanca od najnovije ka najstarijoj
+func chainVersions(data *Data) []*Data {
+	versions := make([]*Data, 0)
+	for current := data; current != nil; current = current.Older {
+		versions = append(versions, current)
+	}
+	return versions
+}
+
+// Razvija lance verzija u niz zapisa za sstabelu
+// Svaki kljuc se ponavlja za svaku sacuvanu verziju, od najnovije ka najstarijoj
+func (list *SnapshotList) ExpandVersions(keys []string, values []*Data) ([]string, []*Data) {
+	expandedKeys := make([]string, 0, len(keys))
+	expandedValues := make([]*Data, 0, len(values))
+	for i := 0; i < len(keys); i++ {
+		//Lanac u memtabeli se ne menja jer ga citaoci mogu koristiti
+		for _, version := range list.KeepVersions(chainVersions(values[i])) {
+			expandedKeys = append(expandedKeys, keys[i])
+			expandedValues = append(expandedValues, version)
+		}
+	}
+	return expandedKeys, expandedValues
+}
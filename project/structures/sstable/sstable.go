@@ -2,27 +2,29 @@ package sstable
 
 import (
 	"encoding/binary"
-	"hash/crc32"
 	"io"
-	"log"
 	"os"
+	"path/filepath"
 	. "project/keyvalue/config"
+	. "project/keyvalue/errs"
 	. "project/keyvalue/structures/bloom"
 	. "project/keyvalue/structures/dataType"
 	. "project/keyvalue/structures/entry"
-	. "project/keyvalue/structures/scan"
+	. "project/keyvalue/structures/iterator"
+	"strconv"
+	"strings"
 )
 
 type SST interface {
-	MakeFiles() []*os.File
-	Flush(keys []string, values []*Data)
-	Find(key string) (bool, *Data)
-	RangeScan(minKey string, maxKey string, scan *Scan)
-	ListScan(prefix string, scan *Scan)
-	GoToData() (*os.File, uint64)
-	ReadData()
-	GetPosition() (uint32, uint32) //Vraca koji je nivo i koja je po redu sstabela u LSM stablu
-	GetRange() (string, string)    //Vraca range iz summaryja
+	MakeFiles() ([]*os.File, error)
+	Flush(keys []string, values []*Data, tombstones []*RangeTombstone) error //Zapisuje verzije kljuceva i brisanja opsega
+	Find(key string, seq uint64) (bool, *Data, error) //Vraca verziju kljuca koja je vidljiva za dati redni broj upisa
+	NewIterator() (Iterator, error) //Iterator kroz sve verzije svih kljuceva, mora se zatvoriti nakon upotrebe
+	GoToData() (*os.File, uint64, error)
+	ReadData() error
+	GetPosition() (uint32, uint32, error) //Vraca koji je nivo i koja je po redu sstabela u LSM stablu
+	GetRange() (string, string, error)    //Vraca range iz summaryja
+	RangeTombstones() ([]*RangeTombstone, error) //Vraca brisanja opsega zapisana u sstabeli
 }
 
 type Index struct {
@@ -38,16 +40,11 @@ type Summary struct {
 }
 
 //Konstruktor
-func NewSSTable(size uint32, directory string) SST {
-	config := GetConfig()
-	var sstable SST
-	if config.SSTableFileConfig == "single" {
-		sstable = NewSSTableSingle(size, directory)
-	} else if config.SSTableFileConfig == "multi" {
-		sstable = NewSSTableMulti(size, directory)
+func NewSSTable(size uint32, directory string, config *Config) (SST, error) {
+	if config.SSTableFileConfig == "multi" {
+		return NewSSTableMulti(size, directory, config)
 	}
-
-	return sstable
+	return NewSSTableSingle(size, directory, config)
 }
 
 // ------------- PAKOVANJE -------------
@@ -64,20 +61,21 @@ func indexToByte(index *Index) []byte {
 }
 
 // odpakuje niz bajtova u indeks
-func byteToIndex(file *os.File, Offset ...uint64) *Index {
+// Na kraju fajla vraca nil, nil
+func byteToIndex(file *os.File, Offset ...uint64) (*Index, error) {
 	if len(Offset) > 0 {
 		_, err := file.Seek(int64(Offset[0]), 0)
 		if err != nil {
-			log.Fatal(err)
+			return nil, NewIOError(err)
 		}
 	}
 	bytes := make([]byte, 12) //pravimo mesta za Offset(8) i keysize(4)
-	_, err := file.Read(bytes)
+	_, err := io.ReadFull(file, bytes)
 	if err != nil {
 		if err == io.EOF {
-			return nil
+			return nil, nil
 		}
-		log.Fatal(err)
+		return nil, readError(file, err)
 	}
 
 	//citamo ucitane vrednosti
@@ -87,74 +85,115 @@ func byteToIndex(file *os.File, Offset ...uint64) *Index {
 
 	//citamo kljuc
 	keyBytes := make([]byte, index.KeySize)
-	_, err = file.Read(keyBytes)
+	_, err = io.ReadFull(file, keyBytes)
 	if err != nil {
-		log.Fatal(err)
+		return nil, readError(file, err)
 	}
 	index.Key = string(keyBytes)
 
-	return index
+	return index, nil
+}
+
+// Kraj fajla usred strukture znaci da je sstabela ostecena
+func readError(file *os.File, err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return NewCorruptionError("sstabela %s je nepotpuna", file.Name())
+	}
+	return NewIOError(err)
 }
 
 // Pakuje kljuc-vrednost i ostale podatke u niz bajtova za zapis na disku
+// Zapis na disku ima isti format kao i zapis u WAL-u (ukljucujuci redni broj upisa)
 func dataToByte(Key string, data *Data) []byte {
-	//izracunaj duzinu kljuca i vrednosti
-	Key_size := make([]byte, 8)
-	Value_size := make([]byte, 8)
-	binary.BigEndian.PutUint64(Key_size, uint64(int64(len([]byte(Key)))))
-	binary.BigEndian.PutUint64(Value_size, uint64(int64(len(data.Value))))
-
-	keyBytes := []byte(Key)
-	valueBytes := data.Value
-	timestampBytes := make([]byte, 8)
-	binary.BigEndian.PutUint64(timestampBytes, data.Timestamp)
-
-	//Tombstone
-	tombstoneBytes := make([]byte, 0)
-	if data.Tombstone {
-		tombstoneBytes = append(tombstoneBytes, uint8(1))
-	} else {
-		tombstoneBytes = append(tombstoneBytes, uint8(0))
-	}
-
-	//ubaci sve u niz bajtova da bi napravio Crc
-	bytes := make([]byte, 0)
-	bytes = append(bytes, timestampBytes...)
-	bytes = append(bytes, tombstoneBytes...)
-	bytes = append(bytes, Key_size...)
-	bytes = append(bytes, Value_size...)
-	bytes = append(bytes, keyBytes...)
-	bytes = append(bytes, valueBytes...)
-	Crc := make([]byte, 4)
-	binary.BigEndian.PutUint32(Crc, uint32(crc32.ChecksumIEEE(bytes)))
-
-	returnBytes := Crc                          //Prvih 4 bajta
-	returnBytes = append(returnBytes, bytes...) //Ostali podaci
-
-	return returnBytes
+	return EntryToBytes(NewEntry(Key, data))
 }
 
 // Odpakuje sa zapisa na disku u podatak
-func ByteToData(file *os.File, Offset ...uint64) (string, *Data) {
+func ByteToData(file *os.File, Offset ...uint64) (string, *Data, error) {
 	if len(Offset) > 0 {
 		_, err := file.Seek(int64(Offset[0]), 0)
 		if err != nil {
-			log.Fatal(err)
+			return "", nil, NewIOError(err)
 		}
 	}
 
-	entry := ReadEntry(file)
+	entry, err := ReadEntry(file)
+	if err != nil {
+		return "", nil, err
+	}
+	if entry == nil {
+		return "", nil, NewCorruptionError("sstabela %s nema ocekivani zapis", file.Name())
+	}
+
+	Key, data := entry.ToData()
+	return Key, data, nil
+}
+
+// Cita indeks sa trenutne pozicije ukoliko nije dostignut kraj indeksne zone
+// (u sstable.bin iza indeksa odmah sledi summary pa se ne sme citati preko)
+// Na kraju zone vraca nil, nil
+func byteToIndexBefore(file *os.File, indexEnd uint64) (*Index, error) {
+	position, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, NewIOError(err)
+	}
+	if uint64(position) >= indexEnd {
+		return nil, nil
+	}
+	return byteToIndex(file)
+}
+
+// Verzije istog kljuca su u data zoni zapisane jedna za drugom (od najnovije ka najstarijoj)
+// a indeks pokazuje samo na najnoviju
+// Cita verzije od date pozicije i vraca prvu koja je vidljiva za dati redni broj upisa
+// Ukoliko je ona operand, starije verzije do prve koja nije operand se ucitavaju u njen lanac (Older)
+// Ukoliko u sstabeli nema vidljive verzije vraca nil umesto podatka
+func readVisible(file *os.File, offset uint64, dataEnd uint64, seq uint64) (string, *Data, error) {
+	key, data, err := ByteToData(file, offset)
+	if err != nil {
+		return "", nil, err
+	}
 
-	//Tombstone
-	tombstone := false
-	if entry.Tombstone[0] == byte(uint8(1)) {
-		tombstone = true
+	//Cita narednu verziju istog kljuca, nil ukoliko je nema
+	readOlder := func() (*Data, error) {
+		position, err := file.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, NewIOError(err)
+		}
+		if uint64(position) >= dataEnd {
+			return nil, nil
+		}
+		nextKey, nextData, err := ByteToData(file)
+		if err != nil {
+			return nil, err
+		}
+		if nextKey != key {
+			return nil, nil
+		}
+		return nextData, nil
 	}
-	timestamp := binary.BigEndian.Uint64(entry.Timestamp)
-	data := NewData(entry.Value, tombstone, timestamp)
-	Key := string(entry.Key)
 
-	return Key, data
+	for data.Seq > seq {
+		data, err = readOlder()
+		if err != nil {
+			return "", nil, err
+		}
+		if data == nil {
+			return key, nil, nil
+		}
+	}
+
+	//Lanac operanada do vrednosti na koju se primenjuju
+	for current := data; current.Operand; current = current.Older {
+		current.Older, err = readOlder()
+		if err != nil {
+			return "", nil, err
+		}
+		if current.Older == nil {
+			break
+		}
+	}
+	return key, data, nil
 }
 
 // Priprema summary u niz bajtova za upis
@@ -186,7 +225,7 @@ func summaryToByte(summary *Summary) []byte {
 }
 
 // Cita summary iz summary fajla
-func byteToSummary(file *os.File) *Summary {
+func byteToSummary(file *os.File) (*Summary, error) {
 	summary := new(Summary)
 	summary.Intervals = make([]*Index, 0)
 	bytes := make([]byte, 4)
@@ -195,52 +234,54 @@ func byteToSummary(file *os.File) *Summary {
 	//1 - duzina prvog kljuca
 	//2 - duzina drugog kljuca
 	//3 - broj intervala
-	_, err := file.Read(bytes)
+	_, err := io.ReadFull(file, bytes)
 	if err != nil {
-		log.Fatal(err)
+		return nil, readError(file, err)
 	}
 	firstKeyLen := binary.BigEndian.Uint32(bytes)
 
 	bytes = make([]byte, 4)
-	_, err = file.Read(bytes)
+	_, err = io.ReadFull(file, bytes)
 	if err != nil {
-		log.Fatal(err)
+		return nil, readError(file, err)
 	}
 	lastKeyLen := binary.BigEndian.Uint32(bytes)
 
 	bytes = make([]byte, 4)
-	_, err = file.Read(bytes)
+	_, err = io.ReadFull(file, bytes)
 	if err != nil {
-		log.Fatal(err)
+		return nil, readError(file, err)
 	}
 	intervalsNum := binary.BigEndian.Uint32(bytes)
 
 	//CITAMO GLAVNI DEO
 	bytes = make([]byte, firstKeyLen)
-	_, err = file.Read(bytes)
+	_, err = io.ReadFull(file, bytes)
 	if err != nil {
-		log.Fatal(err)
+		return nil, readError(file, err)
 	}
 	summary.FirstKey = string(bytes)
 
 	bytes = make([]byte, lastKeyLen)
-	_, err = file.Read(bytes)
+	_, err = io.ReadFull(file, bytes)
 	if err != nil {
-		log.Fatal(err)
+		return nil, readError(file, err)
 	}
 	summary.LastKey = string(bytes)
 
 	//CITAMO NIZ INDEKSA
-	index := new(Index)
 	for i := 0; i < int(intervalsNum); i++ {
-		index = byteToIndex(file)
+		index, err := byteToIndex(file)
+		if err != nil {
+			return nil, err
+		}
 		if index == nil {
 			break
 		}
 		summary.Intervals = append(summary.Intervals, index)
 	}
 
-	return summary
+	return summary, nil
 }
 
 // pomocne funkcije za konvertovanje niza bool-ova u niz bajtova
@@ -302,45 +343,48 @@ func BloomFilterToByte(blm *BloomFilter) []byte {
 	return bytes
 }
 
-func ByteToBloomFilter(file *os.File) *BloomFilter {
+func ByteToBloomFilter(file *os.File) (*BloomFilter, error) {
 	blm := new(BloomFilter)
 	bytes := make([]byte, 4)
 
 	//Ucitavamo konstante
-	_, err := file.Read(bytes)
+	_, err := io.ReadFull(file, bytes)
 	if err != nil {
-		log.Fatal(err)
+		return nil, readError(file, err)
 	}
 	blm.K = binary.BigEndian.Uint32(bytes)
 
 	bytes = make([]byte, 4)
-	_, err = file.Read(bytes)
+	_, err = io.ReadFull(file, bytes)
 	if err != nil {
-		log.Fatal(err)
+		return nil, readError(file, err)
 	}
 	blm.N = binary.BigEndian.Uint32(bytes)
 
 	bytes = make([]byte, 4)
-	_, err = file.Read(bytes)
+	_, err = io.ReadFull(file, bytes)
 	if err != nil {
-		log.Fatal(err)
+		return nil, readError(file, err)
 	}
 	blm.M = binary.BigEndian.Uint32(bytes)
 
 	bytes = make([]byte, 4)
-	_, err = file.Read(bytes)
+	_, err = io.ReadFull(file, bytes)
 	if err != nil {
-		log.Fatal(err)
+		return nil, readError(file, err)
 	}
 	bitsetSize := binary.BigEndian.Uint32(bytes)
 
 	//Ucitavamo bitset
 	bytes = make([]byte, bitsetSize)
-	_, err = file.Read(bytes)
+	_, err = io.ReadFull(file, bytes)
 	if err != nil {
-		log.Fatal(err)
+		return nil, readError(file, err)
 	}
 	blm.Bitset = bytesToBools(bytes)
+	if uint32(len(blm.Bitset)) < blm.M {
+		return nil, NewCorruptionError("bloom filter u %s je ostecen", file.Name())
+	}
 	blm.Bitset = blm.Bitset[0:blm.M] //Osisamo visak u poslednjem bajtu
 
 	blm.HashFuncs = make([]HashWithSeed, 0)
@@ -349,21 +393,44 @@ func ByteToBloomFilter(file *os.File) *BloomFilter {
 	for i := uint32(0); i < blm.K; i++ {
 		//Ucitavamo duzinu trenutne hf
 		bytes = make([]byte, 4)
-		_, err = file.Read(bytes)
+		_, err = io.ReadFull(file, bytes)
 		if err != nil {
-			log.Fatal(err)
+			return nil, readError(file, err)
 		}
 		hashFuncLen := binary.BigEndian.Uint32(bytes)
 
 		//citamo hf
 		bytes = make([]byte, hashFuncLen)
-		_, err = file.Read(bytes)
+		_, err = io.ReadFull(file, bytes)
 		if err != nil {
-			log.Fatal(err)
+			return nil, readError(file, err)
 		}
 		hashWithSeed.Seed = bytes
 		blm.HashFuncs = append(blm.HashFuncs, *hashWithSeed)
 	}
 
-	return blm
+	return blm, nil
+}
+
+// Putanja sstabele se zavrsava sa .../levelX/sstableY
+// vraca X i Y
+func parsePosition(directory string) (uint32, uint32, error) {
+	arr := strings.Split(filepath.ToSlash(directory), "/")
+	if len(arr) < 2 {
+		return 0, 0, NewCorruptionError("neispravna putanja sstabele %s", directory)
+	}
+	levelString := strings.TrimPrefix(arr[len(arr)-2], "level")
+	fileString := strings.TrimPrefix(arr[len(arr)-1], "sstable")
+
+	levelNum, err := strconv.Atoi(levelString)
+	if err != nil {
+		return 0, 0, NewCorruptionError("neispravna putanja sstabele %s", directory)
+	}
+
+	fileNum, err := strconv.Atoi(fileString)
+	if err != nil {
+		return 0, 0, NewCorruptionError("neispravna putanja sstabele %s", directory)
+	}
+
+	return uint32(levelNum), uint32(fileNum), nil
 }
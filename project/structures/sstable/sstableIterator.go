@@ -0,0 +1,148 @@
+package sstable
+
+import (
+	"io"
+	"os"
+	. "project/keyvalue/errs"
+	. "project/keyvalue/structures/dataType"
+	"sort"
+)
+
+// Iterator kroz jednu sstabelu (zajednicki za oba formata)
+// Indeks se ucitava ceo pri otvaranju, a podaci se citaju sa diska tek kada se iterator postavi na kljuc
+// Indeks pokazuje samo na najnoviju verziju kljuca, pa se pri postavljanju na kljuc
+// citaju sve njegove verzije (do pocetka narednog kljuca)
+type SSTableIterator struct {
+	file      *os.File
+	dataStart uint64   //Pocetak data zone (offseti u indeksu su relativni u odnosu na nju)
+	dataEnd   uint64   //Kraj data zone
+	indexes   []*Index //Svi indeksi sstabele redom
+	position  int      //Trenutan indeks
+	versions  []*Data  //Verzije trenutnog kljuca od najnovije ka najstarijoj
+	version   int      //Trenutna verzija
+	err       error
+}
+
+func newSSTableIterator(file *os.File, dataStart uint64, dataEnd uint64, indexes []*Index) *SSTableIterator {
+	it := new(SSTableIterator)
+	it.file = file
+	it.dataStart = dataStart
+	it.dataEnd = dataEnd
+	it.indexes = indexes
+	it.position = len(indexes)
+	return it
+}
+
+// Cita sve indekse od trenutne pozicije do kraja indeksne zone
+func readIndexes(file *os.File, indexEnd uint64) ([]*Index, error) {
+	indexes := make([]*Index, 0)
+	for true {
+		index, err := byteToIndexBefore(file, indexEnd)
+		if err != nil {
+			return nil, err
+		}
+		if index == nil {
+			break
+		}
+		indexes = append(indexes, index)
+	}
+	return indexes, nil
+}
+
+// Ucitava sve verzije kljuca na trenutnoj poziciji
+func (it *SSTableIterator) loadVersions() {
+	it.versions = it.versions[:0]
+	if it.err != nil || it.position < 0 || it.position >= len(it.indexes) {
+		return
+	}
+
+	//Verzije se nalaze izmedju offseta ovog i narednog kljuca
+	start := it.dataStart + it.indexes[it.position].Offset
+	end := it.dataEnd
+	if it.position+1 < len(it.indexes) {
+		end = it.dataStart + it.indexes[it.position+1].Offset
+	}
+
+	_, err := it.file.Seek(int64(start), io.SeekStart)
+	if err != nil {
+		it.err = NewIOError(err)
+		return
+	}
+	for offset := start; offset < end; {
+		_, data, err := ByteToData(it.file)
+		if err != nil {
+			it.err = err
+			return
+		}
+		it.versions = append(it.versions, data)
+		position, err := it.file.Seek(0, io.SeekCurrent)
+		if err != nil {
+			it.err = NewIOError(err)
+			return
+		}
+		offset = uint64(position)
+	}
+}
+
+func (it *SSTableIterator) Seek(key string) {
+	it.position = sort.Search(len(it.indexes), func(i int) bool { return it.indexes[i].Key >= key })
+	it.loadVersions()
+	it.version = 0
+}
+
+func (it *SSTableIterator) SeekToFirst() {
+	it.position = 0
+	it.loadVersions()
+	it.version = 0
+}
+
+func (it *SSTableIterator) SeekToLast() {
+	it.position = len(it.indexes) - 1
+	it.loadVersions()
+	it.version = len(it.versions) - 1
+}
+
+func (it *SSTableIterator) Next() {
+	if !it.Valid() {
+		return
+	}
+	it.version++
+	if it.version >= len(it.versions) {
+		it.position++
+		it.loadVersions()
+		it.version = 0
+	}
+}
+
+func (it *SSTableIterator) Prev() {
+	if !it.Valid() {
+		return
+	}
+	it.version--
+	if it.version < 0 {
+		it.position--
+		it.loadVersions()
+		it.version = len(it.versions) - 1
+	}
+}
+
+func (it *SSTableIterator) Valid() bool {
+	return it.err == nil && it.position >= 0 && it.position < len(it.indexes) &&
+		it.version >= 0 && it.version < len(it.versions)
+}
+
+func (it *SSTableIterator) Key() string {
+	return it.indexes[it.position].Key
+}
+
+func (it *SSTableIterator) Value() *Data {
+	return it.versions[it.version]
+}
+
+func (it *SSTableIterator) Err() error {
+	return it.err
+}
+
+func (it *SSTableIterator) Close() error {
+	return NewIOError(it.file.Close())
+}
@@ -0,0 +1,120 @@
+package sstable
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	. "project/keyvalue/errs"
+	. "project/keyvalue/structures/dataType"
+	merkle "project/keyvalue/structures/merkle"
+)
+
+//Metadata fajl (metadata.txt) sadrzi:
+//1. red -> merkle root svih zapisa sstabele
+//2. red -> entries <broj zapisa> (sve verzije svih kljuceva)
+//3. red -> tombstones <broj zapisa o brisanju>
+//4. red -> max_timestamp <najkasnije vreme upisa medju zapisima>
+//5. red -> range_tombstones <broj brisanja opsega>
+//6. red -> min_seq <najmanji redni broj upisa medju zapisima i brisanjima opsega>
+//Sstabele zapisane pre uvodjenja brojaca imaju samo merkle root, pa su im brojaci 0
+//(min_seq 0 znaci da sstabelu vidi svaki snapshot)
+
+const METADATA_FILE = "metadata.txt"
+
+// Podaci iz metadata fajla
+type Metadata struct {
+	MerkleRoot      string
+	Entries         uint64
+	Tombstones      uint64
+	MaxTimestamp    uint64
+	RangeTombstones uint64
+	MinSeq          uint64
+}
+
+// Udeo tombstone-ova medju zapisima sstabele (brisanje opsega se racuna kao jedan tombstone)
+func (metadata *Metadata) TombstoneRatio() float64 {
+	if metadata.Entries+metadata.RangeTombstones == 0 {
+		return 0
+	}
+	return float64(metadata.Tombstones+metadata.RangeTombstones) / float64(metadata.Entries+metadata.RangeTombstones)
+}
+
+// Zapisuje merkle root, broj zapisa i tombstone-ova, najkasnije vreme upisa i najmanji redni broj upisa u metadata fajl
+// Merkle stablo obuhvata i brisanja opsega
+func writeMetadata(file *os.File, nodes []*merkle.Node, values []*Data, rangeTombstones []*RangeTombstone) error {
+	tombstones := 0
+	maxTimestamp := uint64(0)
+	minSeq := uint64(0)
+	for i, value := range values {
+		if value.Tombstone {
+			tombstones++
+		}
+		if value.Timestamp > maxTimestamp {
+			maxTimestamp = value.Timestamp
+		}
+		if i == 0 || value.Seq < minSeq {
+			minSeq = value.Seq
+		}
+	}
+	for i, tombstone := range rangeTombstones {
+		node := new(merkle.Node)
+		node.Data = dataToByte(tombstone.Start, tombstone.ToData())
+		nodes = append(nodes, node)
+		if tombstone.Timestamp > maxTimestamp {
+			maxTimestamp = tombstone.Timestamp
+		}
+		if (i == 0 && len(values) == 0) || tombstone.Seq < minSeq {
+			minSeq = tombstone.Seq
+		}
+	}
+
+	err := merkle.WriteFile(file, merkle.MakeMerkel(nodes).Root)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(file, "\nentries %d\ntombstones %d\nmax_timestamp %d\nrange_tombstones %d\nmin_seq %d\n",
+		len(values), tombstones, maxTimestamp, len(rangeTombstones), minSeq)
+	return err
+}
+
+// Cita metadata fajl sstabele iz zadatog direktorijuma
+func ReadMetadata(directory string) (*Metadata, error) {
+	path := filepath.Join(directory, METADATA_FILE)
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, NewIOError(err)
+	}
+	defer file.Close()
+
+	metadata := new(Metadata)
+	scanner := bufio.NewScanner(file)
+	if scanner.Scan() {
+		metadata.MerkleRoot = scanner.Text()
+	}
+	for scanner.Scan() {
+		var name string
+		var count uint64
+		_, err := fmt.Sscanf(scanner.Text(), "%s %d", &name, &count)
+		if err != nil {
+			return nil, NewCorruptionError("metadata %s je ostecen", path)
+		}
+		switch name {
+		case "entries":
+			metadata.Entries = count
+		case "tombstones":
+			metadata.Tombstones = count
+		case "max_timestamp":
+			metadata.MaxTimestamp = count
+		case "range_tombstones":
+			metadata.RangeTombstones = count
+		case "min_seq":
+			metadata.MinSeq = count
+		}
+	}
+	err = scanner.Err()
+	if err != nil {
+		return nil, NewIOError(err)
+	}
+	return metadata, nil
+}
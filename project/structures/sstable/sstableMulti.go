@@ -1,19 +1,17 @@
 package sstable
 
 import (
+	"errors"
 	"fmt"
-	"log"
-	"math"
 	"os"
 	"path/filepath"
 	. "project/keyvalue/config"
+	. "project/keyvalue/errs"
 	. "project/keyvalue/structures/bloom"
 	. "project/keyvalue/structures/dataType"
 	. "project/keyvalue/structures/entry"
 	merkle "project/keyvalue/structures/merkle"
-	. "project/keyvalue/structures/scan"
-	"strconv"
-	"strings"
+	. "project/keyvalue/structures/iterator"
 )
 
 type SSTableMulti struct {
@@ -25,107 +23,106 @@ type SSTableMulti struct {
 // ---------------- Konstruktor i inicijalizacija ----------------
 
 // size - ocekivani broj elemenata (velicina memtabele)
-// directory - naziv direktorijuma
-func NewSSTableMulti(size uint32, directory string) *SSTableMulti {
-	config := GetConfig()
+// directory - putanja do direktorijuma sstabele
+// config - konfiguracija baze kojoj sstabela pripada
+func NewSSTableMulti(size uint32, directory string, config *Config) (*SSTableMulti, error) {
 	sstable := new(SSTableMulti)
 	sstable.intervalSize = config.SStableInterval
 	sstable.directory = directory
 
-	_, err := os.Stat("files/sstable/" + sstable.directory)
+	_, err := os.Stat(sstable.directory)
 	if os.IsNotExist(err) {
 		sstable.bloomFilter = NewBloomFilter(size, config.BloomFalsePositiveRate)
 	} else {
-		sstable.LoadFilter()
+		err = sstable.LoadFilter()
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	return sstable
+	return sstable, nil
 }
 
 // Otvara trazenu datoteku od sstabele
-func (sstable *SSTableMulti) OpenFile(filename string) *os.File {
-	path, err2 := filepath.Abs("files/sstable/" + sstable.directory)
-	if err2 != nil {
-		log.Fatal(err2)
+func (sstable *SSTableMulti) OpenFile(filename string) (*os.File, error) {
+	path, err := filepath.Abs(sstable.directory)
+	if err != nil {
+		return nil, NewIOError(err)
 	}
 
 	file, err := os.Open(path + "/" + filename)
 	if err != nil {
-		log.Fatal(err)
+		return nil, NewIOError(err)
 	}
 
-	return file
+	return file, nil
 }
 
 // Ucitava podatke ukoliko vec postoji sstabela
-func (sstable *SSTableMulti) LoadFilter() {
+func (sstable *SSTableMulti) LoadFilter() error {
 	//Ucitavamo bloomfilter
-	filterFile := sstable.OpenFile("filter.bin")
-	sstable.bloomFilter = ByteToBloomFilter(filterFile)
-	err := filterFile.Close()
+	filterFile, err := sstable.OpenFile("filter.bin")
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
+	defer filterFile.Close()
+
+	sstable.bloomFilter, err = ByteToBloomFilter(filterFile)
+	return err
 }
 
-// Vraca pokazivace na kreirane fajlove(summary,index,data, filter, metadata)
-func (sstable *SSTableMulti) MakeFiles() []*os.File {
+// Vraca pokazivace na kreirane fajlove(summary,index,data, filter, metadata, brisanja opsega)
+func (sstable *SSTableMulti) MakeFiles() ([]*os.File, error) {
 	//kreiramo novi direktorijum
-	_, err := os.Stat("files/sstable/" + sstable.directory)
+	_, err := os.Stat(sstable.directory)
 	if os.IsNotExist(err) {
-		err = os.MkdirAll("files/sstable/"+sstable.directory, os.ModePerm)
+		err = os.MkdirAll(sstable.directory, os.ModePerm)
 		if err != nil {
-			log.Fatal(err)
+			return nil, NewIOError(err)
 		}
 	} else {
 		fmt.Println("Fajl vec postoji!")
 	}
 
 	//Kreiramo fajlove unutar direktorijuma
-	path, err2 := filepath.Abs("files/sstable/" + sstable.directory)
-	if err2 != nil {
-		log.Fatal(err2)
-	}
-
-	summary, err3 := os.Create(path + "/summary.bin")
-	if err3 != nil {
-		log.Fatal(err3)
-	}
-
-	index, err4 := os.Create(path + "/index.bin")
-	if err4 != nil {
-		log.Fatal(err4)
-	}
-
-	data, err5 := os.Create(path + "/data.bin")
-	if err5 != nil {
-		log.Fatal(err5)
-	}
-
-	filter, err6 := os.Create(path + "/filter.bin")
-	if err6 != nil {
-		log.Fatal(err6)
-	}
-
-	metadata, err7 := os.Create(path + "/metadata.txt")
-	if err7 != nil {
-		log.Fatal(err7)
+	path, err := filepath.Abs(sstable.directory)
+	if err != nil {
+		return nil, NewIOError(err)
 	}
 
 	files := make([]*os.File, 0)
-	files = append(files, data, index, summary, filter, metadata)
-	return files
+	for _, name := range []string{"data.bin", "index.bin", "summary.bin", "filter.bin", METADATA_FILE, RANGE_TOMBSTONES_FILE} {
+		file, err := os.Create(path + "/" + name)
+		if err != nil {
+			//Zatvaramo vec otvorene fajlove
+			for _, opened := range files {
+				opened.Close()
+			}
+			return nil, NewIOError(err)
+		}
+		files = append(files, file)
+	}
+	return files, nil
 }
 
 // Iterira se kroz string kljuceve i ubacuje u:
 // Bloomfilter
 // zapisuje u data, index tabelu, summary
-func (sstable *SSTableMulti) Flush(keys []string, values []*Data) {
-	files := sstable.MakeFiles()
-	dataFile, indexFile, summaryFile, filterFile, metadataFile := files[0], files[1], files[2], files[3], files[4]
+// Brisanja opsega se zapisuju u poseban fajl
+func (sstable *SSTableMulti) Flush(keys []string, values []*Data, tombstones []*RangeTombstone) error {
+	files, err := sstable.MakeFiles()
+	if err != nil {
+		return err
+	}
+	dataFile, indexFile, summaryFile, filterFile, metadataFile, rangeFile := files[0], files[1], files[2], files[3], files[4], files[5]
+	defer func() {
+		for _, file := range files {
+			file.Close()
+		}
+	}()
+
 	summary := new(Summary)
-	summary.FirstKey = keys[0]
-	summary.LastKey = keys[len(keys)-1]
+	summary.FirstKey, summary.LastKey = keyRange(keys, tombstones)
 	summary.Intervals = make([]*Index, 0)
 
 	offsetIndex := uint64(0) //Offset ka indeksu(koristi se u summary)
@@ -137,27 +134,33 @@ func (sstable *SSTableMulti) Flush(keys []string, values []*Data) {
 	for i := 0; i < len(keys); i++ {
 		index := new(Index) //Pomocna struktura (menja se u svakoj iteraciji)
 
-		//Dodajemo u bloomFilter
-		sstable.bloomFilter.AddToBloom([]byte(keys[i]))
-
 		//Dodajemo u merkle
 		node := new(merkle.Node)
 		node.Data = dataToByte(keys[i], values[i])
 		nodes = append(nodes, node)
 
 		//Upisujemo trenutni podatak u data tabelu
-		dataLen, err1 := dataFile.Write(dataToByte(keys[i], values[i]))
-		if err1 != nil {
-			log.Fatal(err1)
+		dataLen, err := dataFile.Write(dataToByte(keys[i], values[i]))
+		if err != nil {
+			return NewIOError(err)
+		}
+
+		//Starije verzije istog kljuca nemaju svoj indeks, do njih se dolazi citanjem iza najnovije
+		if i > 0 && keys[i] == keys[i-1] {
+			offsetData += uint64(dataLen)
+			continue
 		}
 
+		//Dodajemo u bloomFilter
+		sstable.bloomFilter.AddToBloom([]byte(keys[i]))
+
 		//upisujemo trenutni podatak u indeks tabelu
 		index.Key = keys[i]
 		index.KeySize = uint32(len([]byte(index.Key)))
 		index.Offset = offsetData
 		indexLen, err := indexFile.Write(indexToByte(index))
 		if err != nil {
-			log.Fatal(err)
+			return NewIOError(err)
 		}
 
 		if intervalCounter == sstable.intervalSize {
@@ -175,128 +178,147 @@ func (sstable *SSTableMulti) Flush(keys []string, values []*Data) {
 	}
 
 	//Upis summary u summaryFile
-	_, err2 := summaryFile.Write(summaryToByte(summary))
-	if err2 != nil {
-		log.Fatal(err2)
+	_, err = summaryFile.Write(summaryToByte(summary))
+	if err != nil {
+		return NewIOError(err)
 	}
 
 	//Upis u bloomfilter fajl
-	_, err := filterFile.Write(BloomFilterToByte(sstable.bloomFilter))
+	_, err = filterFile.Write(BloomFilterToByte(sstable.bloomFilter))
 	if err != nil {
-		log.Fatal(err)
+		return NewIOError(err)
 	}
 
-	//Upis u metadata fajl
-	merkleRoot := merkle.MakeMerkel(nodes)
-	merkle.WriteFile(metadataFile, merkleRoot.Root)
-
-	//Zatvaranje fajlova
-	err = summaryFile.Close()
-	if err != nil {
-		log.Fatal(err)
-	}
-	err = indexFile.Close()
+	//Upis brisanja opsega
+	_, err = rangeFile.Write(rangeTombstonesToByte(tombstones))
 	if err != nil {
-		log.Fatal(err)
+		return NewIOError(err)
 	}
-	err = dataFile.Close()
-	if err != nil {
-		log.Fatal(err)
-	}
-	err = filterFile.Close()
+
+	//Upis u metadata fajl
+	err = writeMetadata(metadataFile, nodes, values, tombstones)
 	if err != nil {
-		log.Fatal(err)
+		return NewIOError(err)
 	}
-	err = metadataFile.Close()
-	if err != nil {
-		log.Fatal(err)
+
+	//Zatvaranje fajlova
+	for _, file := range files {
+		err = file.Close()
+		if err != nil {
+			return NewIOError(err)
+		}
 	}
+	return nil
 }
 
 // ------------ PRINTOVANJE ------------
 
-func (sstable *SSTableMulti) ReadData() {
-	file := sstable.OpenFile("data.bin")
+func (sstable *SSTableMulti) ReadData() error {
+	file, err := sstable.OpenFile("data.bin")
+	if err != nil {
+		return err
+	}
+	defer file.Close()
 
 	for {
-		entry := ReadEntry(file)
+		entry, err := ReadEntry(file)
+		if err != nil {
+			return err
+		}
 		if entry == nil {
 			break
 		}
 		entry.Print()
 	}
-	err := file.Close()
-	if err != nil {
-		log.Fatal(err)
-	}
+	return nil
 }
 
-func (sstable *SSTableMulti) ReadIndex() {
-	file := sstable.OpenFile("index.bin")
+func (sstable *SSTableMulti) ReadIndex() error {
+	file, err := sstable.OpenFile("index.bin")
+	if err != nil {
+		return err
+	}
+	defer file.Close()
 
 	for {
-		index := byteToIndex(file)
+		index, err := byteToIndex(file)
+		if err != nil {
+			return err
+		}
 		if index == nil {
 			break
 		}
 		fmt.Println(index)
 	}
-	err := file.Close()
-	if err != nil {
-		log.Fatal(err)
-	}
+	return nil
 }
 
-func (sstable *SSTableMulti) ReadSummary() *Summary {
-	file := sstable.OpenFile("summary.bin")
-
-	summary := byteToSummary(file)
-
-	err := file.Close()
+func (sstable *SSTableMulti) ReadSummary() (*Summary, error) {
+	file, err := sstable.OpenFile("summary.bin")
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
+	defer file.Close()
 
-	return summary
+	return byteToSummary(file)
 }
 
-func (sstable *SSTableMulti) ReadBloom() {
-	file := sstable.OpenFile("filter.bin")
+func (sstable *SSTableMulti) ReadBloom() error {
+	file, err := sstable.OpenFile("filter.bin")
+	if err != nil {
+		return err
+	}
+	defer file.Close()
 
-	blm := ByteToBloomFilter(file)
+	blm, err := ByteToBloomFilter(file)
+	if err != nil {
+		return err
+	}
 	fmt.Println("K: ", blm.K)
 	fmt.Println("N: ", blm.N)
 	fmt.Println("M: ", blm.M)
 	fmt.Println("Bitset: ", blm.Bitset)
 	fmt.Println("hashfuncs: ", blm.HashFuncs)
-	err := file.Close()
+	return nil
+}
+
+// Cita brisanja opsega iz posebnog fajla
+// Sstabele zapisane pre uvodjenja brisanja opsega nemaju taj fajl
+func (sstable *SSTableMulti) RangeTombstones() ([]*RangeTombstone, error) {
+	file, err := sstable.OpenFile(RANGE_TOMBSTONES_FILE)
+	if errors.Is(err, os.ErrNotExist) {
+		return make([]*RangeTombstone, 0), nil
+	}
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
+	defer file.Close()
 
+	return readRangeTombstones(file)
 }
 
 // ------------ PRETRAZIVANJE ------------
 
-func (sstable *SSTableMulti) Find(Key string) (bool, *Data) {
+func (sstable *SSTableMulti) Find(Key string, seq uint64) (bool, *Data, error) {
 	//Ucitavamo bloomfilter
-	filterFile := sstable.OpenFile("filter.bin")
-	sstable.bloomFilter = ByteToBloomFilter(filterFile)
-	err := filterFile.Close()
+	err := sstable.LoadFilter()
 	if err != nil {
-		log.Fatal(err)
+		return false, nil, err
 	}
 
 	//Proveravamo preko BloomFiltera da li uopste treba da pretrazujemo
 	if !sstable.bloomFilter.IsInBloom([]byte(Key)) {
-		return false, nil
+		return false, nil, nil
 	}
 
 	//Proveravamo da li je kljuc van opsega
-	summary := sstable.ReadSummary()
+	summary, err := sstable.ReadSummary()
+	if err != nil {
+		return false, nil, err
+	}
 
-	if Key < summary.FirstKey || Key > summary.LastKey {
-		return false, nil
+	if Key < summary.FirstKey || Key > summary.LastKey || len(summary.Intervals) == 0 {
+		return false, nil, nil
 	}
 
 	indexInSummary := new(Index)
@@ -313,259 +335,107 @@ func (sstable *SSTableMulti) Find(Key string) (bool, *Data) {
 	}
 
 	// ------ Otvaramo index tabelu ------
-	indexFile := sstable.OpenFile("index.bin")
+	indexFile, err := sstable.OpenFile("index.bin")
+	if err != nil {
+		return false, nil, err
+	}
+	defer indexFile.Close()
 
 	found = false
 	_, err = indexFile.Seek(int64(indexInSummary.Offset), 0) //Pomeramo pokazivac na pocetak trazenog indeksnog dela
 	if err != nil {
-		log.Fatal(err)
+		return false, nil, NewIOError(err)
 	}
 	currentIndex := new(Index)
 
 	//trazimo redom
 	for i := 0; i < int(sstable.intervalSize); i++ {
-		currentIndex = byteToIndex(indexFile)
+		currentIndex, err = byteToIndex(indexFile)
+		if err != nil {
+			return false, nil, err
+		}
+		if currentIndex == nil {
+			break
+		}
 		if currentIndex.Key == Key {
 			found = true
 			break
 		}
 	}
-	err = indexFile.Close() //zatvaramo indeksnu tabelu
-	if err != nil {
-		log.Fatal(err)
-	}
 
 	if !found {
-		return false, nil
+		return false, nil, nil
 	}
 
 	// ------ Pristupamo disku i uzimamo podtak ------
-	dataFile := sstable.OpenFile("data.bin")
-	_, foundData := ByteToData(dataFile, currentIndex.Offset)
-	err = dataFile.Close()
+	dataFile, dataEnd, err := sstable.GoToData()
+	if err != nil {
+		return false, nil, err
+	}
+	defer dataFile.Close()
+
+	_, foundData, err := readVisible(dataFile, currentIndex.Offset, dataEnd, seq)
 	if err != nil {
-		log.Fatal(err)
+		return false, nil, err
 	}
 
-	return true, foundData
+	return foundData != nil, foundData, nil
 }
 
 // ------------ DOBAVLJANJE PODATAKA ------------
 
 // Otvara fajl i postavlja pokazivac na pocetak data zone
 // vraca pokazivac na taj fajl i velicinu data zone
-func (sstable *SSTableMulti) GoToData() (*os.File, uint64) {
-	file := sstable.OpenFile("data.bin")
+func (sstable *SSTableMulti) GoToData() (*os.File, uint64, error) {
+	file, err := sstable.OpenFile("data.bin")
+	if err != nil {
+		return nil, 0, err
+	}
 	fileInfo, err := file.Stat()
 	if err != nil {
-		log.Fatal(err)
+		file.Close()
+		return nil, 0, NewIOError(err)
 	}
-	return file, uint64(fileInfo.Size())
+	return file, uint64(fileInfo.Size()), nil
 }
 
-// ------------- RANGE SCAN -------------
-// Prolazi kroz sstabelu i trazi kljuceve koji zadovoljavaju trazeni interval
-func (sstable *SSTableMulti) RangeScan(minKey string, maxKey string, scan *Scan) {
-
-	//Proveravamo da li je kljuc van opsega
-	summary := sstable.ReadSummary()
-
-	if maxKey < summary.FirstKey || minKey > summary.LastKey {
-		return //Preskacemo ovu sstabelu jer kljucevi nisu u opsegu
-	}
-
-	chosenIntervals := make([]*Index, 0)
-	for i := 1; i < len(summary.Intervals); i++ {
-		if summary.Intervals[i].Key < minKey {
-			continue
-		}
-		if maxKey < summary.Intervals[i-1].Key {
-			break
-		}
-		chosenIntervals = append(chosenIntervals, summary.Intervals[i-1])
-	}
-
-	if len(chosenIntervals) < 1 {
-		return
-	}
+// ------------- ITERATOR -------------
+// Otvara iterator kroz sve zapise sstabele
+// Data fajl ostaje otvoren dok se iterator ne zatvori
+func (sstable *SSTableMulti) NewIterator() (Iterator, error) {
 
-	// ------ Otvaramo index tabelu ------
-	indexFile := sstable.OpenFile("index.bin")
-	currentIndex := new(Index)
-
-	dataFile := sstable.OpenFile("data.bin") //Otvaramo data fajl za proveru
-
-	//Prolazimo kroz sve nadjene indeksne delove
-	for i := 0; i < len(chosenIntervals); i++ {
-		if scan.FoundResults > scan.SelectedPageEnd {
-			break
-		}
-
-		_, err := indexFile.Seek(int64(chosenIntervals[i].Offset), 0) //Pomeramo pokazivac na pocetak trazenog indeksnog dela
-		if err != nil {
-			log.Fatal(err)
-		}
-
-		//trazimo redom
-		for i := 0; i < int(sstable.intervalSize); i++ {
-			currentIndex = byteToIndex(indexFile)
-			if currentIndex.Key >= minKey && currentIndex.Key <= maxKey {
-
-				// -------- pristupamo disku i proveravamo podatak --------
-				foundKey, foundData := ByteToData(dataFile, currentIndex.Offset)
-				if !foundData.Tombstone {
-					//Proveravamo da li je obelezen kao obrisan ili je vec dodat
-					if !scan.RemovedKeys[foundKey] && !scan.SelectedKeys[foundKey] {
-						scan.SelectedKeys[foundKey] = true //Obelezimo da je dodat
-
-						scan.FoundResults++
-						//Ukoliko je u opsegu nase stranice pamtimo u Scan
-						if scan.FoundResults >= scan.SelectedPageStart && scan.FoundResults <= scan.SelectedPageEnd {
-							scan.Keys = append(scan.Keys, foundKey)
-							scan.Data = append(scan.Data, foundData)
-						} else if scan.FoundResults > scan.SelectedPageEnd {
-							break
-						}
-					}
-				} else {
-					//Posto je obrisan oznacicemo ga kao obrisanog da se ne uzima u obzir dalje
-					scan.RemovedKeys[foundKey] = true
-				}
-			} else if currentIndex.Key > maxKey {
-				break
-			}
-		}
-	}
-
-	err := indexFile.Close() //zatvaramo indeksnu tabelu
+	//Ucitavamo ceo indeks
+	indexFile, err := sstable.OpenFile("index.bin")
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
-
-	err = dataFile.Close() //Zatvaramo data zonu
+	defer indexFile.Close()
+	fileInfo, err := indexFile.Stat()
 	if err != nil {
-		log.Fatal(err)
+		return nil, NewIOError(err)
 	}
-
-}
-
-// ------------- LIST SCAN -------------
-// Prolazi kroz sstabelu i trazi kljuceve koji pocinju zadatim prefiksom
-func (sstable *SSTableMulti) ListScan(prefix string, scan *Scan) {
-
-	//Proveravamo da li je kljuc van opsega
-	summary := sstable.ReadSummary()
-
-	//najmanje duzine stringova
-	//Trazimo koji string je manji i onda proveravamo toliko cifara, da ne bi izasli iz index range-a
-	minimumLenFirst := int(math.Min(float64(len(prefix)), float64(len(summary.FirstKey))))
-	minimumLenLast := int(math.Min(float64(len(prefix)), float64(len(summary.LastKey))))
-
-	if prefix[:minimumLenFirst] < summary.FirstKey[:minimumLenFirst] || prefix[:minimumLenLast] > summary.LastKey[:minimumLenLast] {
-		return //Preskacemo ovu sstabelu jer kljucevi nisu u opsegu
-	}
-
-	//Biramo koji indeksni intervali nam trebaju
-	chosenIntervals := make([]*Index, 0)
-	for i := 1; i < len(summary.Intervals); i++ {
-		//Trazimo koji string je manji i onda proveravamo toliko cifara, da ne bi izasli iz index range-a
-		//za trenutan interval
-		minimumLen := int(math.Min(float64(len(prefix)), float64(len(summary.Intervals[i].Key))))
-		if summary.Intervals[i].Key[:minimumLen] < prefix[:minimumLen] {
-			continue
-		}
-		//za prethodni interval
-		minimumLen = int(math.Min(float64(len(prefix)), float64(len(summary.Intervals[i-1].Key))))
-		if prefix[:minimumLen] < summary.Intervals[i-1].Key[:minimumLen] {
-			break
-		}
-		chosenIntervals = append(chosenIntervals, summary.Intervals[i-1])
-	}
-
-	if len(chosenIntervals) < 1 {
-		return
-	}
-
-	// ------ Otvaramo index tabelu ------
-	indexFile := sstable.OpenFile("index.bin")
-	currentIndex := new(Index)
-
-	dataFile := sstable.OpenFile("data.bin") //Otvaramo data fajl za proveru
-
-	//Prolazimo kroz sve nadjene indeksne delove
-	for i := 0; i < len(chosenIntervals); i++ {
-		if scan.FoundResults > scan.SelectedPageEnd {
-			break
-		}
-
-		_, err := indexFile.Seek(int64(chosenIntervals[i].Offset), 0) //Pomeramo pokazivac na pocetak trazenog indeksnog dela
-		if err != nil {
-			log.Fatal(err)
-		}
-
-		//trazimo redom
-		for i := 0; i < int(sstable.intervalSize); i++ {
-			currentIndex = byteToIndex(indexFile)
-			if strings.HasPrefix(currentIndex.Key, prefix) {
-				// -------- pristupamo disku i proveravamo podatak --------
-				foundKey, foundData := ByteToData(dataFile, currentIndex.Offset)
-				if !foundData.Tombstone {
-					//Proveravamo da li je obelezen kao obrisan ili je vec dodat
-					if !scan.RemovedKeys[foundKey] && !scan.SelectedKeys[foundKey] {
-						scan.SelectedKeys[foundKey] = true //Obelezimo da je dodat
-
-						scan.FoundResults++
-						//Ukoliko je u opsegu nase stranice pamtimo u Scan
-						if scan.FoundResults >= scan.SelectedPageStart && scan.FoundResults <= scan.SelectedPageEnd {
-							scan.Keys = append(scan.Keys, foundKey)
-							scan.Data = append(scan.Data, foundData)
-						} else if scan.FoundResults > scan.SelectedPageEnd {
-							break
-						}
-					}
-				} else {
-					//Posto je obrisan oznacicemo ga kao obrisanog da se ne uzima u obzir dalje
-					scan.RemovedKeys[foundKey] = true
-				}
-			} else if currentIndex.Key > prefix {
-				break
-			}
-		}
-	}
-
-	err := indexFile.Close() //zatvaramo indeksnu tabelu
+	indexes, err := readIndexes(indexFile, uint64(fileInfo.Size()))
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
-	err = dataFile.Close() //Zatvaramo data zonu
+	dataFile, dataEnd, err := sstable.GoToData()
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
-
+	return newSSTableIterator(dataFile, 0, dataEnd, indexes), nil
 }
 
 // Vraca koji je nivo i koja je po redu sstabela u LSM stablu
-func (sstable *SSTableMulti) GetPosition() (uint32, uint32) {
-	arr := strings.Split(sstable.directory, "/")
-	levelString := strings.TrimLeft(arr[0], "level")
-	fileString := strings.TrimLeft(arr[1], "sstable")
-
-	levelNum, err := strconv.Atoi(levelString)
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	fileNum, err := strconv.Atoi(fileString)
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	return uint32(levelNum), uint32(fileNum)
+func (sstable *SSTableMulti) GetPosition() (uint32, uint32, error) {
+	return parsePosition(sstable.directory)
 }
 
 //Vraca opseg iz summaryja
-func (sstable *SSTableMulti) GetRange() (string, string) {
-	summary := sstable.ReadSummary()
-	return summary.FirstKey, summary.LastKey
+func (sstable *SSTableMulti) GetRange() (string, string, error) {
+	summary, err := sstable.ReadSummary()
+	if err != nil {
+		return "", "", err
+	}
+	return summary.FirstKey, summary.LastKey, nil
 }
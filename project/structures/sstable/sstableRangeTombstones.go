@@ -0,0 +1,66 @@
+package sstable
+
+import (
+	"os"
+	. "project/keyvalue/errs"
+	. "project/keyvalue/structures/dataType"
+	. "project/keyvalue/structures/entry"
+)
+
+//Blok sa brisanjima opsega (range tombstone) sstabele
+//Brisanja opsega iz memtabele ili kompakcije od koje je sstabela nastala se zapisuju jedno za drugim
+//u istom formatu kao zapisi data zone (kljuc je pocetak, a vrednost kraj opsega):
+//single -> na kraju sstable.bin, iza bloom filtera
+//multi  -> u posebnom fajlu range_tombstones.bin
+//Sstabele zapisane pre uvodjenja brisanja opsega nemaju blok, pa nemaju ni brisanja opsega
+//Opseg kljuceva u summary-ju obuhvata i brisanja opsega, pa ih kompakcije uzimaju u obzir pri proveri preklapanja
+
+const RANGE_TOMBSTONES_FILE = "range_tombstones.bin"
+
+// Pakuje brisanja opsega u niz bajtova za upis
+func rangeTombstonesToByte(tombstones []*RangeTombstone) []byte {
+	bytes := make([]byte, 0)
+	for _, tombstone := range tombstones {
+		bytes = append(bytes, dataToByte(tombstone.Start, tombstone.ToData())...)
+	}
+	return bytes
+}
+
+// Cita brisanja opsega od trenutne pozicije do kraja fajla
+func readRangeTombstones(file *os.File) ([]*RangeTombstone, error) {
+	tombstones := make([]*RangeTombstone, 0)
+	for true {
+		entry, err := ReadEntry(file)
+		if err != nil {
+			return nil, err
+		}
+		if entry == nil {
+			break
+		}
+		key, data := entry.ToData()
+		if !data.RangeDelete {
+			return nil, NewCorruptionError("sstabela %s ima neispravno brisanje opsega", file.Name())
+		}
+		tombstones = append(tombstones, NewRangeTombstone(key, data))
+	}
+	return tombstones, nil
+}
+
+// Vraca najmanji i najveci kljuc sstabele, ukljucujuci pocetke i krajeve brisanja opsega
+func keyRange(keys []string, tombstones []*RangeTombstone) (string, string) {
+	first, last := "", ""
+	found := len(keys) > 0
+	if found {
+		first, last = keys[0], keys[len(keys)-1]
+	}
+	for _, tombstone := range tombstones {
+		if !found || tombstone.Start < first {
+			first = tombstone.Start
+		}
+		if !found || tombstone.End > last {
+			last = tombstone.End
+		}
+		found = true
+	}
+	return first, last
+}
@@ -3,18 +3,16 @@ package sstable
 import (
 	"encoding/binary"
 	"fmt"
-	"log"
-	"math"
+	"io"
 	"os"
 	"path/filepath"
 	. "project/keyvalue/config"
+	. "project/keyvalue/errs"
 	. "project/keyvalue/structures/bloom"
 	. "project/keyvalue/structures/dataType"
 	. "project/keyvalue/structures/entry"
 	merkle "project/keyvalue/structures/merkle"
-	. "project/keyvalue/structures/scan"
-	"strconv"
-	"strings"
+	. "project/keyvalue/structures/iterator"
 )
 
 type SSTableSingle struct {
@@ -24,63 +22,50 @@ type SSTableSingle struct {
 }
 
 // Otvara trazenu datoteku od sstabele
-func (sstable *SSTableSingle) OpenFile(filename string) *os.File {
-	path, err2 := filepath.Abs("files/sstable/" + sstable.directory)
-	if err2 != nil {
-		log.Fatal(err2)
+func (sstable *SSTableSingle) OpenFile(filename string) (*os.File, error) {
+	path, err := filepath.Abs(sstable.directory)
+	if err != nil {
+		return nil, NewIOError(err)
 	}
 
 	file, err := os.Open(path + "/" + filename)
 	if err != nil {
-		log.Fatal(err)
+		return nil, NewIOError(err)
 	}
 
-	return file
+	return file, nil
 }
 
-func NewSSTableSingle(size uint32, directory string) *SSTableSingle {
-	config := GetConfig()
+func NewSSTableSingle(size uint32, directory string, config *Config) (*SSTableSingle, error) {
 	sstable := new(SSTableSingle)
 	sstable.intervalSize = config.SStableInterval
 	sstable.directory = directory
 
-	_, err := os.Stat("files/sstable/" + sstable.directory)
+	_, err := os.Stat(sstable.directory)
 	if os.IsNotExist(err) {
 		sstable.bloomFilter = NewBloomFilter(size, config.BloomFalsePositiveRate)
 	} else {
-		sstable.LoadFilter() //Treba popraviti i videti da li je potrebno uopste
+		err = sstable.LoadFilter() //Treba popraviti i videti da li je potrebno uopste
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	return sstable
+	return sstable, nil
 }
 
-func (sstable *SSTableSingle) LoadFilter() {
+func (sstable *SSTableSingle) LoadFilter() error {
 	//Otvaramo fajl i citamo header
-	sstableFile := sstable.OpenFile("sstable.bin")
-
-	//Citamo velicinu data zone
-	bytes := make([]byte, 8)
-	_, err := sstableFile.Read(bytes)
+	sstableFile, err := sstable.OpenFile("sstable.bin")
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
-	dataSize := binary.BigEndian.Uint64(bytes)
+	defer sstableFile.Close()
 
-	//Citamo velicinu indeksne zone
-	bytes = make([]byte, 8)
-	_, err = sstableFile.Read(bytes)
+	dataSize, indexSize, summarySize, err := sstable.ReadHeader(sstableFile)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
-	indexSize := binary.BigEndian.Uint64(bytes)
-
-	//Citamo velicinu summary zone
-	bytes = make([]byte, 8)
-	_, err = sstableFile.Read(bytes)
-	if err != nil {
-		log.Fatal(err)
-	}
-	summarySize := binary.BigEndian.Uint64(bytes)
 
 	//Offseti na pocetke zona
 	dataStart := uint64(24)
@@ -91,59 +76,62 @@ func (sstable *SSTableSingle) LoadFilter() {
 	//Ucitavamo bloomfilter
 	_, err = sstableFile.Seek(int64(filterStart), 0)
 	if err != nil {
-		log.Fatal(err)
-	}
-	sstable.bloomFilter = ByteToBloomFilter(sstableFile)
-
-	err = sstableFile.Close()
-	if err != nil {
-		log.Fatal(err)
+		return NewIOError(err)
 	}
+	sstable.bloomFilter, err = ByteToBloomFilter(sstableFile)
+	return err
 }
 
 // Vraca pokazivace na kreirane fajlove(summary,index,data, filter, metadata)
-func (sstable *SSTableSingle) MakeFiles() []*os.File {
+func (sstable *SSTableSingle) MakeFiles() ([]*os.File, error) {
 	//kreiramo novi direktorijum
-	_, err := os.Stat("files/sstable/" + sstable.directory)
+	_, err := os.Stat(sstable.directory)
 	if os.IsNotExist(err) {
-		err = os.MkdirAll("files/sstable/"+sstable.directory, os.ModePerm)
+		err = os.MkdirAll(sstable.directory, os.ModePerm)
 		if err != nil {
-			log.Fatal(err)
+			return nil, NewIOError(err)
 		}
 	} else {
 		fmt.Println("Fajl vec postoji!")
 	}
 
 	//Kreiramo fajlove unutar direktorijuma
-	path, err2 := filepath.Abs("files/sstable/" + sstable.directory)
-	if err2 != nil {
-		log.Fatal(err2)
+	path, err := filepath.Abs(sstable.directory)
+	if err != nil {
+		return nil, NewIOError(err)
 	}
 
-	sstableFile, err3 := os.Create(path + "/sstable.bin")
-	if err3 != nil {
-		log.Fatal(err3)
+	sstableFile, err := os.Create(path + "/sstable.bin")
+	if err != nil {
+		return nil, NewIOError(err)
 	}
 
-	metadata, err7 := os.Create(path + "/metadata.txt")
-	if err7 != nil {
-		log.Fatal(err7)
+	metadata, err := os.Create(path + "/" + METADATA_FILE)
+	if err != nil {
+		sstableFile.Close()
+		return nil, NewIOError(err)
 	}
 
 	files := make([]*os.File, 0)
 	files = append(files, sstableFile, metadata)
-	return files
+	return files, nil
 }
 
 // Iterira se kroz string kljuceve i ubacuje u:
 // Bloomfilter
 // zapisuje u data, index tabelu, summary
-func (sstable *SSTableSingle) Flush(keys []string, values []*Data) {
-	files := sstable.MakeFiles()
+// Brisanja opsega se zapisuju iza bloomfiltera
+func (sstable *SSTableSingle) Flush(keys []string, values []*Data, tombstones []*RangeTombstone) error {
+	files, err := sstable.MakeFiles()
+	if err != nil {
+		return err
+	}
 	sstableFile, metadataFile := files[0], files[1]
+	defer sstableFile.Close()
+	defer metadataFile.Close()
+
 	summary := new(Summary)
-	summary.FirstKey = keys[0]
-	summary.LastKey = keys[len(keys)-1]
+	summary.FirstKey, summary.LastKey = keyRange(keys, tombstones)
 	summary.Intervals = make([]*Index, 0)
 
 	offsetIndex := uint64(0) //Relativan offset ka indeksu(koristi se u summary)
@@ -161,9 +149,6 @@ func (sstable *SSTableSingle) Flush(keys []string, values []*Data) {
 	for i := 0; i < len(keys); i++ {
 		index := new(Index) //Pomocna struktura (menja se u svakoj iteraciji)
 
-		//Dodajemo u bloomFilter
-		sstable.bloomFilter.AddToBloom([]byte(keys[i]))
-
 		//Dodajemo u merkle
 		node := new(merkle.Node)
 		node.Data = dataToByte(keys[i], values[i])
@@ -174,6 +159,15 @@ func (sstable *SSTableSingle) Flush(keys []string, values []*Data) {
 		dataBytes = append(dataBytes, tempData...)
 		dataLen := len(tempData)
 
+		//Starije verzije istog kljuca nemaju svoj indeks, do njih se dolazi citanjem iza najnovije
+		if i > 0 && keys[i] == keys[i-1] {
+			offsetData += uint64(dataLen)
+			continue
+		}
+
+		//Dodajemo u bloomFilter
+		sstable.bloomFilter.AddToBloom([]byte(keys[i]))
+
 		//upisujemo trenutni podatak u indeks tabelu
 		index.Key = keys[i]
 		index.KeySize = uint32(len([]byte(index.Key)))
@@ -216,56 +210,68 @@ func (sstable *SSTableSingle) Flush(keys []string, values []*Data) {
 	bytes = append(bytes, bytesTemp...)
 
 	//Upisujemo header u fajl
-	_, err := sstableFile.Write(bytes)
+	_, err = sstableFile.Write(bytes)
 	if err != nil {
-		log.Fatal(err)
+		return NewIOError(err)
 	}
 
 	//------------ DATA ------------
 	_, err = sstableFile.Write(dataBytes)
 	if err != nil {
-		log.Fatal(err)
+		return NewIOError(err)
 	}
 
 	//------------ INDEX ------------
 	_, err = sstableFile.Write(indexBytes)
 	if err != nil {
-		log.Fatal(err)
+		return NewIOError(err)
 	}
 
 	//------------ SUMMARY ------------
 	_, err = sstableFile.Write(summaryBytes)
 	if err != nil {
-		log.Fatal(err)
+		return NewIOError(err)
 	}
 
 	//------------ FILTER ------------
 	_, err = sstableFile.Write(BloomFilterToByte(sstable.bloomFilter))
 	if err != nil {
-		log.Fatal(err)
+		return NewIOError(err)
+	}
+
+	//------------ BRISANJA OPSEGA ------------
+	_, err = sstableFile.Write(rangeTombstonesToByte(tombstones))
+	if err != nil {
+		return NewIOError(err)
 	}
 
 	//Upis u metadata fajl
-	merkleRoot := merkle.MakeMerkel(nodes)
-	merkle.WriteFile(metadataFile, merkleRoot.Root)
+	err = writeMetadata(metadataFile, nodes, values, tombstones)
+	if err != nil {
+		return NewIOError(err)
+	}
 
 	//Zatvaranje fajlova
 	err = sstableFile.Close()
 	if err != nil {
-		log.Fatal(err)
-	}
-	err = metadataFile.Close()
-	if err != nil {
-		log.Fatal(err)
+		return NewIOError(err)
 	}
+	return NewIOError(metadataFile.Close())
 }
 
-func (sstable *SSTableSingle) Find(Key string) (bool, *Data) {
+func (sstable *SSTableSingle) Find(Key string, seq uint64) (bool, *Data, error) {
 
 	//Otvaramo fajl i citamo header
-	sstableFile := sstable.OpenFile("sstable.bin")
+	sstableFile, err := sstable.OpenFile("sstable.bin")
+	if err != nil {
+		return false, nil, err
+	}
+	defer sstableFile.Close()
 
-	dataSize, indexSize, summarySize := sstable.ReadHeader(sstableFile)
+	dataSize, indexSize, summarySize, err := sstable.ReadHeader(sstableFile)
+	if err != nil {
+		return false, nil, err
+	}
 
 	//Offseti na pocetke zona
 	dataStart := uint64(24)
@@ -274,34 +280,32 @@ func (sstable *SSTableSingle) Find(Key string) (bool, *Data) {
 	filterStart := summaryStart + summarySize
 
 	//Ucitavamo bloomfilter
-	_, err := sstableFile.Seek(int64(filterStart), 0)
+	_, err = sstableFile.Seek(int64(filterStart), 0)
+	if err != nil {
+		return false, nil, NewIOError(err)
+	}
+	sstable.bloomFilter, err = ByteToBloomFilter(sstableFile)
 	if err != nil {
-		log.Fatal(err)
+		return false, nil, err
 	}
-	sstable.bloomFilter = ByteToBloomFilter(sstableFile)
 
 	//Proveravamo preko BloomFiltera da li uopste treba da pretrazujemo
 	if !sstable.bloomFilter.IsInBloom([]byte(Key)) {
-		err := sstableFile.Close()
-		if err != nil {
-			log.Fatal(err)
-		}
-		return false, nil
+		return false, nil, nil
 	}
 
 	//Proveravamo da li je kljuc van opsega
 	_, err = sstableFile.Seek(int64(summaryStart), 0)
 	if err != nil {
-		log.Fatal(err)
+		return false, nil, NewIOError(err)
+	}
+	summary, err := byteToSummary(sstableFile)
+	if err != nil {
+		return false, nil, err
 	}
-	summary := byteToSummary(sstableFile)
 
-	if Key < summary.FirstKey || Key > summary.LastKey {
-		err = sstableFile.Close()
-		if err != nil {
-			log.Fatal(err)
-		}
-		return false, nil
+	if Key < summary.FirstKey || Key > summary.LastKey || len(summary.Intervals) == 0 {
+		return false, nil, nil
 	}
 
 	indexInSummary := new(Index)
@@ -321,13 +325,19 @@ func (sstable *SSTableSingle) Find(Key string) (bool, *Data) {
 	found = false
 	_, err = sstableFile.Seek(int64(indexInSummary.Offset+indexStart), 0) //Pomeramo pokazivac na pocetak trazenog indeksnog dela
 	if err != nil {
-		log.Fatal(err)
+		return false, nil, NewIOError(err)
 	}
 	currentIndex := new(Index)
 
 	//trazimo redom
 	for i := 0; i < int(sstable.intervalSize); i++ {
-		currentIndex = byteToIndex(sstableFile)
+		currentIndex, err = byteToIndexBefore(sstableFile, summaryStart)
+		if err != nil {
+			return false, nil, err
+		}
+		if currentIndex == nil {
+			break
+		}
 		if currentIndex.Key == Key {
 			found = true
 			break
@@ -335,290 +345,151 @@ func (sstable *SSTableSingle) Find(Key string) (bool, *Data) {
 	}
 
 	if !found {
-		err := sstableFile.Close()
-		if err != nil {
-			log.Fatal(err)
-		}
-		return false, nil
+		return false, nil, nil
 	}
 
 	// ------ Pristupamo disku i uzimamo podatak ------
-	_, err = sstableFile.Seek(int64(currentIndex.Offset+dataStart), 0)
+	_, foundData, err := readVisible(sstableFile, currentIndex.Offset+dataStart, indexStart, seq)
 	if err != nil {
-		log.Fatal(err)
+		return false, nil, err
 	}
-	_, foundData := ByteToData(sstableFile)
 
-	err = sstableFile.Close()
-	if err != nil {
-		log.Fatal(err)
-	}
-	return true, foundData
+	return foundData != nil, foundData, nil
 }
 
-// Vraca duzinu data,index,summary
-func (sstable *SSTableSingle) ReadHeader(file *os.File) (uint64, uint64, uint64) {
-	//Citamo velicinu data zone
-	bytes := make([]byte, 8)
-	_, err := file.Read(bytes)
+// Cita brisanja opsega sa kraja fajla (iza bloomfiltera)
+func (sstable *SSTableSingle) RangeTombstones() ([]*RangeTombstone, error) {
+	sstableFile, err := sstable.OpenFile("sstable.bin")
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
-	dataSize := binary.BigEndian.Uint64(bytes)
+	defer sstableFile.Close()
 
-	//Citamo velicinu indeksne zone
-	bytes = make([]byte, 8)
-	_, err = file.Read(bytes)
+	dataSize, indexSize, summarySize, err := sstable.ReadHeader(sstableFile)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
-	indexSize := binary.BigEndian.Uint64(bytes)
 
-	//Citamo velicinu summary zone
-	bytes = make([]byte, 8)
-	_, err = file.Read(bytes)
+	//Bloomfilter nema zapisanu velicinu pa se cita da bi se doslo do kraja njegove zone
+	_, err = sstableFile.Seek(int64(24+dataSize+indexSize+summarySize), 0)
 	if err != nil {
-		log.Fatal(err)
+		return nil, NewIOError(err)
 	}
-	summarySize := binary.BigEndian.Uint64(bytes)
-
-	return dataSize, indexSize, summarySize
+	_, err = ByteToBloomFilter(sstableFile)
+	if err != nil {
+		return nil, err
+	}
+	return readRangeTombstones(sstableFile)
 }
 
-// Otvara fajl i postavlja pokazivac na pocetak data zone
-// vraca pokazivac na taj fajl i velicinu data zone
-func (sstable *SSTableSingle) GoToData() (*os.File, uint64) {
-	file := sstable.OpenFile("sstable.bin")
-
-	//Citamo header
-	dataSize, _, _ := sstable.ReadHeader(file)
+// Vraca duzinu data,index,summary
+func (sstable *SSTableSingle) ReadHeader(file *os.File) (uint64, uint64, uint64, error) {
+	bytes := make([]byte, 24)
+	_, err := io.ReadFull(file, bytes)
+	if err != nil {
+		return 0, 0, 0, readError(file, err)
+	}
 
-	return file, dataSize + 24
-}
+	//Velicina data zone
+	dataSize := binary.BigEndian.Uint64(bytes[0:8])
 
-// ------------- RANGE SCAN -------------
-// Prolazi kroz sstabelu i trazi kljuceve koji zadovoljavaju trazeni interval
-func (sstable *SSTableSingle) RangeScan(minKey string, maxKey string, scan *Scan) {
+	//Velicina indeksne zone
+	indexSize := binary.BigEndian.Uint64(bytes[8:16])
 
-	//Otvaramo fajl i citamo header
-	sstableFile := sstable.OpenFile("sstable.bin")
+	//Velicina summary zone
+	summarySize := binary.BigEndian.Uint64(bytes[16:24])
 
-	dataSize, indexSize, _ := sstable.ReadHeader(sstableFile)
-
-	//Offseti na pocetke zona
-	dataStart := uint64(24)
-	indexStart := dataStart + dataSize
-	summaryStart := indexStart + indexSize
+	return dataSize, indexSize, summarySize, nil
+}
 
-	//Proveravamo da li je kljuc van opsega
-	_, err := sstableFile.Seek(int64(summaryStart), 0)
+// Otvara fajl i postavlja pokazivac na pocetak data zone
+// vraca pokazivac na taj fajl i velicinu data zone
+func (sstable *SSTableSingle) GoToData() (*os.File, uint64, error) {
+	file, err := sstable.OpenFile("sstable.bin")
 	if err != nil {
-		log.Fatal(err)
-	}
-	summary := byteToSummary(sstableFile)
-
-	if maxKey < summary.FirstKey || minKey > summary.LastKey {
-		err := sstableFile.Close()
-		if err != nil {
-			log.Fatal(err)
-		}
-		return //Preskacemo ovu sstabelu jer kljucevi nisu u opsegu
-	}
-
-	chosenIntervals := make([]*Index, 0) //Cuva intervale koji treba da se pregledaju
-	for i := 1; i < len(summary.Intervals); i++ {
-		if summary.Intervals[i].Key < minKey {
-			continue
-		}
-		if maxKey < summary.Intervals[i-1].Key {
-			break
-		}
-		chosenIntervals = append(chosenIntervals, summary.Intervals[i-1])
+		return nil, 0, err
 	}
 
-	if len(chosenIntervals) < 1 {
-		return
+	//Citamo header
+	dataSize, _, _, err := sstable.ReadHeader(file)
+	if err != nil {
+		file.Close()
+		return nil, 0, err
 	}
 
-	// ------ Otvaramo index tabelu ------
-	currentIndex := new(Index)
-
-	//Prolazimo kroz sve nadjene indeksne delove
-	for i := 0; i < len(chosenIntervals); i++ {
-		if scan.FoundResults > scan.SelectedPageEnd {
-			break
-		}
-
-		_, err := sstableFile.Seek(int64(chosenIntervals[i].Offset+indexStart), 0) //Pomeramo pokazivac na pocetak trazenog indeksnog dela
-		if err != nil {
-			log.Fatal(err)
-		}
-
-		//lista offseta na podatke koji treba da se provere
-		dataOffsetToCheck := make([]uint64, 0)
-
-		//Dodajemo indekse u listu
-		for i := 0; i < int(sstable.intervalSize); i++ {
-			currentIndex = byteToIndex(sstableFile)
-			if currentIndex.Key >= minKey && currentIndex.Key <= maxKey {
-				dataOffsetToCheck = append(dataOffsetToCheck, currentIndex.Offset)
-			} else if currentIndex.Key > maxKey {
-				break
-			}
-		}
-
-		// ------ Pristupamo disku i uzimamo podatake ------
-
-		//Prolazimo kroz svaki indeks i trazimo koji nam trebaju
-		for i := 0; i < len(dataOffsetToCheck); i++ {
-			//Pozicioniramo se na podatak i citamo ga
-			foundKey, foundData := ByteToData(sstableFile, dataOffsetToCheck[i]+dataStart)
-			if !foundData.Tombstone {
-				//Proveravamo da li je obelezen kao obrisan ili je vec dodat
-				if !scan.RemovedKeys[foundKey] && !scan.SelectedKeys[foundKey] {
-					scan.SelectedKeys[foundKey] = true //Obelezimo da je dodat
-
-					scan.FoundResults++
-					//Ukoliko je u opsegu nase stranice pamtimo u Scan
-					if scan.FoundResults >= scan.SelectedPageStart && scan.FoundResults <= scan.SelectedPageEnd {
-						scan.Keys = append(scan.Keys, foundKey)
-						scan.Data = append(scan.Data, foundData)
-					} else if scan.FoundResults > scan.SelectedPageEnd {
-						break
-					}
-				}
-			} else {
-				//Posto je obrisan oznacicemo ga kao obrisanog da se ne uzima u obzir dalje
-				scan.RemovedKeys[foundKey] = true
-			}
+	return file, dataSize + 24, nil
+}
 
-		}
+// Otvara fajl i cita summary
+// vraca fajl, pocetke data i index zone i kraj index zone
+func (sstable *SSTableSingle) readSummary() (*os.File, *Summary, uint64, uint64, uint64, error) {
+	sstableFile, err := sstable.OpenFile("sstable.bin")
+	if err != nil {
+		return nil, nil, 0, 0, 0, err
 	}
 
-	err = sstableFile.Close()
+	dataSize, indexSize, _, err := sstable.ReadHeader(sstableFile)
 	if err != nil {
-		log.Fatal(err)
+		sstableFile.Close()
+		return nil, nil, 0, 0, 0, err
 	}
-}
-
-// ------------- LIST SCAN -------------
-// Prolazi kroz sstabelu i trazi kljuceve koji pocinju zadatim prefiksom
-func (sstable *SSTableSingle) ListScan(prefix string, scan *Scan) {
-
-	//Otvaramo fajl i citamo header
-	sstableFile := sstable.OpenFile("sstable.bin")
-
-	dataSize, indexSize, _ := sstable.ReadHeader(sstableFile)
 
 	//Offseti na pocetke zona
 	dataStart := uint64(24)
 	indexStart := dataStart + dataSize
 	summaryStart := indexStart + indexSize
 
-	//Proveravamo da li je kljuc van opsega
-	_, err := sstableFile.Seek(int64(summaryStart), 0)
+	_, err = sstableFile.Seek(int64(summaryStart), 0)
 	if err != nil {
-		log.Fatal(err)
+		sstableFile.Close()
+		return nil, nil, 0, 0, 0, NewIOError(err)
 	}
-	summary := byteToSummary(sstableFile)
-
-	//najmanje duzine stringova
-	//Trazimo koji string je manji i onda proveravamo toliko cifara, da ne bi izasli iz index range-a
-	minimumLenFirst := int(math.Min(float64(len(prefix)), float64(len(summary.FirstKey))))
-	minimumLenLast := int(math.Min(float64(len(prefix)), float64(len(summary.LastKey))))
-
-	if prefix[:minimumLenFirst] < summary.FirstKey[:minimumLenFirst] || prefix[:minimumLenLast] > summary.LastKey[:minimumLenLast] {
-		err := sstableFile.Close()
-		if err != nil {
-			log.Fatal(err)
-		}
-		return //Preskacemo ovu sstabelu jer kljucevi nisu u opsegu
+	summary, err := byteToSummary(sstableFile)
+	if err != nil {
+		sstableFile.Close()
+		return nil, nil, 0, 0, 0, err
 	}
 
-	chosenIntervals := make([]*Index, 0) //Cuva intervale koji treba da se pregledaju
-	for i := 1; i < len(summary.Intervals); i++ {
+	return sstableFile, summary, dataStart, indexStart, summaryStart, nil
+}
 
-		//za trenutan interval
-		minimumLen := int(math.Min(float64(len(prefix)), float64(len(summary.Intervals[i].Key))))
-		if summary.Intervals[i].Key[:minimumLen] < prefix[:minimumLen] {
-			continue
-		}
-		//za prethodni interval
-		minimumLen = int(math.Min(float64(len(prefix)), float64(len(summary.Intervals[i-1].Key))))
-		if prefix[:minimumLen] < summary.Intervals[i-1].Key[:minimumLen] {
-			break
-		}
-		chosenIntervals = append(chosenIntervals, summary.Intervals[i-1])
-	}
+// ------------- ITERATOR -------------
+// Otvara iterator kroz sve zapise sstabele
+// Fajl ostaje otvoren dok se iterator ne zatvori
+func (sstable *SSTableSingle) NewIterator() (Iterator, error) {
 
-	if len(chosenIntervals) < 1 {
-		return
+	//Otvaramo fajl, citamo header i summary
+	sstableFile, _, dataStart, indexStart, indexEnd, err := sstable.readSummary()
+	if err != nil {
+		return nil, err
 	}
 
-	// ------ Otvaramo index tabelu ------
-	currentIndex := new(Index)
-
-	//Prolazimo kroz sve nadjene indeksne delove
-	for i := 0; i < len(chosenIntervals); i++ {
-		if scan.FoundResults > scan.SelectedPageEnd {
-			break
-		}
-
-		_, err := sstableFile.Seek(int64(chosenIntervals[i].Offset+indexStart), 0) //Pomeramo pokazivac na pocetak trazenog indeksnog dela
-		if err != nil {
-			log.Fatal(err)
-		}
-
-		//lista offseta na podatke koji treba da se provere
-		dataOffsetToCheck := make([]uint64, 0)
-
-		//Dodajemo indekse u listu
-		for i := 0; i < int(sstable.intervalSize); i++ {
-			currentIndex = byteToIndex(sstableFile)
-			if strings.HasPrefix(currentIndex.Key, prefix) {
-				dataOffsetToCheck = append(dataOffsetToCheck, currentIndex.Offset)
-			} else if currentIndex.Key > prefix {
-				break
-			}
-		}
+	//Ucitavamo ceo indeks
+	_, err = sstableFile.Seek(int64(indexStart), 0)
+	if err != nil {
+		sstableFile.Close()
+		return nil, NewIOError(err)
+	}
+	indexes, err := readIndexes(sstableFile, indexEnd)
+	if err != nil {
+		sstableFile.Close()
+		return nil, err
+	}
 
-		// ------ Pristupamo disku i uzimamo podatake ------
-
-		//Prolazimo kroz svaki indeks i trazimo koji nam trebaju
-		for i := 0; i < len(dataOffsetToCheck); i++ {
-			//Pozicioniramo se na podatak i citamo ga
-			foundKey, foundData := ByteToData(sstableFile, dataOffsetToCheck[i]+dataStart)
-			if !foundData.Tombstone {
-				//Proveravamo da li je obelezen kao obrisan ili je vec dodat
-				if !scan.RemovedKeys[foundKey] && !scan.SelectedKeys[foundKey] {
-					scan.SelectedKeys[foundKey] = true //Obelezimo da je dodat
-
-					scan.FoundResults++
-					//Ukoliko je u opsegu nase stranice pamtimo u Scan
-					if scan.FoundResults >= scan.SelectedPageStart && scan.FoundResults <= scan.SelectedPageEnd {
-						scan.Keys = append(scan.Keys, foundKey)
-						scan.Data = append(scan.Data, foundData)
-					} else if scan.FoundResults > scan.SelectedPageEnd {
-						break
-					}
-				}
-			} else {
-				//Posto je obrisan oznacicemo ga kao obrisanog da se ne uzima u obzir dalje
-				scan.RemovedKeys[foundKey] = true
-			}
+	return newSSTableIterator(sstableFile, dataStart, indexStart, indexes), nil
+}
 
-		}
+func (sstable *SSTableSingle) ReadData() error {
+	file, err := sstable.OpenFile("sstable.bin")
+	if err != nil {
+		return err
 	}
+	defer file.Close()
 
-	err = sstableFile.Close()
+	dataSize, _, _, err := sstable.ReadHeader(file)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
-}
-
-func (sstable *SSTableSingle) ReadData() {
-	file := sstable.OpenFile("sstable.bin")
-	dataSize, _, _ := sstable.ReadHeader(file)
 
 	//Offseti na pocetke zona
 	dataStart := uint64(24)
@@ -627,63 +498,39 @@ func (sstable *SSTableSingle) ReadData() {
 	for {
 		currentOffset, err := file.Seek(0, 1)
 		if err != nil {
-			log.Fatal(err)
+			return NewIOError(err)
 		}
 		if uint64(currentOffset) >= indexStart {
 			break
 		}
-		entry := ReadEntry(file)
+		entry, err := ReadEntry(file)
+		if err != nil {
+			return err
+		}
+		if entry == nil {
+			break
+		}
 		entry.Print()
 	}
-	err := file.Close()
-	if err != nil {
-		log.Fatal(err)
-	}
+	return nil
 }
 
 // Vraca koji je nivo i koja je po redu sstabela u LSM stablu
-func (sstable *SSTableSingle) GetPosition() (uint32, uint32) {
-	arr := strings.Split(sstable.directory, "/")
-	levelString := strings.TrimLeft(arr[0], "level")
-	fileString := strings.TrimLeft(arr[1], "sstable")
-
-	levelNum, err := strconv.Atoi(levelString)
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	fileNum, err := strconv.Atoi(fileString)
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	return uint32(levelNum), uint32(fileNum)
-
+func (sstable *SSTableSingle) GetPosition() (uint32, uint32, error) {
+	return parsePosition(sstable.directory)
 }
 
 //Vraca opseg iz summaryja
-func (sstable *SSTableSingle) GetRange() (string, string) {
-	//Otvaramo fajl i citamo header
-	sstableFile := sstable.OpenFile("sstable.bin")
-
-	dataSize, indexSize, _ := sstable.ReadHeader(sstableFile)
-
-	//Offseti na pocetke zona
-	dataStart := uint64(24)
-	indexStart := dataStart + dataSize
-	summaryStart := indexStart + indexSize
-
-	//Proveravamo da li je kljuc van opsega
-	_, err := sstableFile.Seek(int64(summaryStart), 0)
+func (sstable *SSTableSingle) GetRange() (string, string, error) {
+	sstableFile, summary, _, _, _, err := sstable.readSummary()
 	if err != nil {
-		log.Fatal(err)
+		return "", "", err
 	}
-	summary := byteToSummary(sstableFile)
 
 	err = sstableFile.Close()
 	if err != nil {
-		log.Fatal(err)
+		return "", "", NewIOError(err)
 	}
 
-	return summary.FirstKey, summary.LastKey
+	return summary.FirstKey, summary.LastKey, nil
 }
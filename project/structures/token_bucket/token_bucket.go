@@ -13,10 +13,7 @@ type TokenBucket struct {
 	lock     chan struct{}
 }
 
-func NewTokenBucket() *TokenBucket {
-
-	c := config.GetConfig()
-
+func NewTokenBucket(c *config.Config) *TokenBucket {
 	return &TokenBucket{
 		rate:     c.TokenBucketRate,
 		capacity: c.TokenBucketCap,
@@ -0,0 +1,214 @@
+package wal
+
+import (
+	. "project/keyvalue/errs"
+	. "project/keyvalue/structures/entry"
+	"time"
+)
+
+//Grupni upis (group commit) u WAL
+//Aktivni segment ostaje otvoren, a upisi samo dodaju svoje zapise u red (Append) i cekaju (Wait)
+//Prvi upis koji ceka dok niko ne radi sa segmentom postaje leader: van lock-a upisuje sve zapise iz reda
+//i u always rezimu ih sync-uje, pa se jednim sync-om sacuvaju zapisi svih upisa koji su se u medjuvremenu nakupili
+//Upis se zavrsava kada je njegov zapis sacuvan prema rezimu sync-ovanja:
+//none     -> zapis je upisan u segment (predat operativnom sistemu)
+//interval -> zapis je upisan u segment, a gorutina u pozadini sync-uje segment na svakih sync_interval
+//always   -> segment je sync-ovan posle upisa zapisa
+
+// Dodaje zapis u red za upis i vraca redni broj zapisa koji se prosledjuje Wait
+// Poziva se pod lock-om za upis baze, pa zapisi u segmentu imaju isti redosled kao upisi
+// Ukoliko zapis ne staje u aktivni segment prvo se zapocinje novi (zapis veci od segmenta sam zauzima segment)
+func (wal *WriteAheadLog) Append(entry *Entry) (uint64, error) {
+	bytes := EntryToBytes(entry)
+	wal.lock.Lock()
+	defer wal.lock.Unlock()
+	if wal.err != nil {
+		return 0, wal.err
+	}
+	if wal.file == nil {
+		err := wal.openSegment()
+		if err != nil {
+			return 0, err
+		}
+	}
+	if wal.used > 0 && wal.used+uint64(len(bytes)) > wal.segment_size {
+		err := wal.rotateSegment()
+		if err != nil {
+			return 0, err
+		}
+	}
+	wal.pending = append(wal.pending, bytes...)
+	wal.used += uint64(len(bytes))
+	wal.appended++
+	return wal.appended, nil
+}
+
+// Broj zapisa dodatih u red, Wait sa ovim brojem ceka sve do sada dodate zapise
+func (wal *WriteAheadLog) Appended() uint64 {
+	wal.lock.Lock()
+	defer wal.lock.Unlock()
+	return wal.appended
+}
+
+// Ceka da zapis sa datim rednim brojem (i svi pre njega) bude sacuvan prema rezimu sync-ovanja
+// Ukoliko niko ne upisuje u segment, pozivalac postaje leader i upisuje sve zapise iz reda
+func (wal *WriteAheadLog) Wait(ticket uint64) error {
+	wal.lock.Lock()
+	defer wal.lock.Unlock()
+	for true {
+		if wal.durable(ticket) {
+			return nil
+		}
+		if wal.err != nil {
+			return wal.err
+		}
+		if wal.writing {
+			wal.cond.Wait()
+			continue
+		}
+		wal.writePending(wal.sync_mode == "always", true)
+	}
+	return nil
+}
+
+// Da li je zapis sa datim rednim brojem sacuvan prema rezimu sync-ovanja
+func (wal *WriteAheadLog) durable(ticket uint64) bool {
+	if wal.sync_mode == "always" {
+		return wal.synced >= ticket
+	}
+	return wal.written >= ticket
+}
+
+// Upisuje sve zapise iz reda u segment i po potrebi ga sync-uje
+// Pozivalac drzi lock i niko drugi ne radi sa segmentom
+// Ukoliko je unlock true lock se otpusta tokom upisa, pa novi upisi mogu da se dodaju u red
+func (wal *WriteAheadLog) writePending(sync bool, unlock bool) {
+	batch := wal.pending
+	count := wal.appended
+	offset := wal.offset
+	wal.pending = nil
+	file := wal.file
+	if unlock {
+		wal.writing = true
+		wal.lock.Unlock()
+	}
+
+	var err error
+	if len(batch) > 0 {
+		_, err = file.WriteAt(batch, int64(offset))
+	}
+	if err == nil && sync {
+		err = file.Sync()
+	}
+
+	if unlock {
+		wal.lock.Lock()
+		wal.writing = false
+	}
+	if err != nil {
+		wal.err = NewIOError(err)
+	} else {
+		wal.offset = offset + uint64(len(batch))
+		wal.written = count
+		if sync {
+			wal.synced = count
+		}
+	}
+	wal.cond.Broadcast()
+}
+
+// Upisuje zapise iz reda, sync-uje (osim u none rezimu) i zatvara aktivni segment
+// Neiskorisceni prealocirani deo segmenta se odseca
+// Pozivalac drzi lock
+func (wal *WriteAheadLog) closeSegment() error {
+	for wal.writing {
+		wal.cond.Wait()
+	}
+	if wal.err != nil {
+		return wal.err
+	}
+	if wal.file == nil {
+		return nil
+	}
+	wal.writePending(wal.sync_mode != "none", false)
+	if wal.err != nil {
+		return wal.err
+	}
+	err := wal.file.Truncate(int64(wal.offset))
+	if err != nil {
+		wal.file.Close()
+		wal.file = nil
+		wal.err = NewIOError(err)
+		return wal.err
+	}
+	err = wal.file.Close()
+	wal.file = nil
+	if err != nil {
+		wal.err = NewIOError(err)
+		return wal.err
+	}
+	return nil
+}
+
+// Pokrece gorutinu koja u interval rezimu periodicno sync-uje aktivni segment
+func (wal *WriteAheadLog) startSyncing() {
+	wal.syncStop = make(chan struct{})
+	wal.syncDone = make(chan struct{})
+	go wal.syncLoop()
+}
+
+func (wal *WriteAheadLog) syncLoop() {
+	defer close(wal.syncDone)
+	ticker := time.NewTicker(wal.sync_interval)
+	defer ticker.Stop()
+	for true {
+		select {
+		case <-wal.syncStop:
+			return
+		case <-ticker.C:
+			wal.syncWritten()
+		}
+	}
+}
+
+// Sync-uje zapise koji su upisani u segment od poslednjeg sync-a
+func (wal *WriteAheadLog) syncWritten() {
+	wal.lock.Lock()
+	defer wal.lock.Unlock()
+	for wal.writing {
+		wal.cond.Wait()
+	}
+	if wal.err != nil || wal.file == nil || wal.synced >= wal.written {
+		return
+	}
+	count := wal.written
+	file := wal.file
+	wal.writing = true
+	wal.lock.Unlock()
+	err := file.Sync()
+	wal.lock.Lock()
+	wal.writing = false
+	if err != nil {
+		wal.err = NewIOError(err)
+	} else {
+		wal.synced = count
+	}
+	wal.cond.Broadcast()
+}
+
+// Upisuje i sync-uje zapise koji cekaju, zaustavlja periodicni sync i zatvara segment
+// Nakon zatvaranja svi upisi vracaju ErrClosed
+func (wal *WriteAheadLog) Close() error {
+	if wal.syncStop != nil {
+		close(wal.syncStop)
+		<-wal.syncDone
+		wal.syncStop = nil
+	}
+	wal.lock.Lock()
+	defer wal.lock.Unlock()
+	err := wal.closeSegment()
+	if wal.err == nil {
+		wal.err = ErrClosed
+	}
+	return err
+}
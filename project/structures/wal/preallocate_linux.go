@@ -0,0 +1,22 @@
+//go:build linux
+
+package wal
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// Zauzima prostor na disku za ceo segment unapred, pa upisi ne menjaju velicinu fajla
+// Ukoliko fajl sistem ne podrzava fallocate fajl se samo dopunjava nulama do date velicine
+func preallocate(file *os.File, size uint64) error {
+	if size == 0 {
+		return nil
+	}
+	err := syscall.Fallocate(int(file.Fd()), 0, 0, int64(size))
+	if errors.Is(err, syscall.EOPNOTSUPP) || errors.Is(err, syscall.ENOSYS) {
+		return extendFile(file, size)
+	}
+	return err
+}
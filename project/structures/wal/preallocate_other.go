@@ -0,0 +1,12 @@
+//go:build !linux
+
+package wal
+
+import (
+	"os"
+)
+
+// Dopunjava segment nulama do date velicine, pa upisi ne menjaju velicinu fajla
+func preallocate(file *os.File, size uint64) error {
+	return extendFile(file, size)
+}
@@ -2,80 +2,140 @@ package wal
 
 import (
 	"encoding/binary"
-	"log"
+	"io"
 	"os"
 	. "project/keyvalue/config"
+	. "project/keyvalue/errs"
 	. "project/keyvalue/structures/dataType"
 	. "project/keyvalue/structures/entry"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
 /*
-   +---------------+-----------------+---------------+---------------+-----------------+-...-+--...--+
-   |    CRC (4B)   | Timestamp (8B) | Tombstone(1B) | Key Size (8B) | Value Size (8B) | Key | Value |
-   +---------------+-----------------+---------------+---------------+-----------------+-...-+--...--+
-   CRC = 32bit hash computed over the payload using CRC
+   +---------------+-----------------+----------+-------------+---------------+---------------+-----------------+-...-+--...--+
+   |    CRC (4B)   | Timestamp (8B) | Seq (8B) | Expiry (8B) | Tombstone(1B) | Key Size (8B) | Value Size (8B) | Key | Value |
+   +---------------+-----------------+----------+-------------+---------------+---------------+-----------------+-...-+--...--+
+   CRC = 32bit hash computed over the payload using CRC (checked for every record during recovery)
    Key Size = Length of the Key data
-   Tombstone = If this record was deleted and has a Value
+   Tombstone = Record type: 0 - value, 1 - deleted (tombstone), 2 - batch, 3 - merge operand, 4 - column family,
+               5 - range delete (from the Key, inclusive, to the Value, exclusive)
+               (the Value of a batch holds several records and the CRC covers all of them,
+               the Value of a column family record holds one record of the family named by the Key)
    Value Size = Length of the Value data
    Key = Key data
    Value = Value data
-   Timestamp = Timestamp of the operation in seconds
+   Timestamp = Timestamp of the operation in seconds (metadata only)
+   Seq = Sequence number of the operation, used to decide which version of a key is newer
+         (a batch carries the sequence number of its last record)
+   Expiry = Time in Unix nanoseconds after which the record is treated as absent, 0 - never expires
+
+   Every segment starts with an 8 byte header: the magic "KVWL" followed by the format version (4B)
+   Segments without the header were written before sequence numbers were added and are rejected
+   (a header of zeros is a segment that was created but never written to)
+
+   Segments are named wal_<ID>.log, IDs only grow and a segment is never renamed
+   A new segment is preallocated to wal_segment_size bytes (the unused part is zeros) and records are
+   appended to it until the next one does not fit
+   A segment is deleted only after all of its records have been flushed to sstables
 */
 
+const (
+	WAL_MAGIC          = "KVWL"
+	WAL_FORMAT_VERSION = 2
+	WAL_HEADER_SIZE    = 8
+)
+
 type WriteAheadLog struct {
-	buffer          []byte
-	buffer_capacity uint
-	buffer_size     uint
 	directory       string
-	current_offset  uint
-	low_water_mark  uint
+	segment_size    uint64     //Velicina na koju se segment prealocira, zapis koji ne staje zapocinje novi segment
+	strict_recovery bool       //Nepotpun zapis na kraju loga prekida oporavak umesto da se odsece
+	segments        []uint64   //ID-jevi postojecih segmenata od najstarijeg, poslednji je aktivan
+	segments_lock   sync.Mutex //segmente brise i gorutina koja flush-uje memtabele
+
+	//Grupni upis (groupCommit.go)
+	sync_mode     string        //none, interval ili always
+	sync_interval time.Duration //Period sync-ovanja u interval rezimu
+	file          *os.File      //Aktivni segment, otvoren od prvog upisa do zapocinjanja novog
+	used          uint64        //Bajtovi aktivnog segmenta zauzeti zapisima (upisanim i onima u redu)
+	offset        uint64        //Bajtovi aktivnog segmenta upisani u fajl, naredni upis pocinje od njih
+	lock          sync.Mutex
+	cond          *sync.Cond //Signalizira da su zapisi upisani ili sync-ovani
+	pending       []byte     //Zapisi koji cekaju da ih leader upise u segment
+	appended      uint64     //Broj zapisa dodatih u red
+	written       uint64     //Broj zapisa upisanih u segment
+	synced        uint64     //Broj zapisa sacuvanih na disku (sync-ovanih)
+	writing       bool       //Leader ili periodicni sync upravo radi sa segmentom van lock-a
+	err           error      //Greska pri upisu ili sync-u, nakon nje svi upisi je vracaju
+	syncStop      chan struct{}
+	syncDone      chan struct{}
 }
 
-// inicijalizuje Write Ahead Log i ukoliko logovi vec postoje povecava offset do posle poslednjeg loga
-func NewWriteAheadLog(directory string) *WriteAheadLog {
-	config := GetConfig()
+// inicijalizuje Write Ahead Log i ucitava ID-jeve postojecih segmenata
+func NewWriteAheadLog(directory string, config *Config) (*WriteAheadLog, error) {
 
 	//ukoliko ne postoji napravi direktorijum
 	_, err := os.Stat(directory)
 	if os.IsNotExist(err) {
 		err = os.MkdirAll(directory, os.ModePerm)
 		if err != nil {
-			log.Fatal(err)
+			return nil, NewIOError(err)
 		}
 	}
 	wal := new(WriteAheadLog)
 	wal.directory = directory
-	wal.current_offset = 0
-	//ukoliko postoji vec direktorijum sa logovima azuriramo offset
-	for {
-		filename := wal.generateSegmentFilename()
-		_, err := os.Stat(filename)
-		if os.IsNotExist(err) {
-			break
-		}
-		wal.current_offset++
+	wal.segment_size = config.WalSegmentSize
+	wal.strict_recovery = config.WalStrictRecovery
+	//ne zna se koji od postojecih segmenata su flush-ovani pa se cuvaju svi
+	//dok pozivalac ne utvrdi koji su pokriveni sstabelama (vidi ReleaseSegments)
+	wal.segments, err = listSegments(directory)
+	if err != nil {
+		return nil, err
 	}
 
-	//zadajemo inicijalne vrednosti
-	wal.buffer = make([]byte, 0)
-	wal.low_water_mark = config.WalWaterMark
-	wal.buffer_capacity = config.WalBufferCapacity
-	wal.buffer_size = 0
-	return wal
+	wal.sync_mode, wal.sync_interval, err = ParseWalSyncMode(config.WalSyncMode)
+	if err != nil {
+		return nil, err
+	}
+	wal.cond = sync.NewCond(&wal.lock)
+	if wal.sync_mode == "interval" {
+		wal.startSyncing()
+	}
+	return wal, nil
 
 }
 
-// generise ime filea sa trenutnim offsetom
-func (wal *WriteAheadLog) generateSegmentFilename(offset ...uint) string {
-	chosen_offset := wal.current_offset
-	if len(offset) > 0 {
-		chosen_offset = offset[0]
+// Vraca ID-jeve segmenata iz direktorijuma, od najstarijeg
+func listSegments(directory string) ([]uint64, error) {
+	files, err := os.ReadDir(directory)
+	if err != nil {
+		return nil, NewIOError(err)
+	}
+	segments := make([]uint64, 0)
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || !strings.HasPrefix(name, "wal_") || !strings.HasSuffix(name, ".log") {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, "wal_"), ".log"), 10, 64)
+		if err != nil {
+			continue
+		}
+		segments = append(segments, id)
 	}
+	sort.Slice(segments, func(i, j int) bool { return segments[i] < segments[j] })
+	return segments, nil
+}
+
+// generise ime fajla segmenta sa datim ID-jem
+func (wal *WriteAheadLog) segmentFilename(id uint64) string {
 	filename := wal.directory + "/wal_"
-	ustr := strconv.FormatUint(uint64(chosen_offset), 10)
+	ustr := strconv.FormatUint(id, 10)
 
-	//upotpunjava ime sa potrebnim nizom nula ukoliko ofset nije vec petocifren broj
+	//upotpunjava ime sa potrebnim nizom nula ukoliko ID nije vec petocifren broj
 	for len(ustr) < 5 {
 		ustr = "0" + ustr
 	}
@@ -83,171 +143,362 @@ func (wal *WriteAheadLog) generateSegmentFilename(offset ...uint) string {
 	return filename
 }
 
-// kreira file sa narednim offsetom
-func (wal *WriteAheadLog) NewWALFile() *os.File {
+// Kreira prealociran segment sa narednim ID-jem koji postaje aktivan
+// Pozivalac drzi lock
+func (wal *WriteAheadLog) createSegment() error {
+	wal.segments_lock.Lock()
+	id := uint64(0)
+	if len(wal.segments) > 0 {
+		id = wal.segments[len(wal.segments)-1] + 1
+	}
+	wal.segments_lock.Unlock()
 
-	filename := wal.generateSegmentFilename()
-	wal.current_offset++
 	//pravi file u wal direktorijumu
-	file, err := os.Create(filename)
+	file, err := os.OpenFile(wal.segmentFilename(id), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return NewIOError(err)
+	}
+	err = preallocate(file, wal.segment_size)
+	if err == nil {
+		_, err = file.WriteAt(segmentHeader(), 0)
+	}
 	if err != nil {
-		log.Fatal(err)
+		file.Close()
+		return NewIOError(err)
 	}
-	return file
+
+	wal.segments_lock.Lock()
+	wal.segments = append(wal.segments, id)
+	wal.segments_lock.Unlock()
+	wal.file = file
+	wal.used = WAL_HEADER_SIZE
+	wal.offset = WAL_HEADER_SIZE
+	return nil
 }
 
-// brise sve osim poslednjeg segmenta
-func (wal *WriteAheadLog) deleteOldSegments() {
-	wal.current_offset--
-	for offset := uint(0); offset < wal.current_offset; offset++ {
-		err := os.Remove(wal.generateSegmentFilename(offset))
-		if err != nil {
-			log.Fatal(err)
+// Zaglavlje segmenta sa oznakom i verzijom formata
+func segmentHeader() []byte {
+	header := make([]byte, WAL_HEADER_SIZE)
+	copy(header, WAL_MAGIC)
+	binary.BigEndian.PutUint32(header[4:], WAL_FORMAT_VERSION)
+	return header
+}
+
+// Proverava zaglavlje segmenta i vraca da li je segment prazan (zaglavlje nije upisano)
+func checkHeader(filename string, bytes []byte) (bool, error) {
+	if len(bytes) < WAL_HEADER_SIZE || isZero(bytes[:WAL_HEADER_SIZE]) {
+		if !isZero(bytes) {
+			return false, NewCorruptionError("segment %s nema zaglavlje", filename)
 		}
+		return true, nil
 	}
-	//preimenuje poslednji log u prvi i vraca offset na svoje mesto
-	err := os.Rename(wal.generateSegmentFilename(wal.current_offset), wal.generateSegmentFilename(0))
-	if err != nil {
-		log.Fatal(err)
+	if string(bytes[:4]) != WAL_MAGIC {
+		return false, NewFormatError("segment %s nema oznaku verzije formata (zapisan je pre uvodjenja rednih brojeva upisa), "+
+			"podaci se moraju ponovo upisati u novu bazu", filename)
+	}
+	version := binary.BigEndian.Uint32(bytes[4:WAL_HEADER_SIZE])
+	if version != WAL_FORMAT_VERSION {
+		return false, NewFormatError("segment %s je zapisan u verziji formata %d, podrzana je verzija %d", filename, version, WAL_FORMAT_VERSION)
 	}
-	wal.current_offset = 1
+	return false, nil
 }
 
-// batch zapis - zapisuje ceo buffer u segment sa sledecim offsetom
-func (wal *WriteAheadLog) WriteBuffer() {
-	//kreira fajl sa narednim offsetom
-	file := wal.NewWALFile()
+// Otvara poslednji segment, upisi se nastavljaju posle njegovog poslednjeg ispravnog zapisa
+// Ukoliko segmenata nema kreira prvi
+// Pozivalac drzi lock
+func (wal *WriteAheadLog) openSegment() error {
+	wal.segments_lock.Lock()
+	if len(wal.segments) == 0 {
+		wal.segments_lock.Unlock()
+		return wal.createSegment()
+	}
+	id := wal.segments[len(wal.segments)-1]
+	wal.segments_lock.Unlock()
 
-	//zapisujemo ceo buffer u novi fajl
-	_, err := file.Write(wal.buffer)
+	filename := wal.segmentFilename(id)
+	file, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return NewIOError(err)
+	}
+	bytes, err := io.ReadAll(file)
+	if err != nil {
+		file.Close()
+		return NewIOError(err)
+	}
+	empty, err := checkHeader(filename, bytes)
 	if err != nil {
-		log.Fatal(err)
+		file.Close()
+		return err
+	}
+	err = preallocate(file, wal.segment_size)
+	if err == nil && empty {
+		_, err = file.WriteAt(segmentHeader(), 0)
 	}
-	wal.buffer = make([]byte, 0)
-	wal.buffer_size = 0
-	err = file.Close()
 	if err != nil {
-		log.Fatal(err)
+		file.Close()
+		return NewIOError(err)
+	}
+	wal.file = file
+	wal.used = WAL_HEADER_SIZE
+	if !empty {
+		wal.used += uint64(segmentEnd(bytes[WAL_HEADER_SIZE:]))
 	}
+	wal.offset = wal.used
+	return nil
 }
 
-// dodajemo entry u baffer, ukoliko je pun zapisuje buffer u segment
-func (wal *WriteAheadLog) addEntryToBuffer(entry *Entry) {
-	wal.buffer = append(wal.buffer, EntryToBytes(entry)...)
-	wal.buffer_size++
-	if wal.buffer_size == wal.buffer_capacity {
-		wal.WriteBuffer()
-		if wal.current_offset > wal.low_water_mark {
-			wal.deleteOldSegments()
-		}
+// Povecava fajl na datu velicinu (dopunjava ga nulama), veci fajl se ne menja
+func extendFile(file *os.File, size uint64) error {
+	info, err := file.Stat()
+	if err != nil {
+		return err
 	}
-
+	if uint64(info.Size()) >= size {
+		return nil
+	}
+	return file.Truncate(int64(size))
 }
 
-// zapisuje direktno entry
-func (wal *WriteAheadLog) WriteEntry(entry *Entry) {
-	//otvaramo file u append only rezimu
-	offset := wal.current_offset
-	if offset != 0 {
-		offset--
-	}
-	filename := wal.generateSegmentFilename(offset)
-	file, err := os.OpenFile(filename, os.O_APPEND, 0600)
+// zapisuje direktno entry i ceka da bude sacuvan prema rezimu sync-ovanja
+func (wal *WriteAheadLog) WriteEntry(entry *Entry) error {
+	ticket, err := wal.Append(entry)
 	if err != nil {
-		if os.IsNotExist(err) {
-			file, err = os.Create(filename)
-		} else {
-			log.Fatal(err)
-		}
+		return err
 	}
+	return wal.Wait(ticket)
+}
 
-	//zapisujemo entry kao niz bytova
-	_, err = file.Write(EntryToBytes(entry))
+// Zapocinje novi segment (poziva se kada naredni zapis ne staje u aktivni segment)
+// Zapisi koji cekaju u redu se prvo upisuju i sync-uju u prethodni segment
+// Prethodni segment se cuva dok se ne pozove ReleaseSegments nakon flush-a
+// Pozivalac drzi lock
+func (wal *WriteAheadLog) rotateSegment() error {
+	err := wal.closeSegment()
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
-	err = file.Close()
-	if err != nil {
-		log.Fatal(err)
+	return wal.createSegment()
+}
+
+// ID aktivnog segmenta, zapisi dodati od sada se nalaze u njemu ili u kasnijim segmentima
+func (wal *WriteAheadLog) ActiveSegment() uint64 {
+	wal.segments_lock.Lock()
+	defer wal.segments_lock.Unlock()
+	if len(wal.segments) == 0 {
+		return 0
 	}
+	return wal.segments[len(wal.segments)-1]
+}
 
-	//Proverava da li je prekoracio granicu za brisanje starih
-	if wal.current_offset > wal.low_water_mark {
-		wal.deleteOldSegments()
+// Brise segmente sa ID-jem manjim od upTo
+// Poziva se tek kada su svi zapisi iz tih segmenata flush-ovani, aktivni segment se nikad ne brise
+func (wal *WriteAheadLog) ReleaseSegments(upTo uint64) error {
+	wal.segments_lock.Lock()
+	defer wal.segments_lock.Unlock()
+	for len(wal.segments) > 1 && wal.segments[0] < upTo {
+		err := os.Remove(wal.segmentFilename(wal.segments[0]))
+		if err != nil && !os.IsNotExist(err) {
+			return NewIOError(err)
+		}
+		wal.segments = wal.segments[1:]
 	}
+	return nil
+}
+
+// Kopija ID-jeva postojecih segmenata
+func (wal *WriteAheadLog) segmentList() []uint64 {
+	wal.segments_lock.Lock()
+	defer wal.segments_lock.Unlock()
+	return append([]uint64{}, wal.segments...)
 }
 
 // cita pojedinacan segment
-func (wal *WriteAheadLog) readLog(filename string) {
-	file, err := os.Open(filename)
+func (wal *WriteAheadLog) readLog(filename string) error {
+	bytes, err := os.ReadFile(filename)
 	if err != nil {
-		log.Fatal(err)
+		return NewIOError(err)
+	}
+	empty, err := checkHeader(filename, bytes)
+	if err != nil || empty {
+		return err
 	}
 
-	for {
-		entry := ReadEntry(file)
+	position := WAL_HEADER_SIZE
+	for position < len(bytes) && !zeroHeader(bytes[position:]) {
+		entry, length := parseRecord(bytes[position:])
 		if entry == nil {
-			break
+			return NewCorruptionError("zapis u %s na poziciji %d je nepotpun", filename, position)
 		}
 		entry.Print()
+		position += length
 	}
-	err = file.Close()
-	if err != nil {
-		log.Fatal(err)
-	}
-
+	return nil
 }
 
 // cita hronoloskim redom sve segmente
-func (wal *WriteAheadLog) ReadAllLogs() {
-	offset := uint(0)
-	for offset < wal.current_offset {
+func (wal *WriteAheadLog) ReadAllLogs() error {
+	for _, id := range wal.segmentList() {
 		println("==========================================================")
-		println("Current offset: ", offset)
+		println("Segment: ", id)
 		println("==========================================================")
-		wal.readLog(wal.generateSegmentFilename(offset))
-		offset++
+		err := wal.readLog(wal.segmentFilename(id))
+		if err != nil {
+			return err
+		}
 	}
+	return nil
 }
 
-// Funkcija ucitava najnoviji segment WAL-a koji ce memtabela koristiti pri kreiranju
-// da ne bi bila izgubljena u OM
-func (wal *WriteAheadLog) InitiateMemTable() ([]string, []*Data) {
-	keys := make([]string, 0)
-	dataArr := make([]*Data, 0)
+// Jedan zapis procitan iz WAL-a pri oporavku
+type Record struct {
+	Segment uint64 //ID segmenta u kom je zapis
+	Family  string //Familija kolona, prazna za zapise podrazumevane familije
+	Key     string
+	Data    *Data
+}
 
-	offset := wal.current_offset
-	if offset != 0 {
-		offset--
+// Funkcija ucitava sve segmente WAL-a (od najstarijeg) koje ce memtabele koristiti pri kreiranju
+// da ne bi bile izgubljene u OM
+// Stariji segmenti mogu sadrzati zapise koji su vec flush-ovani, njih preskace pozivalac
+// Batch zapisi se raspakuju u pojedinacne zapise, a CRC se proverava za svaki zapis
+// Nepotpun zapis na kraju loga (upis prekinut padom) se smatra krajem loga i odseca se,
+// osim u strogom rezimu (wal_strict_recovery) kada se oporavak prekida sa ErrCorruption
+// Ostecen zapis iza kog u logu postoje drugi zapisi uvek prekida oporavak
+func (wal *WriteAheadLog) InitiateMemTable() ([]*Record, error) {
+	records := make([]*Record, 0)
+	segments := wal.segmentList()
+	for i, id := range segments {
+		err := wal.readSegment(id, segments[i+1:], &records)
+		if err != nil {
+			return nil, err
+		}
 	}
+	return records, nil
+}
 
-	file, err := os.Open(wal.generateSegmentFilename(offset))
+// Dodaje zapise jednog segmenta u niz zapisa
+// Segment se cita do kraja fajla ili do nula iz prealokacije
+func (wal *WriteAheadLog) readSegment(id uint64, later []uint64, records *[]*Record) error {
+	filename := wal.segmentFilename(id)
+	//Otvaramo i za pisanje da bi mogli da odsecemo nepotpun zapis na kraju
+	file, err := os.OpenFile(filename, os.O_RDWR, 0600)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return keys, dataArr
+			return nil
 		}
-		log.Fatal(err)
+		return NewIOError(err)
+	}
+	defer file.Close()
+	bytes, err := io.ReadAll(file)
+	if err != nil {
+		return NewIOError(err)
+	}
+	empty, err := checkHeader(filename, bytes)
+	if err != nil || empty {
+		return err
 	}
 
-	for {
-		entry := ReadEntry(file)
-		if entry == nil {
+	position := WAL_HEADER_SIZE
+	for position < len(bytes) && !zeroHeader(bytes[position:]) {
+		entry, length := parseRecord(bytes[position:])
+		if entry == nil || !entry.CheckCrc() {
+			//Zapis koji nije do kraja zapisan ili mu se CRC ne poklapa je nepotpun upis samo ukoliko je poslednji
+			if entry != nil && !isZero(bytes[position+length:]) {
+				return NewCorruptionError("zapis u %s na poziciji %d ima neispravan CRC", filename, position)
+			}
+			return wal.tornTail(file, later, int64(position))
+		}
+		position += length
+
+		entries := []*Entry{entry}
+		if entry.IsBatch() {
+			entries, err = entry.BatchEntries()
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, current := range entries {
+			family := ""
+			if current.IsFamily() {
+				family, current, err = current.FamilyEntry()
+				if err != nil {
+					return err
+				}
+			}
+			key, data := current.ToData()
+			*records = append(*records, &Record{Segment: id, Family: family, Key: key, Data: data})
+		}
+	}
+	return nil
+}
+
+// Vraca zapis sa pocetka niza bajtova i njegovu duzinu
+// Ukoliko zapis nije ceo vraca nil
+func parseRecord(bytes []byte) (*Entry, int) {
+	if len(bytes) < KEY_START {
+		return nil, 0
+	}
+	keySize := binary.BigEndian.Uint64(bytes[KEY_SIZE_START:VALUE_SIZE_START])
+	valueSize := binary.BigEndian.Uint64(bytes[VALUE_SIZE_START:KEY_START])
+	remaining := uint64(len(bytes) - KEY_START)
+	if keySize > remaining || valueSize > remaining-keySize {
+		return nil, 0
+	}
+	length := KEY_START + int(keySize+valueSize)
+	return BytesToEntry(bytes[:length]), length
+}
+
+// Duzina ispravnog dela segmenta, do prvog zapisa koji nije ceo ili do nula iz prealokacije
+func segmentEnd(bytes []byte) int {
+	position := 0
+	for position < len(bytes) && !zeroHeader(bytes[position:]) {
+		entry, length := parseRecord(bytes[position:])
+		if entry == nil || !entry.CheckCrc() {
 			break
 		}
-		tombstone := false
-		if entry.Tombstone[0] == byte(uint8(1)) {
-			tombstone = true
+		position += length
+	}
+	return position
+}
+
+// Proverava da li na pocetku niza pocinju nule iz prealokacije
+// Nijedan zapis ne pocinje nulama jer CRC zapisa od samih nula nije 0
+func zeroHeader(bytes []byte) bool {
+	if len(bytes) > KEY_START {
+		bytes = bytes[:KEY_START]
+	}
+	return isZero(bytes)
+}
+
+func isZero(bytes []byte) bool {
+	for _, b := range bytes {
+		if b != 0 {
+			return false
 		}
-		timestamp := binary.BigEndian.Uint64(entry.Timestamp)
-		data := NewData(entry.Value, tombstone, timestamp)
-		key := string(entry.Key)
+	}
+	return true
+}
 
-		keys = append(keys, key)
-		dataArr = append(dataArr, data)
+// Obradjuje nepotpun zapis na datoj poziciji segmenta
+// Zapis je kraj loga samo ukoliko u kasnijim segmentima nema zapisa, tada se odseca
+// da bi se novi zapisi nastavili na ispravan deo segmenta
+func (wal *WriteAheadLog) tornTail(file *os.File, later []uint64, position int64) error {
+	if wal.strict_recovery {
+		return NewCorruptionError("zapis u %s na poziciji %d je nepotpun", file.Name(), position)
+	}
+	for _, id := range later {
+		bytes, err := os.ReadFile(wal.segmentFilename(id))
+		if err != nil && !os.IsNotExist(err) {
+			return NewIOError(err)
+		}
+		if len(bytes) > WAL_HEADER_SIZE && !isZero(bytes[WAL_HEADER_SIZE:]) {
+			return NewCorruptionError("zapis u %s na poziciji %d je nepotpun, a iza njega postoje zapisi", file.Name(), position)
+		}
 	}
-	err = file.Close()
+	err := file.Truncate(position)
 	if err != nil {
-		log.Fatal(err)
+		return NewIOError(err)
 	}
-	return keys, dataArr
+	return nil
 }